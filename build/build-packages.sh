@@ -13,10 +13,12 @@
 #
 
 usage() {
-    echo "Usage: build-packages.sh [-p PACKAGE] [-k KEY_FILE] [--clean] [--build] [--pack] [--index] [--upload] [--upload-packages] [--all]"
+    echo "Usage: build-packages.sh [-p PACKAGE] [-k KEY_FILE] [-d DELTAS] [--clean] [--build] [--pack] [--index] [--upload] [--upload-packages] [--all]"
+    echo "Deprecated: use 'smc package publish', environments are defined in environments.json (see environments.example.json)"
     echo "Options:"
     echo "  -p, --package        Package name (optional, if not specified, will process all packages)"
     echo "  -k, --key            Private key file (default: costrict-private.pem)"
+    echo "  -d, --deltas         Generate delta files from the previous N versions (default: 0)"
     echo "  --clean              Need clean first"
     echo "  --build              Need build packages"
     echo "  --pack               Need pack packages"
@@ -41,6 +43,8 @@ enable_upload() {
 }
 # 默认私钥文件
 key_file="costrict-private.pem"
+# 默认不生成差分包
+deltas=0
 
 # 默认参数值
 need_clean=false
@@ -54,7 +58,7 @@ upload_test=false
 upload_qianliu=false
 
 # Parse command line options
-args=$(getopt -o hp:k: --long help,package:,key:,clean,build,pack,index,all,upload,upload-packages,upload-to: -n 'build-packages.sh' -- "$@")
+args=$(getopt -o hp:k:d: --long help,package:,key:,deltas:,clean,build,pack,index,all,upload,upload-packages,upload-to: -n 'build-packages.sh' -- "$@")
 [ $? -ne 0 ] && usage
 
 eval set -- "$args"
@@ -63,6 +67,7 @@ while true; do
     case "$1" in
         -p|--package) package="$2"; shift 2;;
         -k|--key) key_file="$2"; shift 2;;
+        -d|--deltas) deltas="$2"; shift 2;;
         --clean) need_clean=true; shift;;
         --build) need_build=true; shift;;
         --pack) need_pack=true; shift;;
@@ -192,11 +197,20 @@ build_conf() {
             echo "Source file: $source_file"
             echo "Target file: $target_file"
             
-            # 复制文件
-            cp "$source_file" "$target_file"
-            if [ $? -ne 0 ]; then
-                echo "Error: Failed to copy $source_file to $target_file"
-                exit 1
+            # 有覆盖文件(*.patch.json)时由smc合并生成，否则直接复制
+            local overlay="${target%.json}.patch.json"
+            if [ -f "$source_dir/$os/$overlay" ] || [ -f "$source_dir/$os/$arch/$overlay" ]; then
+                smc package render "$package_name" -b "$current_dir" -s "$os" -a "$arch" -o "$target_file"
+                if [ $? -ne 0 ]; then
+                    echo "Error: Failed to render $target_file with overlays"
+                    exit 1
+                fi
+            else
+                cp "$source_file" "$target_file"
+                if [ $? -ne 0 ]; then
+                    echo "Error: Failed to copy $source_file to $target_file"
+                    exit 1
+                fi
             fi
             
             echo "Successfully copied $source_file to $target_file"
@@ -316,8 +330,8 @@ pack_package() {
     local description="$7"
     local filename="$8"
     
-    echo "smc package build ${package} -f ${file} -k ${key_file} --os ${os} --arch ${arch} --version ${ver} --type ${type} --filename ${filename} --description ${description}"
-    smc package build ${package} -f ${file} -k ${key_file} --os ${os} --arch ${arch} --version ${ver} --type ${type} --filename "${filename}" --description "${description}"
+    echo "smc package build ${package} -f ${file} -k ${key_file} --os ${os} --arch ${arch} --version ${ver} --type ${type} --filename ${filename} --description ${description} --deltas ${deltas}"
+    smc package build ${package} -f ${file} -k ${key_file} --os ${os} --arch ${arch} --version ${ver} --type ${type} --filename "${filename}" --description "${description}" --deltas ${deltas}
 }
 
 pack_dir_packages() {
@@ -357,8 +371,8 @@ pack_dir_packages() {
 index_packages() {
     local dir=$1
     
-    echo "smc package index -b ${dir}"
-    smc package index -b "${dir}"
+    echo "smc package index -b ${dir} -k ${key_file}"
+    smc package index -b "${dir}" -k "${key_file}"
 }
 
 # Function to clean up old version directories for a package
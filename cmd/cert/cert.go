@@ -22,5 +22,6 @@ func init() {
 
 	certCmd.Example = `  smc cert genkey
   smc cert sign -k costrict-private.pem -t ./shenma
-  smc cert sum -f ./shenma`
+  smc cert sum -f ./shenma
+  smc cert trust list`
 }
@@ -11,7 +11,7 @@ import (
 )
 
 func genKeys() {
-	if err := utils.GenKeyFiles(optPublicKey, optPrivateKey); err != nil {
+	if err := utils.GenKeyFiles(optPublicKey, optPrivateKey, optKeyType); err != nil {
 		fmt.Println(err)
 	}
 }
@@ -20,7 +20,7 @@ func genKeys() {
 var genkeyCmd = &cobra.Command{
 	Use:   "genkey",
 	Short: "Generate a pair of public/private keys",
-	Long:  `Generate a pair of public/private keys and saves them as ASN.1 DER encoded files`,
+	Long:  `Generate a pair of public/private keys (rsa, ed25519 or ecdsa-p256) and saves them as PEM encoded files`,
 
 	Run: func(cmd *cobra.Command, args []string) {
 		genKeys()
@@ -29,13 +29,19 @@ var genkeyCmd = &cobra.Command{
 
 var optPublicKey string
 var optPrivateKey string
+var optKeyType string
 
 func init() {
 	certCmd.AddCommand(genkeyCmd)
 
 	genkeyCmd.Example = `  # Generate a pair of public/private key files, output public key as public.key and private key as private.pem
-  smc cert genkey`
+  smc cert genkey
+  # Generate an Ed25519 key pair
+  smc cert genkey --type ed25519 -c costrict-public.key -e costrict-private.pem
+  # Generate an ECDSA P-256 key pair
+  smc cert genkey --type ecdsa-p256`
 	genkeyCmd.Flags().SortFlags = false
 	genkeyCmd.Flags().StringVarP(&optPublicKey, "public", "c", "public.key", "public key file")
 	genkeyCmd.Flags().StringVarP(&optPrivateKey, "private", "e", "private.pem", "private key file")
+	genkeyCmd.Flags().StringVarP(&optKeyType, "type", "t", utils.KeyTypeRsa, "Key type: rsa/ed25519/ecdsa-p256")
 }
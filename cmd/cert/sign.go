@@ -13,7 +13,7 @@ import (
 )
 
 func signSoftware() error {
-	_, md5str, err := utils.CalcFileMd5(optTarget)
+	_, sumstr, err := utils.CalcFileChecksum(optTarget, optSignAlgo)
 	if err != nil {
 		return err
 	}
@@ -21,7 +21,7 @@ func signSoftware() error {
 	if err != nil {
 		return err
 	}
-	data, err := utils.Sign(priKey, []byte(md5str))
+	data, err := utils.Sign(priKey, []byte(sumstr))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
 	} else {
@@ -45,6 +45,7 @@ var signCmd = &cobra.Command{
 
 var optKeyFile string
 var optTarget string
+var optSignAlgo string
 
 func init() {
 	certCmd.AddCommand(signCmd)
@@ -54,6 +55,7 @@ func init() {
 	signCmd.Flags().SortFlags = false
 	signCmd.Flags().StringVarP(&optKeyFile, "key", "k", "", "Private key file")
 	signCmd.Flags().StringVarP(&optTarget, "target", "t", "", "Target file to sign")
+	signCmd.Flags().StringVar(&optSignAlgo, "algo", utils.ChecksumSha256, "Checksum algorithm: sha256/sha512/md5")
 	signCmd.MarkFlagRequired("target")
 	signCmd.MarkFlagRequired("key")
 }
@@ -10,36 +10,40 @@ import (
 	"github.com/zgsm-ai/smc/internal/utils"
 )
 
-func md5sum() error {
-	_, md5str, err := utils.CalcFileMd5(optFile)
+func checksum() error {
+	_, sumstr, err := utils.CalcFileChecksum(optFile, optSumAlgo)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%s\n", md5str)
+	fmt.Printf("%s\n", sumstr)
 	return nil
 }
 
 // sumCmd represents the 'smc sum' command
 var sumCmd = &cobra.Command{
 	Use:   "sum",
-	Short: "Calculate MD5 checksum",
-	Long:  `Calculate MD5 checksum for a file`,
+	Short: "Calculate file checksum",
+	Long:  `Calculate checksum for a file, using sha256 by default`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := md5sum(); err != nil {
+		if err := checksum(); err != nil {
 			fmt.Println(err)
 		}
 	},
 }
 
 var optFile string
+var optSumAlgo string
 
 func init() {
 	certCmd.AddCommand(sumCmd)
 
-	sumCmd.Example = `  # Calculate file checksum using MD5 algorithm
-  smc cert sum -f ./shenma`
+	sumCmd.Example = `  # Calculate file checksum using SHA-256 algorithm
+  smc cert sum -f ./shenma
+  # Calculate file checksum using MD5 algorithm
+  smc cert sum -f ./shenma --algo md5`
 	sumCmd.Flags().SortFlags = false
 	sumCmd.Flags().StringVarP(&optFile, "file", "f", "", "File name")
+	sumCmd.Flags().StringVar(&optSumAlgo, "algo", utils.ChecksumSha256, "Checksum algorithm: sha256/sha512/md5")
 	sumCmd.MarkFlagRequired("file")
 }
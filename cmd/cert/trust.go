@@ -0,0 +1,53 @@
+package cert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Manage trusted keys for package verification",
+	Long:  `Manage the local trust store (key ring) used to verify package signatures, supports key rotation and revocation`,
+}
+
+/**
+ *	Parse time option, supports '2006-01-02' and RFC3339 format
+ */
+func parseTimeOpt(val string) (*time.Time, error) {
+	if val == "" {
+		return nil, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", val, time.Local); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time '%s', expect 2006-01-02 or RFC3339", val)
+	}
+	return &t, nil
+}
+
+/**
+ *	Get the trust store file path
+ */
+func trustFile() string {
+	if optTrustFile != "" {
+		return optTrustFile
+	}
+	return utils.DefaultTrustFile("")
+}
+
+var optTrustFile string
+
+func init() {
+	certCmd.AddCommand(trustCmd)
+
+	trustCmd.Example = `  smc cert trust add -f costrict-public.key --not-after 2027-01-01
+  smc cert trust list
+  smc cert trust revoke 3f2a9c0d1b7e4a55 --reason "key leaked"`
+	trustCmd.PersistentFlags().StringVar(&optTrustFile, "keyring", "", "Trust store file (default ~/.costrict/trust/keyring.json)")
+}
@@ -0,0 +1,73 @@
+package cert
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+func trustAdd() error {
+	pubKey, err := os.ReadFile(optTrustKeyFile)
+	if err != nil {
+		return err
+	}
+	notBefore, err := parseTimeOpt(optNotBefore)
+	if err != nil {
+		return err
+	}
+	notAfter, err := parseTimeOpt(optNotAfter)
+	if err != nil {
+		return err
+	}
+	fname := trustFile()
+	ts, err := utils.LoadTrustStore(fname)
+	if err != nil {
+		return err
+	}
+	keyId, err := ts.Add(utils.TrustedKey{
+		PublicKey: string(pubKey),
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		Comment:   optTrustComment,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ts.Save(fname); err != nil {
+		return err
+	}
+	fmt.Printf("Key '%s' (%s) is trusted\n", keyId, utils.KeyTypeOf(pubKey))
+	return nil
+}
+
+var trustAddCmd = &cobra.Command{
+	Use:   "add -f public-key-file",
+	Short: "Add a public key to the trust store",
+	Long:  `Add a public key to the trust store, the key ID is calculated from the public key`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := trustAdd(); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var optTrustKeyFile string
+var optNotBefore string
+var optNotAfter string
+var optTrustComment string
+
+func init() {
+	trustCmd.AddCommand(trustAddCmd)
+
+	trustAddCmd.Example = `  # Trust a new release key for one year
+  smc cert trust add -f costrict-public.key --not-before 2026-01-01 --not-after 2027-01-01 --comment "release key 2026"`
+	trustAddCmd.Flags().SortFlags = false
+	trustAddCmd.Flags().StringVarP(&optTrustKeyFile, "file", "f", "", "Public key file")
+	trustAddCmd.Flags().StringVar(&optNotBefore, "not-before", "", "Start of validity window (2006-01-02 or RFC3339)")
+	trustAddCmd.Flags().StringVar(&optNotAfter, "not-after", "", "End of validity window (2006-01-02 or RFC3339)")
+	trustAddCmd.Flags().StringVarP(&optTrustComment, "comment", "m", "", "Comment")
+	trustAddCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,90 @@
+package cert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in list format
+ */
+type TrustKey_Columns struct {
+	KeyId     string `json:"keyId"`
+	Type      string `json:"type"`
+	NotBefore string `json:"notBefore"`
+	NotAfter  string `json:"notAfter"`
+	Status    string `json:"status"`
+	Comment   string `json:"comment"`
+}
+
+func formatTimeOpt(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func keyStatus(ts *utils.TrustStore, key *utils.TrustedKey) string {
+	if ts.IsRevoked(key.KeyId) {
+		return "revoked"
+	}
+	if !key.ValidAt(time.Now()) {
+		return "expired"
+	}
+	return "valid"
+}
+
+func trustList() error {
+	ts, err := utils.LoadTrustStore(trustFile())
+	if err != nil {
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	// The builtin key is always trusted unless it is revoked
+	builtin := utils.TrustedKey{PublicKey: utils.SHENMA_PUBLIC_KEY, Comment: "builtin"}
+	builtin.KeyId, _ = utils.KeyIdOf([]byte(builtin.PublicKey))
+	keys := append([]utils.TrustedKey{builtin}, ts.Keys...)
+	for i := range keys {
+		k := &keys[i]
+		row := TrustKey_Columns{}
+		row.KeyId = k.KeyId
+		row.Type = utils.KeyTypeOf([]byte(k.PublicKey))
+		row.NotBefore = formatTimeOpt(k.NotBefore)
+		row.NotAfter = formatTimeOpt(k.NotAfter)
+		row.Status = keyStatus(ts, k)
+		row.Comment = k.Comment
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	utils.PrintFormat(dataList)
+	if len(ts.Revoked) > 0 {
+		fmt.Println()
+		for _, r := range ts.Revoked {
+			fmt.Printf("revoked: %s at %s, reason: %s\n", r.KeyId,
+				r.RevokedAt.Format("2006-01-02 15:04:05"), r.Reason)
+		}
+	}
+	return nil
+}
+
+var trustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted keys",
+	Long:  `List trusted keys and revocation entries in the trust store`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := trustList(); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	trustCmd.AddCommand(trustListCmd)
+
+	trustListCmd.Example = `  smc cert trust list`
+}
@@ -0,0 +1,46 @@
+package cert
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+func trustRevoke(keyId string) error {
+	fname := trustFile()
+	ts, err := utils.LoadTrustStore(fname)
+	if err != nil {
+		return err
+	}
+	if err := ts.Revoke(keyId, optRevokeReason); err != nil {
+		return err
+	}
+	if err := ts.Save(fname); err != nil {
+		return err
+	}
+	fmt.Printf("Key '%s' is revoked, packages signed by it will be rejected\n", keyId)
+	return nil
+}
+
+var trustRevokeCmd = &cobra.Command{
+	Use:   "revoke key-id",
+	Short: "Revoke a key",
+	Long:  `Revoke a key, packages signed by the revoked key will be rejected. The builtin key can be revoked too`,
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := trustRevoke(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var optRevokeReason string
+
+func init() {
+	trustCmd.AddCommand(trustRevokeCmd)
+
+	trustRevokeCmd.Example = `  smc cert trust revoke 3f2a9c0d1b7e4a55 --reason "key leaked"`
+	trustRevokeCmd.Flags().StringVarP(&optRevokeReason, "reason", "r", "", "Reason for revocation")
+}
@@ -1,6 +1,7 @@
 package component
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -83,13 +84,15 @@ func activatePackage() error {
 		return err
 	}
 	if err = u.ActivatePackage(pkg); err != nil {
-		if optActivatePackageName == "smc" {
+		if optActivatePackageName == "smc" && !errors.Is(err, utils.ErrProbeFailed) {
 			// 当package选项未设置时，默认升级smc自身
 			return activateSelf(u, ver)
 		}
 		fmt.Printf("The '%s-%s' activate failed: %v", optActivatePackageName, optActivatePackageVersion, err)
 		return err
 	}
+	// 手动激活的版本需要固定，避免被自动升级替换
+	u.AddPinned(pkg)
 
 	fmt.Printf("The '%s-%s' is activated successfully\n", optActivatePackageName, optActivatePackageVersion)
 	return nil
@@ -98,7 +101,7 @@ func activatePackage() error {
 var activateCmd = &cobra.Command{
 	Use:   "activate {package-name | -p package-name}",
 	Short: "Activate package",
-	Long:  `Activate package`,
+	Long:  `Activate a downloaded version of package and pin it, run 'smc component unpin' to resume automatic upgrades`,
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 1 {
@@ -0,0 +1,175 @@
+package component
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/env"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in bundle report
+ */
+type Bundle_Columns struct {
+	PackageName string `json:"packageName"`
+	Version     string `json:"version"`
+	Os          string `json:"os"`
+	Arch        string `json:"arch"`
+	FileName    string `json:"fileName"`
+	Size        string `json:"size"`
+}
+
+/**
+ *	Parse 'package[@version,version...]' arguments and --platform options into bundle items
+ */
+func getBundleItems(args []string, platforms []string) ([]utils.BundleItem, error) {
+	if len(platforms) == 0 {
+		platforms = []string{runtime.GOOS + "/" + runtime.GOARCH}
+	}
+	var items []utils.BundleItem
+	for _, arg := range args {
+		name, verList, _ := strings.Cut(arg, "@")
+		var vers []utils.VersionNumber
+		if verList != "" {
+			for _, s := range strings.Split(verList, ",") {
+				var ver utils.VersionNumber
+				if err := ver.Parse(s); err != nil {
+					return nil, fmt.Errorf("invalid version '%s' of '%s': %v", s, name, err)
+				}
+				vers = append(vers, ver)
+			}
+		}
+		for _, p := range platforms {
+			osName, arch, ok := strings.Cut(p, "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid platform '%s', it should be os/arch", p)
+			}
+			items = append(items, utils.BundleItem{PackageName: name, Os: osName, Arch: arch, Versions: vers})
+		}
+	}
+	return items, nil
+}
+
+func exportBundle(args []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	items, err := getBundleItems(args, optBundlePlatforms)
+	if err != nil {
+		return err
+	}
+	var priKey []byte
+	if optBundleKey != "" {
+		if priKey, err = os.ReadFile(optBundleKey); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("warning: the bundle is not signed, machines using strict policy will reject it")
+	}
+	secs, err := utils.Time2Sec(optBundleExpires)
+	if err != nil {
+		return fmt.Errorf("invalid expires '%s': %v", optBundleExpires, err)
+	}
+	manifest, err := utils.ExportBundle(utils.UpgradeConfig{
+		BaseUrl:  env.BaseUrl + "/costrict",
+		Progress: true,
+	}, items, optBundleOutput, priKey, time.Now().Add(time.Duration(secs)*time.Second))
+	if err != nil {
+		fmt.Printf("Export bundle failed: %v\n", err)
+		return err
+	}
+	fmt.Printf("Bundle '%s' is exported, files: %d\n", optBundleOutput, len(manifest.Files))
+	return nil
+}
+
+func importBundle(fname string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	pkgs, err := utils.ImportBundle(utils.UpgradeConfig{
+		BaseUrl: env.BaseUrl + "/costrict",
+	}, fname)
+	var dataList []*orderedmap.OrderedMap
+	for _, pkg := range pkgs {
+		row := Bundle_Columns{
+			PackageName: pkg.PackageName,
+			Version:     pkg.VersionId.String(),
+			Os:          pkg.Os,
+			Arch:        pkg.Arch,
+			FileName:    pkg.FileName,
+			Size:        fmt.Sprintf("%d", pkg.Size),
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	if len(dataList) > 0 {
+		utils.PrintFormat(dataList)
+	}
+	if err != nil {
+		fmt.Printf("Import bundle '%s' failed: %v\n", fname, err)
+		return err
+	}
+	if len(pkgs) == 0 {
+		fmt.Printf("No package for %s/%s in bundle '%s'\n", runtime.GOOS, runtime.GOARCH, fname)
+		return nil
+	}
+	fmt.Println("Packages are imported, run 'smc component upgrade' or 'smc component activate' to install them")
+	return nil
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Export and import offline bundles",
+	Long:  `Offline bundles carry index files, package descriptors and package files, so that machines without access to the cloud can upgrade`,
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export {package[@version,...]}... -o file",
+	Short: "Download packages from the cloud into an offline bundle",
+	Long:  `Download and verify packages from the cloud, then write them into a signed offline bundle (tar.gz). The newest version is exported if no version is specified`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return exportBundle(args)
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import {bundle-file}",
+	Short: "Import an offline bundle into the local package cache",
+	Long:  `Verify the offline bundle, its index files and packages exactly as online upgrades do, then put packages of this platform into the local package cache`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return importBundle(args[0])
+	},
+}
+
+const bundleExample = `  # export the newest costrict and codebase-syncer 1.2.0 for windows/amd64 and linux/amd64
+  smc component bundle export costrict codebase-syncer@1.2.0 --platform windows/amd64 --platform linux/amd64 -o costrict-bundle.tar.gz -k costrict-private.pem
+  # import the bundle on an offline machine, then upgrade as usual
+  smc component bundle import costrict-bundle.tar.gz
+  smc component upgrade costrict`
+
+var optBundleOutput string
+var optBundlePlatforms []string
+var optBundleKey string
+var optBundleExpires string
+
+func init() {
+	componentCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleCmd.Example = bundleExample
+
+	bundleExportCmd.Flags().SortFlags = false
+	bundleExportCmd.Flags().StringVarP(&optBundleOutput, "output", "o", "smc-bundle.tar.gz", "Offline bundle file")
+	bundleExportCmd.Flags().StringArrayVar(&optBundlePlatforms, "platform", nil, "Platform os/arch to export, can be repeated (default this platform)")
+	bundleExportCmd.Flags().StringVarP(&optBundleKey, "key", "k", "", "Private key file used to sign the bundle")
+	bundleExportCmd.Flags().StringVarP(&optBundleExpires, "expires", "e", "90d", "Validity period of the bundle signature (s/m/h/d)")
+}
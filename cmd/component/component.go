@@ -8,7 +8,7 @@ import (
 var componentCmd = &cobra.Command{
 	Use:   "component",
 	Short: "Management components",
-	Long:  `Management components, list, upgrade, remove, etc.`,
+	Long:  `Management components, list, upgrade, rollback, pin, remove, gc, doctor, diff, etc.`,
 }
 
 const componentExample = `  # Add task component
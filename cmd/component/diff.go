@@ -0,0 +1,118 @@
+package component
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in local changes of a conf package
+ */
+type Diff_Columns struct {
+	Path    string `json:"path"`
+	Shipped string `json:"shipped"`
+	Local   string `json:"local"`
+}
+
+/**
+ *	Fields displayed in unresolved upgrade conflicts
+ */
+type Conflict_Columns struct {
+	Path  string `json:"path"`
+	Base  string `json:"base"`
+	Local string `json:"local"`
+	New   string `json:"new"`
+}
+
+func diffPackage(name string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	u := utils.NewUpgrader(name, utils.UpgradeConfig{})
+	drift, err := u.GetConfDrift()
+	if err != nil {
+		fmt.Printf("Diff '%s' failed: %v\n", name, err)
+		return err
+	}
+	if optDiffJson {
+		data, err := json.MarshalIndent(drift, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if !drift.Modified {
+		fmt.Printf("'%s' is the same as shipped in %s\n", drift.File, drift.Version.String())
+	} else if len(drift.Changes) == 0 {
+		fmt.Printf("'%s' is modified locally, but isn't valid JSON\n", drift.File)
+	} else {
+		fmt.Printf("'%s' is modified locally, compared with %s:\n", drift.File, drift.Version.String())
+		var dataList []*orderedmap.OrderedMap
+		for _, c := range drift.Changes {
+			row := Diff_Columns{
+				Path:    c.Path,
+				Shipped: utils.JSONText(c.Old),
+				Local:   utils.JSONText(c.New),
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+		utils.PrintFormat(dataList)
+	}
+	if drift.Conflict != nil {
+		fmt.Printf("\nUpgrade to %s conflicts with local changes, the shipped file is saved as '%s'\n",
+			drift.Conflict.Version.String(), drift.Conflict.NewFile)
+		var dataList []*orderedmap.OrderedMap
+		for _, c := range drift.Conflict.Conflicts {
+			row := Conflict_Columns{
+				Path:  c.Path,
+				Base:  utils.JSONText(c.Base),
+				Local: utils.JSONText(c.Local),
+				New:   utils.JSONText(c.New),
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+		if len(dataList) > 0 {
+			utils.PrintFormat(dataList)
+		}
+		fmt.Printf("Merge it into '%s' by hand, the next upgrade will overwrite '%s'\n",
+			drift.Conflict.File, drift.Conflict.NewFile)
+	}
+	return nil
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff {package}",
+	Short: "Show local changes of a conf package",
+	Long: `Compare the installed file of a conf package with the copy shipped in the active version,
+and list the unresolved conflicts of the last upgrade.
+Upgrades merge shipped changes into locally modified JSON files; when both sides change the same value,
+the local file is kept and the shipped file is written beside it as {file}.new`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return diffPackage(args[0])
+	},
+}
+
+const diffExample = `  # Show what was changed locally in the costrict config
+  smc component diff costrict-config
+  # Print the changes and conflicts as JSON
+  smc component diff costrict-config --json`
+
+var optDiffJson bool
+
+func init() {
+	componentCmd.AddCommand(diffCmd)
+	diffCmd.Example = diffExample
+	diffCmd.SilenceUsage = true
+
+	diffCmd.Flags().SortFlags = false
+	diffCmd.Flags().BoolVar(&optDiffJson, "json", false, "Print the changes and conflicts as JSON")
+}
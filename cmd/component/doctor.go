@@ -0,0 +1,110 @@
+package component
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in doctor report
+ */
+type Doctor_Columns struct {
+	PackageName string `json:"packageName"`
+	Check       string `json:"check"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+}
+
+func diagnosePackages(names []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	issues, err := utils.DiagnosePackages(utils.UpgradeConfig{}, names, optDoctorFix)
+	if os.IsNotExist(err) {
+		fmt.Println("No package is installed")
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Diagnose packages failed: %v\n", err)
+		return err
+	}
+	// Local changes of configuration files are reported, but they aren't errors
+	unresolved := 0
+	for _, issue := range issues {
+		if !issue.Fixed && issue.Check != utils.DoctorDrift {
+			unresolved++
+		}
+	}
+	if optDoctorJson {
+		data, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		var dataList []*orderedmap.OrderedMap
+		for _, issue := range issues {
+			row := Doctor_Columns{
+				PackageName: issue.PackageName,
+				Check:       issue.Check,
+				Status:      "error",
+				Message:     issue.Message,
+			}
+			if issue.Check == utils.DoctorDrift {
+				row.Status = "info"
+			} else if issue.Fixed {
+				row.Status = "fixed"
+			} else if issue.Fixable {
+				row.Status = "fixable"
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+		if len(dataList) > 0 {
+			utils.PrintFormat(dataList)
+		}
+		fmt.Printf("%d issues found, %d remain\n", len(issues), unresolved)
+	}
+	if unresolved > 0 {
+		return fmt.Errorf("%d issues remain", unresolved)
+	}
+	return nil
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [package...]",
+	Short: "Diagnose and repair local installations",
+	Long: `Check installed packages against their active descriptors: size, checksum and signature of installed files,
+missing files of archives, files in the install directory which belong to no package, stale or interrupted todos,
+PATH missing the install directory, and broken PATH lines in ~/.bashrc.
+Locally modified files of conf packages are reported as drift, they are never overwritten, see 'smc component diff'.
+With --fix, re-activate damaged packages from the local cache, remove stale todos and leftover files,
+and repair PATH settings. Exits with non-zero status if any issue remains`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return diagnosePackages(args)
+	},
+}
+
+const doctorExample = `  # Diagnose all installed packages
+  smc component doctor
+  # Diagnose costrict and repair what can be repaired safely
+  smc component doctor costrict --fix`
+
+var optDoctorFix bool
+var optDoctorJson bool
+
+func init() {
+	componentCmd.AddCommand(doctorCmd)
+	doctorCmd.Example = doctorExample
+	doctorCmd.SilenceUsage = true
+
+	doctorCmd.Flags().SortFlags = false
+	doctorCmd.Flags().BoolVar(&optDoctorFix, "fix", false, "Repair the issues which can be fixed safely")
+	doctorCmd.Flags().BoolVar(&optDoctorJson, "json", false, "Print the issues as JSON")
+}
@@ -0,0 +1,127 @@
+package component
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in gc report
+ */
+type Gc_Columns struct {
+	PackageName string `json:"packageName"`
+	Version     string `json:"version"`
+	Size        string `json:"size"`
+	Age         string `json:"age"`
+	Action      string `json:"action"`
+	Reason      string `json:"reason"`
+}
+
+func collectGarbage() error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	cfg := utils.UpgradeConfig{CacheKeep: optGcKeep}
+	if optGcMaxSize != "" {
+		q, err := utils.QuantityParse(optGcMaxSize)
+		if err == nil {
+			err = q.ChangeUnit("")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid max-size '%s': %v", optGcMaxSize, err)
+		}
+		cfg.CacheMaxSize = q.Amend
+	}
+	if optGcMaxAge != "" {
+		secs, err := utils.Time2Sec(optGcMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid max-age '%s': %v", optGcMaxAge, err)
+		}
+		cfg.CacheMaxAge = time.Duration(secs) * time.Second
+	}
+	u := utils.NewUpgrader("", cfg)
+	entries, err := u.CleanupCache(optGcDryRun)
+	if os.IsNotExist(err) {
+		fmt.Println("No package is cached")
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Cleanup package cache failed: %v\n", err)
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	var total, reclaimed uint64
+	count := 0
+	for _, e := range entries {
+		total += uint64(e.Size)
+		row := Gc_Columns{
+			PackageName: e.PackageName,
+			Version:     e.Version.String(),
+			Size:        formatSize(uint64(e.Size)),
+			Age:         fmt.Sprintf("%dd", int(time.Since(e.Time).Hours()/24)),
+			Action:      "keep",
+			Reason:      e.Protected,
+		}
+		if e.Reason != "" {
+			row.Action = "remove"
+			row.Reason = e.Reason
+			reclaimed += uint64(e.Size)
+			count++
+		}
+		if optGcVerbose || e.Reason != "" {
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+	}
+	if len(dataList) > 0 {
+		utils.PrintFormat(dataList)
+	}
+	if optGcDryRun {
+		fmt.Printf("%d versions, %s reclaimable (cache: %s)\n", count, formatSize(reclaimed), formatSize(total))
+	} else {
+		fmt.Printf("%d versions removed, %s reclaimed (cache: %s)\n", count, formatSize(reclaimed), formatSize(total-reclaimed))
+	}
+	return nil
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove old versions from the local package cache",
+	Long: `Remove cached package versions by the retention policy: keep the newest N versions of each package,
+remove versions older than the max age, and remove the oldest versions while the cache exceeds the max size.
+Active, pinned, pending and rollback versions are always kept.
+The policy defaults to SMC_CACHE_KEEP, SMC_CACHE_MAX_SIZE and SMC_CACHE_MAX_AGE`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return collectGarbage()
+	},
+}
+
+const gcExample = `  # Show reclaimable versions and bytes without removing anything
+  smc component gc --dry-run
+  # Keep 2 versions of each package, and no more than 500M in total
+  smc component gc --keep 2 --max-size 500M`
+
+var optGcKeep int
+var optGcMaxSize string
+var optGcMaxAge string
+var optGcDryRun bool
+var optGcVerbose bool
+
+func init() {
+	componentCmd.AddCommand(gcCmd)
+	gcCmd.Example = gcExample
+
+	gcCmd.Flags().SortFlags = false
+	gcCmd.Flags().IntVar(&optGcKeep, "keep", 0, "Versions of each package to keep (default SMC_CACHE_KEEP)")
+	gcCmd.Flags().StringVar(&optGcMaxSize, "max-size", "", "Max total size of the cache, such as 2G (default SMC_CACHE_MAX_SIZE)")
+	gcCmd.Flags().StringVar(&optGcMaxAge, "max-age", "", "Max age of cached versions, such as 90d (default SMC_CACHE_MAX_AGE)")
+	gcCmd.Flags().BoolVar(&optGcDryRun, "dry-run", false, "Only show which versions would be removed")
+	gcCmd.Flags().BoolVarP(&optGcVerbose, "verbose", "v", false, "Show kept versions as well")
+}
@@ -19,6 +19,7 @@ import (
  */
 type Package_Columns struct {
 	A           string `json:"A"`
+	P           string `json:"P"`
 	PackageName string `json:"packageName"`
 	Size        string `json:"size"`
 	Checksum    string `json:"checksum"`
@@ -44,9 +45,7 @@ func findPackage(pkgInfo utils.PackageVersion, pkgList []PackageInfo) *PackageIn
 		if pkg.PackageName == pkgInfo.PackageName &&
 			pkg.Os == pkgInfo.Os &&
 			pkg.Arch == pkgInfo.Arch &&
-			pkg.VersionId.Major == pkgInfo.VersionId.Major &&
-			pkg.VersionId.Minor == pkgInfo.VersionId.Minor &&
-			pkg.VersionId.Micro == pkgInfo.VersionId.Micro {
+			pkg.VersionId.String() == pkgInfo.VersionId.String() {
 			return &pkgList[i]
 		}
 	}
@@ -135,10 +134,19 @@ func packageList(packageName string, verbose bool) error {
 		return nil
 	}
 
-	// 格式化输出包列表
+	// 格式化输出包列表，A标记激活的版本，P标记固定的版本
 	var dataList []*orderedmap.OrderedMap
+	pins := make(map[string]string)
 	for _, p := range packageInfos {
 		pkg := p.Ver
+		pinned, ok := pins[pkg.PackageName]
+		if !ok {
+			pu := utils.NewUpgrader(pkg.PackageName, utils.UpgradeConfig{BaseDir: u.BaseDir})
+			if pin, err := pu.GetPinned(); err == nil {
+				pinned = pin.VersionId.String()
+			}
+			pins[pkg.PackageName] = pinned
+		}
 		row := Package_Columns{}
 		row.PackageName = pkg.PackageName
 		row.Os = pkg.Os
@@ -146,13 +154,18 @@ func packageList(packageName string, verbose bool) error {
 		row.Size = fmt.Sprintf("%d", pkg.Size)
 		row.Checksum = pkg.Checksum
 		row.Algo = pkg.ChecksumAlgo
-		row.Version = fmt.Sprintf("%d.%d.%d", pkg.VersionId.Major, pkg.VersionId.Minor, pkg.VersionId.Micro)
+		row.Version = pkg.VersionId.String()
 		row.Description = pkg.Description
 		if p.Activated {
 			row.A = "*"
 		} else {
 			row.A = " "
 		}
+		if pinned == row.Version {
+			row.P = "P"
+		} else {
+			row.P = " "
+		}
 
 		recordMap, _ := utils.StructToOrderedMap(row)
 		dataList = append(dataList, recordMap)
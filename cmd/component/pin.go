@@ -0,0 +1,203 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/env"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in pending list
+ */
+type Pending_Columns struct {
+	PackageName string `json:"packageName"`
+	Installed   string `json:"installed"`
+	Pinned      string `json:"pinned"`
+	Pending     string `json:"pending"`
+	Description string `json:"description"`
+}
+
+func newPinUpgrader(packageName string) (*utils.Upgrader, error) {
+	if err := common.InitCommonEnv(); err != nil {
+		return nil, err
+	}
+	if packageName == "" {
+		fmt.Println("Error: package name is required (either as positional argument or via -p/--package option)")
+		return nil, fmt.Errorf("miss parameter")
+	}
+	return utils.NewUpgrader(packageName, utils.UpgradeConfig{
+		BaseUrl:  env.BaseUrl + "/costrict",
+		Progress: true,
+	}), nil
+}
+
+func pinPackage() error {
+	u, err := newPinUpgrader(optPinPackageName)
+	if err != nil {
+		return err
+	}
+	if optPinVersion == "" {
+		fmt.Println("Error: package version is required, use 'smc component hold' to pin the current version")
+		return fmt.Errorf("miss parameter")
+	}
+	var ver utils.VersionNumber
+	if err = ver.Parse(optPinVersion); err != nil {
+		fmt.Printf("The version '%s' is invalid\n", optPinVersion)
+		return err
+	}
+	pkg, err := u.PinPackage(ver)
+	if err != nil {
+		fmt.Printf("The '%s' pin to %s failed: %v\n", optPinPackageName, ver.String(), err)
+		return err
+	}
+	fmt.Printf("The '%s' is pinned to %s\n", optPinPackageName, pkg.VersionId.String())
+	return nil
+}
+
+func holdPackage() error {
+	u, err := newPinUpgrader(optPinPackageName)
+	if err != nil {
+		return err
+	}
+	pkg, err := u.HoldPackage()
+	if err != nil {
+		fmt.Printf("The '%s' hold failed: %v\n", optPinPackageName, err)
+		return err
+	}
+	fmt.Printf("The '%s' is held at %s\n", optPinPackageName, pkg.VersionId.String())
+	return nil
+}
+
+func unpinPackage() error {
+	u, err := newPinUpgrader(optPinPackageName)
+	if err != nil {
+		return err
+	}
+	pinned, err := u.GetPinned()
+	if err != nil {
+		fmt.Printf("The '%s' is not pinned\n", optPinPackageName)
+		return nil
+	}
+	u.RemovePinned()
+	fmt.Printf("The '%s' is unpinned from %s, it will be upgraded automatically\n",
+		optPinPackageName, pinned.VersionId.String())
+	return nil
+}
+
+func listPending() error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	pkgs, err := utils.GetPendingPackages("")
+	if err != nil {
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	for _, pkg := range pkgs {
+		if optPinPackageName != "" && pkg.PackageName != optPinPackageName {
+			continue
+		}
+		u := utils.NewUpgrader(pkg.PackageName, utils.UpgradeConfig{})
+		row := Pending_Columns{
+			PackageName: pkg.PackageName,
+			Installed:   "-",
+			Pinned:      "-",
+			Pending:     pkg.VersionId.String(),
+			Description: pkg.Description,
+		}
+		if cur, err := u.GetLocalVersion(nil); err == nil {
+			// 已经安装了待办的版本，待办已经过时
+			if utils.CompareVersion(cur.VersionId, pkg.VersionId) >= 0 {
+				continue
+			}
+			row.Installed = cur.VersionId.String()
+		}
+		if pinned, err := u.GetPinned(); err == nil {
+			row.Pinned = pinned.VersionId.String()
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	if len(dataList) == 0 {
+		fmt.Println("No pending upgrades")
+		return nil
+	}
+	utils.PrintFormat(dataList)
+	return nil
+}
+
+func pinPackageArgs(args []string) {
+	if len(args) == 1 {
+		optPinPackageName = args[0]
+	}
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin {package-name | -p package-name} -v version",
+	Short: "Pin package to a version",
+	Long:  `Install the version if needed and pin the package to it, automatic upgrades keep the package at the pinned version`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pinPackageArgs(args)
+		return pinPackage()
+	},
+}
+
+var holdCmd = &cobra.Command{
+	Use:   "hold {package-name | -p package-name}",
+	Short: "Pin package to the current version",
+	Long:  `Pin package to the current version, automatic upgrades are suspended until it is unpinned`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pinPackageArgs(args)
+		return holdPackage()
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin {package-name | -p package-name}",
+	Short: "Unpin package",
+	Long:  `Remove the pin set by pin, hold, activate or rollback, so that the package is upgraded automatically again`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pinPackageArgs(args)
+		return unpinPackage()
+	},
+}
+
+var pendingCmd = &cobra.Command{
+	Use:   "pending [package-name | -p package-name]",
+	Short: "List pending upgrades",
+	Long:  `List newer versions found for pinned packages, and upgrades which were interrupted`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pinPackageArgs(args)
+		return listPending()
+	},
+}
+
+const pinExample = `  # pin codebase-syncer to 1.2.0, installing it if needed
+  smc component pin codebase-syncer -v 1.2.0
+  # keep codebase-syncer at the current version
+  smc component hold codebase-syncer
+  # resume automatic upgrades
+  smc component unpin codebase-syncer
+  # list newer versions waiting for pinned packages
+  smc component pending`
+
+var optPinPackageName string
+var optPinVersion string
+
+func init() {
+	for _, c := range []*cobra.Command{pinCmd, holdCmd, unpinCmd, pendingCmd} {
+		componentCmd.AddCommand(c)
+		c.Flags().SortFlags = false
+		c.Example = pinExample
+		c.Flags().StringVarP(&optPinPackageName, "package", "p", "", "package name")
+	}
+	pinCmd.Flags().StringVarP(&optPinVersion, "version", "v", "", "version to pin")
+}
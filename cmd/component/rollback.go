@@ -0,0 +1,69 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/env"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+func rollbackPackage() error {
+	var err error
+	if err = common.InitCommonEnv(); err != nil {
+		return err
+	}
+
+	if optRollbackPackageName == "" {
+		fmt.Println("Error: package name is required (either as positional argument or via -p/--package option)")
+		return fmt.Errorf("miss parameter")
+	}
+	u := utils.NewUpgrader(optRollbackPackageName, utils.UpgradeConfig{
+		BaseUrl: env.BaseUrl + "/costrict",
+	})
+	cur, err := u.GetLocalVersion(nil)
+	if err != nil {
+		fmt.Printf("The '%s' is not installed\n", optRollbackPackageName)
+		return err
+	}
+	prev, err := u.RollbackPackage()
+	if err != nil {
+		fmt.Printf("The '%s' rollback failed: %v\n", optRollbackPackageName, err)
+		return err
+	}
+	// 固定回退后的版本，避免自动升级又升级到刚回退的版本
+	u.AddPinned(prev)
+
+	fmt.Printf("The '%s' is rolled back from %s to %s\n", optRollbackPackageName,
+		cur.VersionId.String(), prev.VersionId.String())
+	return nil
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback {package-name | -p package-name}",
+	Short: "Rollback package to the previous version",
+	Long:  `Rollback package to the version that was active before the last activation`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			optRollbackPackageName = args[0]
+		}
+		return rollbackPackage()
+	},
+}
+
+const rollbackExample = `  # rollback package to the previous version
+  smc component rollback codebase-syncer
+  # rollback again to return to the version before rollback
+  smc component rollback -p codebase-syncer`
+
+var optRollbackPackageName string
+
+func init() {
+	componentCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().SortFlags = false
+	rollbackCmd.Example = rollbackExample
+
+	rollbackCmd.Flags().StringVarP(&optRollbackPackageName, "package", "p", "", "package name")
+}
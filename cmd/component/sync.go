@@ -0,0 +1,212 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/env"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in sync report
+ */
+type Sync_Columns struct {
+	PackageName string `json:"packageName"`
+	Kind        string `json:"kind"`
+	Range       string `json:"range"`
+	Installed   string `json:"installed"`
+	Resolved    string `json:"resolved"`
+	Result      string `json:"result"`
+}
+
+/**
+ *	A package declared in system-spec.json
+ */
+type syncItem struct {
+	kind string
+	spec utils.ComponentSpec
+}
+
+/**
+ *	System spec is installed by the configuration package 'system'
+ */
+const systemSpecPackage = "system"
+
+/**
+ *	Get packages to sync in installation order: configurations, manager, components
+ *	The spec itself ('system') is synced before this list is built
+ */
+func getSyncItems(spec *utils.SystemSpec) []syncItem {
+	var items []syncItem
+	for _, c := range spec.Configurations {
+		if c.Name != systemSpecPackage {
+			items = append(items, syncItem{kind: "configuration", spec: c})
+		}
+	}
+	if spec.Manager.Component.Name != "" {
+		items = append(items, syncItem{kind: "manager", spec: spec.Manager.Component})
+	}
+	for _, c := range spec.Components {
+		items = append(items, syncItem{kind: "component", spec: c})
+	}
+	return items
+}
+
+/**
+ *	Install or upgrade one package to the newest remote version satisfying its version range
+ */
+func syncPackage(item syncItem) (Sync_Columns, error) {
+	row := Sync_Columns{
+		PackageName: item.spec.Name,
+		Kind:        item.kind,
+		Range:       item.spec.Version,
+		Installed:   "-",
+		Resolved:    "-",
+	}
+	rng, err := utils.ParseVersionRange(item.spec.Version)
+	if err != nil {
+		return row, err
+	}
+	u := utils.NewUpgrader(item.spec.Name, utils.UpgradeConfig{
+		BaseUrl:  env.BaseUrl + "/costrict",
+		Progress: true,
+	})
+	var installed *utils.VersionNumber
+	cur, curErr := u.GetLocalVersion(nil)
+	if curErr == nil {
+		row.Installed = cur.VersionId.String()
+		installed = &cur.VersionId
+	}
+	if pinned, err := u.GetPinned(); err == nil {
+		row.Resolved = pinned.VersionId.String()
+		row.Result = "pinned"
+		return row, nil
+	}
+	ver, err := u.ResolveVersion(rng, installed)
+	if err != nil {
+		return row, err
+	}
+	row.Resolved = ver.String()
+	if curErr == nil && rng.Match(cur.VersionId) && utils.CompareVersion(cur.VersionId, ver) >= 0 {
+		row.Result = "up-to-date"
+		return row, nil
+	}
+	downgrade := curErr == nil && utils.CompareVersion(cur.VersionId, ver) > 0
+	if downgrade && !optSyncAllowDowngrade {
+		// The installed version is newer than the range allows, leave it alone
+		row.Result = "out of range"
+		return row, nil
+	}
+	if optSyncDryRun {
+		switch {
+		case curErr != nil:
+			row.Result = "to install"
+		case downgrade:
+			row.Result = "to downgrade"
+		default:
+			row.Result = "to upgrade"
+		}
+		return row, nil
+	}
+	// Versions resolved from the spec aren't pinned, the next sync may move them within the range
+	if _, _, err := u.ApplyPackage(ver); err != nil {
+		return row, err
+	}
+	switch {
+	case curErr != nil:
+		row.Result = "installed"
+	case downgrade:
+		row.Result = "downgraded"
+	default:
+		row.Result = "upgraded"
+	}
+	return row, nil
+}
+
+func syncPackages() error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	specFile := optSyncSpecFile
+	if specFile == "" {
+		specFile = utils.DefaultSystemSpecFile("")
+	}
+	spec := &utils.SystemSpec{}
+	if err := spec.Load(specFile); err != nil {
+		fmt.Printf("Load system spec '%s' failed: %v\n", specFile, err)
+		return err
+	}
+
+	var dataList []*orderedmap.OrderedMap
+	failed := 0
+	report := func(row Sync_Columns, err error) {
+		if err != nil {
+			row.Result = fmt.Sprintf("failed: %v", err)
+			failed++
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	// The spec declares itself as a configuration, sync it first and reload it
+	for _, c := range spec.Configurations {
+		if c.Name != systemSpecPackage {
+			continue
+		}
+		row, err := syncPackage(syncItem{kind: "configuration", spec: c})
+		report(row, err)
+		if err == nil && optSyncSpecFile == "" && !optSyncDryRun {
+			if err := spec.Load(specFile); err != nil {
+				fmt.Printf("Reload system spec '%s' failed: %v\n", specFile, err)
+				return err
+			}
+		}
+		break
+	}
+	for _, item := range getSyncItems(spec) {
+		row, err := syncPackage(item)
+		report(row, err)
+	}
+
+	utils.PrintFormat(dataList)
+	if failed > 0 {
+		return fmt.Errorf("%d packages failed to sync", failed)
+	}
+	return nil
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Install or upgrade all packages declared in system spec",
+	Long: `Resolve the newest remote version satisfying each version range in system-spec.json, then install or upgrade configurations, manager and components in order.
+Packages installed in a version newer than their range are reported as 'out of range' and kept, unless --allow-downgrade is given`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return syncPackages()
+	},
+}
+
+const syncExample = `  # sync packages declared in ~/.costrict/share/system-spec.json
+  smc component sync
+  # show what would be installed or upgraded
+  smc component sync --dry-run
+  # also downgrade packages whose installed version is newer than the range
+  smc component sync --allow-downgrade
+  # sync packages declared in a specified spec file
+  smc component sync --spec ./system-spec.json`
+
+var optSyncSpecFile string
+var optSyncDryRun bool
+var optSyncAllowDowngrade bool
+
+func init() {
+	componentCmd.AddCommand(syncCmd)
+	syncCmd.Flags().SortFlags = false
+	syncCmd.Example = syncExample
+
+	syncCmd.Flags().StringVar(&optSyncSpecFile, "spec", "", "System spec file (default ~/.costrict/share/system-spec.json)")
+	syncCmd.Flags().BoolVar(&optSyncDryRun, "dry-run", false, "Only resolve versions, don't install")
+	syncCmd.Flags().BoolVar(&optSyncAllowDowngrade, "allow-downgrade", false, "Downgrade packages whose installed version is newer than the range")
+}
@@ -1,6 +1,7 @@
 package component
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -25,6 +26,7 @@ func upgradePackage() error {
 	u := utils.NewUpgrader(optUpgradePackageName, utils.UpgradeConfig{
 		BaseUrl:   env.BaseUrl + "/costrict",
 		PublicKey: publicKey,
+		Progress:  true,
 	})
 
 	var newVer *utils.VersionNumber
@@ -37,6 +39,20 @@ func upgradePackage() error {
 		newVer = &ver
 	} else {
 		newVer = nil
+		// 被固定的包不自动升级到最新版本，只检查待办的更新
+		if pinned, err := u.GetPinned(); err == nil {
+			pkg, _, err := u.UpgradePackage(nil)
+			if err != nil {
+				fmt.Printf("The '%s' upgrade failed: %v", optUpgradePackageName, err)
+				return err
+			}
+			fmt.Printf("The '%s' is pinned to %s, run 'smc component unpin %s' to resume upgrades\n",
+				optUpgradePackageName, pinned.VersionId.String(), optUpgradePackageName)
+			if todo, err := u.GetTodo(); err == nil && utils.CompareVersion(todo.VersionId, pkg.VersionId) > 0 {
+				fmt.Printf("Version %s is pending\n", todo.VersionId.String())
+			}
+			return nil
+		}
 	}
 
 	pkg, upgraded, err := u.GetPackage(newVer)
@@ -45,12 +61,21 @@ func upgradePackage() error {
 		return err
 	}
 	if !upgraded {
+		if newVer != nil {
+			// 已经是指定的版本，同样固定该版本，与utils.UpgradePackage一致
+			u.AddPinned(pkg)
+			fmt.Printf("The '%s' is pinned to %s\n", optUpgradePackageName, pkg.VersionId.String())
+			return nil
+		}
 		fmt.Printf("The '%s' version '%s' is up to date\n",
 			optUpgradePackageName, pkg.VersionId.String())
 		return nil
 	}
 	if err := u.ActivatePackage(pkg); err != nil {
-		if optUpgradePackageName == "smc" {
+		if optUpgradePackageName == "smc" && !errors.Is(err, utils.ErrProbeFailed) {
+			if newVer != nil {
+				u.AddPinned(pkg)
+			}
 			// 当package选项未设置时，默认升级smc自身
 			return activateSelf(u, pkg.VersionId)
 		}
@@ -58,6 +83,13 @@ func upgradePackage() error {
 			optUpgradePackageName, pkg.VersionId.String(), err)
 		return err
 	}
+	if newVer == nil {
+		// 升级到最新版本不固定版本，后续仍然自动升级
+		u.RemovePinned()
+	} else {
+		// 升级到指定版本后固定该版本
+		u.AddPinned(pkg)
+	}
 	fmt.Printf("The '%s' is upgraded to version %s\n", optUpgradePackageName, pkg.VersionId.String())
 	return nil
 }
@@ -73,7 +105,7 @@ func SetNewPG(cmd *exec.Cmd) {
 var upgradeCmd = &cobra.Command{
 	Use:   "upgrade {package-name | -p package-name}",
 	Short: "Upgrade package",
-	Long:  `Upgrade package`,
+	Long:  `Upgrade package to the newest version, or to the specified version which is then pinned. A pinned package isn't upgraded to the newest version until it is unpinned`,
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 1 {
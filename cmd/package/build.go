@@ -7,63 +7,192 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/zgsm-ai/smc/internal/utils"
 )
 
+/**
+ *	Parameters to build a package descriptor
+ */
+type packSpec struct {
+	Package     string //Package name
+	From        string //Package file to sign
+	KeyFile     string //Private key file
+	Os          string
+	Arch        string
+	Version     string
+	Type        string //exec/conf/archive
+	FileName    string //File installation name/path
+	Description string
+	Algo        string //Checksum algorithm
+	Probe       string //Health probe arguments
+	Deltas      int    //Generate delta files from the previous N versions
+	Output      string //Output .json file, default package.json beside the package file
+}
+
 /**
  *	Build package descriptor file for executable
  */
-func makePackage() error {
-	size, md5str, err := utils.CalcFileMd5(optFrom)
+func makePackage(spec packSpec) error {
+	//	md5 is only accepted when verifying old packages
+	if spec.Algo != utils.ChecksumSha256 && spec.Algo != utils.ChecksumSha512 {
+		return fmt.Errorf("unsupported checksum algorithm '%s', use sha256 or sha512", spec.Algo)
+	}
+	if spec.Type == string(utils.PackageTypeConf) {
+		if err := checkConf(spec); err != nil {
+			return err
+		}
+	}
+	size, sumstr, err := utils.CalcFileChecksum(spec.From, spec.Algo)
+	if err != nil {
+		return err
+	}
+	priKey, err := os.ReadFile(spec.KeyFile)
 	if err != nil {
 		return err
 	}
-	priKey, err := os.ReadFile(optKeyFile)
+	pubKey, err := utils.PublicKeyOf(priKey)
 	if err != nil {
 		return err
 	}
-	data, err := utils.Sign(priKey, []byte(md5str))
+	keyId, err := utils.KeyIdOf(pubKey)
 	if err != nil {
 		return err
 	}
-	dir, fname := filepath.Split(optFrom)
+	dir, fname := filepath.Split(spec.From)
 
 	pkgData := &utils.PackageVersion{}
-	pkgData.Arch = optArch
-	pkgData.Os = optOs
-	pkgData.PackageName = optPackage
-	pkgData.PackageType = utils.PackageType(optType)
+	pkgData.Arch = spec.Arch
+	pkgData.Os = spec.Os
+	pkgData.PackageName = spec.Package
+	pkgData.PackageType = utils.PackageType(spec.Type)
 	pkgData.FileName = fname
 	pkgData.Size = size
-	pkgData.Checksum = md5str
-	pkgData.ChecksumAlgo = "md5"
-	pkgData.Sign = hex.EncodeToString(data)
-	pkgData.Description = optDescription
-	err = pkgData.VersionId.Parse(optVersion)
+	pkgData.Checksum = sumstr
+	pkgData.ChecksumAlgo = spec.Algo
+	pkgData.KeyId = keyId
+	pkgData.SignScope = utils.SignScopeDescriptor
+	pkgData.Description = spec.Description
+	pkgData.Probe = spec.Probe
+	err = pkgData.VersionId.Parse(spec.Version)
 	if err != nil {
 		return fmt.Errorf("parse version error: %v", err)
 	}
-	if optFileName != "" {
-		pkgData.FileName = optFileName
+	if spec.FileName != "" {
+		pkgData.FileName = spec.FileName
 	}
+	if err := pkgData.Verify(); err != nil {
+		return err
+	}
+	//	Sign the checksum together with the fields deciding how the package is installed and probed
+	data, err := utils.Sign(priKey, pkgData.SignedMessage())
+	if err != nil {
+		return err
+	}
+	pkgData.Sign = hex.EncodeToString(data)
 	bytes, err := json.MarshalIndent(pkgData, "", "  ")
 	if err != nil {
 		return err
 	}
-	outputFname := optOutput
+	outputFname := spec.Output
 	if outputFname == "" {
 		outputFname = filepath.Join(dir, "package.json")
 	}
-	return os.WriteFile(outputFname, bytes, 0666)
+	if err := os.WriteFile(outputFname, bytes, 0666); err != nil {
+		return err
+	}
+	if spec.Deltas > 0 {
+		return makeDeltas(pkgData, spec.From, spec.Deltas)
+	}
+	return nil
+}
+
+/**
+ *	Refuse to sign a configuration file which doesn't match its schema
+ *	The schema is chosen by the installation name, or by the file name if it has no schema
+ */
+func checkConf(spec packSpec) error {
+	schemaName, ok := utils.SchemaFor(spec.FileName)
+	if !ok {
+		schemaName, _ = utils.SchemaFor(spec.From)
+	}
+	errs, err := lintSchema(spec.From, schemaName)
+	if err != nil {
+		return fmt.Errorf("'%s' is invalid: %v", spec.From, err)
+	}
+	if len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Printf("%s: %s: %s\n", spec.From, e.Path, e.Message)
+		}
+		return fmt.Errorf("'%s' doesn't match schema '%s': %d problems, refuse to sign it", spec.From, schemaName, len(errs))
+	}
+	return nil
+}
+
+/**
+ *	Generate delta files from the previous 'count' versions to the package file 'from'
+ *	Previous versions are searched in the sibling directories of the package: <package>/<os>/<arch>/<ver>/
+ *	Delta files are saved as <ver>/deltas/<base-ver>.delta
+ */
+func makeDeltas(pkgData *utils.PackageVersion, from string, count int) error {
+	verDir := filepath.Dir(from)
+	platDir := filepath.Dir(verDir)
+	entries, err := os.ReadDir(platDir)
+	if err != nil {
+		return err
+	}
+	var bases []*utils.PackageVersion
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		base := &utils.PackageVersion{}
+		if err := base.Load(filepath.Join(platDir, e.Name(), "package.json")); err != nil {
+			continue
+		}
+		if base.PackageName != pkgData.PackageName || base.VersionId.String() != e.Name() ||
+			utils.CompareVersion(base.VersionId, pkgData.VersionId) >= 0 {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		return utils.CompareVersion(bases[i].VersionId, bases[j].VersionId) > 0
+	})
+	if len(bases) > count {
+		bases = bases[:count]
+	}
+	deltaDir := filepath.Join(verDir, "deltas")
+	for _, base := range bases {
+		verStr := base.VersionId.String()
+		baseFile := filepath.Join(platDir, verStr, filepath.Base(base.FileName))
+		if err := os.MkdirAll(deltaDir, 0775); err != nil {
+			return err
+		}
+		deltaFile := filepath.Join(deltaDir, verStr+".delta")
+		size, err := utils.MakeDelta(baseFile, from, deltaFile)
+		if err != nil {
+			fmt.Printf("warning: make delta from %s failed: %v\n", verStr, err)
+			os.Remove(deltaFile)
+			continue
+		}
+		if uint64(size) >= pkgData.Size {
+			fmt.Printf("skip delta from %s: %d bytes, not smaller than package\n", verStr, size)
+			os.Remove(deltaFile)
+			continue
+		}
+		fmt.Printf("create %s, %d bytes (package: %d bytes)\n", deltaFile, size, pkgData.Size)
+	}
+	return nil
 }
 
 // packageBuildCmd represents the 'smc package build' command
 var packageBuildCmd = &cobra.Command{
 	Use:   "build {package | --package package}",
 	Short: "Generate package descriptor file",
-	Long:  `Signs a file and generates package.json`,
+	Long:  `Signs a file and generates package.json. A conf file is validated against its embedded schema first, see 'smc package lint'`,
 	Args:  cobra.MaximumNArgs(1),
 
 	Run: func(cmd *cobra.Command, args []string) {
@@ -76,7 +205,22 @@ var packageBuildCmd = &cobra.Command{
 			fmt.Println("Error: package name is required (either as positional argument or via -p/--package option)")
 			return
 		}
-		if err := makePackage(); err != nil {
+		err := makePackage(packSpec{
+			Package:     optPackage,
+			From:        optFrom,
+			KeyFile:     optKeyFile,
+			Os:          optOs,
+			Arch:        optArch,
+			Version:     optVersion,
+			Type:        optType,
+			FileName:    optFileName,
+			Description: optDescription,
+			Algo:        optAlgo,
+			Probe:       optProbe,
+			Deltas:      optDeltas,
+			Output:      optOutput,
+		})
+		if err != nil {
 			fmt.Println(err)
 		}
 	},
@@ -92,6 +236,9 @@ var optPackage string
 var optType string
 var optFileName string
 var optDescription string
+var optAlgo string
+var optDeltas int
+var optProbe string
 
 func init() {
 	packageCmd.AddCommand(packageBuildCmd)
@@ -99,17 +246,24 @@ func init() {
 	packageBuildCmd.Example = `  # Sign shenma.exe with private key costrict-private.pem and generate package descriptor package-windows-amd64-1.0.1120.json (using package option)
   smc package build -p shenma -f ./shenma.exe -k costrict-private.pem -s windows -a amd64 -v 1.0.1120
   # Same command but using positional argument for package name
-  smc package build shenma -f ./shenma.exe -k costrict-private.pem -s windows -a amd64 -v 1.0.1120`
+  smc package build shenma -f ./shenma.exe -k costrict-private.pem -s windows -a amd64 -v 1.0.1120
+  # Pack a model directory as archive package, it will be extracted to .costrict/share/models/<ver>/
+  smc package build models -f ./models.tar.gz -k costrict-private.pem -t archive --filename share/models/models.tar.gz -v 1.0.0
+  # Also generate delta files from the previous 3 versions in sibling directories
+  smc package build shenma -f ./shenma/windows/amd64/1.0.1120/shenma.exe -k costrict-private.pem -s windows -a amd64 -v 1.0.1120 --deltas 3`
 	packageBuildCmd.Flags().SortFlags = false
 	packageBuildCmd.Flags().StringVarP(&optPackage, "package", "p", "", "Package name")
 	packageBuildCmd.Flags().StringVarP(&optFrom, "from", "f", "", "Package file to sign")
 	packageBuildCmd.Flags().StringVarP(&optKeyFile, "key", "k", "", "Private key file")
 	packageBuildCmd.Flags().StringVarP(&optOs, "os", "s", runtime.GOOS, "Target operating system")
 	packageBuildCmd.Flags().StringVarP(&optArch, "arch", "a", runtime.GOARCH, "Target hardware architecture")
-	packageBuildCmd.Flags().StringVarP(&optVersion, "version", "v", "1.0.0", "Package version number(semver)")
-	packageBuildCmd.Flags().StringVarP(&optType, "type", "t", "exec", "Package type: exec/conf")
+	packageBuildCmd.Flags().StringVarP(&optVersion, "version", "v", "1.0.0", "Package version number(semver, such as 1.2.0 or 1.2.0-beta.1+sha.abc)")
+	packageBuildCmd.Flags().StringVarP(&optType, "type", "t", "exec", "Package type: exec/conf/archive")
 	packageBuildCmd.Flags().StringVarP(&optFileName, "filename", "", "", "File installation name/path")
 	packageBuildCmd.Flags().StringVarP(&optDescription, "description", "d", "", "Package description")
+	packageBuildCmd.Flags().StringVar(&optAlgo, "algo", utils.ChecksumSha256, "Checksum algorithm for new packages: sha256/sha512")
+	packageBuildCmd.Flags().StringVar(&optProbe, "probe", "", "Health probe arguments run after activation (such as '--version', empty to disable)")
+	packageBuildCmd.Flags().IntVar(&optDeltas, "deltas", 0, "Generate delta files from the previous N versions")
 	packageBuildCmd.Flags().StringVarP(&optOutput, "output", "o", "", "Output .json file")
 	packageBuildCmd.MarkFlagRequired("from")
 	packageBuildCmd.MarkFlagRequired("key")
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/zgsm-ai/smc/internal/utils"
@@ -89,13 +91,27 @@ func addPackage(fpath string) {
 
 /**
  *	Get version info of the newest package
+ *	Pre-release versions are chosen only if there is no release version,
+ *	so that clients which don't understand pre-releases never upgrade to them
+ *	A newest version set explicitly by 'smc package newest/promote' is kept instead (see keepPlatformSettings)
  */
 func getNewest() {
 	for _, pkg := range allPackages.Packages {
 		for _, plat := range pkg.Platforms {
 			var newest *utils.PackageVersion
 			for _, v := range plat.Versions {
-				if newest == nil || utils.CompareVersion(v.VersionId, newest.VersionId) > 0 {
+				if newest == nil {
+					newest = v
+					continue
+				}
+				vPre, newestPre := v.VersionId.IsPreRelease(), newest.VersionId.IsPreRelease()
+				if vPre != newestPre {
+					if newestPre {
+						newest = v
+					}
+					continue
+				}
+				if utils.CompareVersion(v.VersionId, newest.VersionId) > 0 {
 					newest = v
 				}
 			}
@@ -104,15 +120,57 @@ func getNewest() {
 	}
 }
 
+/**
+ *	Keep release channels set by 'smc package newest/promote' and rollout rules set by
+ *	'smc package rollout' in the old platform.json
+ *	The newest version is kept only if it was set explicitly, otherwise re-indexing releases the highest version
+ *	Settings of versions which no longer exist are dropped
+ */
+func keepPlatformSettings(fpath string, plat *utils.PlatformInfo) {
+	old, err := loadPackagesFile(fpath)
+	if err != nil {
+		return
+	}
+	if old.NewestSet {
+		if err := plat.SetChannel(utils.DefaultChannel, old.Newest.VersionId); err != nil {
+			fmt.Printf("warning: newest %s of %s is removed, use %s: %v\n", old.Newest.VersionId.String(),
+				fpath, plat.Newest.VersionId.String(), err)
+		} else {
+			plat.NewestSet = true
+		}
+	}
+	for name, addr := range old.Channels {
+		if err := plat.SetChannel(name, addr.VersionId); err != nil {
+			fmt.Printf("warning: drop channel '%s' of %s: %v\n", name, fpath, err)
+		}
+	}
+	for _, rule := range old.Rollouts {
+		if err := plat.SetRollout(rule); err != nil {
+			fmt.Printf("warning: drop rollout of %s: %v\n", fpath, err)
+		}
+	}
+}
+
 func savePlatform(pkname string, node *PlatformNode) error {
 	plat := getPlatformInfo(pkname, node)
+	fpath := filepath.Join(node.BaseDir, "platform.json")
+	keepPlatformSettings(fpath, &plat)
+	// platforms.json shows the same newest version
+	for _, v := range node.Versions {
+		if utils.CompareVersion(v.VersionId, plat.Newest.VersionId) == 0 {
+			node.Newest = v
+		}
+	}
 
 	data, err := json.MarshalIndent(plat, "", "  ")
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
-	fpath := filepath.Join(node.BaseDir, "platform.json")
+	if data, err = signIndexData(data, fpath, optIndexKey, optIndexExpires); err != nil {
+		fmt.Println(err)
+		return err
+	}
 
 	fmt.Printf("create %s, versions: %d, newest: %s\n", fpath,
 		len(plat.Versions), plat.Newest.VersionId.String())
@@ -136,6 +194,10 @@ func savePlatforms(plats *PackageNode) error {
 		fmt.Println(err)
 		return err
 	}
+	if data, err = signIndexData(data, fpath, optIndexKey, optIndexExpires); err != nil {
+		fmt.Println(err)
+		return err
+	}
 	if err := os.WriteFile(fpath, data, 0666); err != nil {
 		fmt.Println(err)
 		return err
@@ -155,14 +217,51 @@ func getVersionAddr(pkgVer *utils.PackageVersion) utils.VersionAddr {
 	return *ver
 }
 
+/**
+ *	Get delta files of the version, which are generated by 'smc package build --deltas'
+ *	<package>/<os>/<arch>/<ver>/deltas/<base-ver>.delta
+ */
+func getDeltaAddrs(node *PlatformNode, pkgVer *utils.PackageVersion) []utils.DeltaAddr {
+	verStr := pkgVer.VersionId.String()
+	entries, err := os.ReadDir(filepath.Join(node.BaseDir, verStr, "deltas"))
+	if err != nil {
+		return nil
+	}
+	var deltas []utils.DeltaAddr
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".delta") {
+			continue
+		}
+		var base utils.VersionNumber
+		if err := base.Parse(strings.TrimSuffix(name, ".delta")); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		deltas = append(deltas, utils.DeltaAddr{
+			BaseVersion: base,
+			Url: fmt.Sprintf("/%s/%s/%s/%s/deltas/%s",
+				pkgVer.PackageName, pkgVer.Os, pkgVer.Arch, verStr, name),
+			Size: info.Size(),
+		})
+	}
+	return deltas
+}
+
 func getPlatformInfo(pkname string, node *PlatformNode) utils.PlatformInfo {
 	var plat utils.PlatformInfo
 	plat.Arch = node.Arch
 	plat.Os = node.Os
 	plat.PackageName = pkname
 	plat.Newest = getVersionAddr(node.Newest)
+	plat.Newest.Deltas = getDeltaAddrs(node, node.Newest)
 	for _, v := range node.Versions {
-		plat.Versions = append(plat.Versions, getVersionAddr(v))
+		addr := getVersionAddr(v)
+		addr.Deltas = getDeltaAddrs(node, v)
+		plat.Versions = append(plat.Versions, addr)
 	}
 	return plat
 }
@@ -222,6 +321,49 @@ func saveAllPackages() {
 	}
 }
 
+/**
+ *	Sign index file content with private key file keyFile, the index will expire after 'expires'
+ *	If keyFile is empty, the index is written unsigned
+ */
+func signIndexData(data []byte, fpath, keyFile, expires string) ([]byte, error) {
+	if keyFile == "" {
+		fmt.Printf("warning: %s is not signed, clients using strict policy will reject it\n", fpath)
+		return data, nil
+	}
+	priKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	secs, err := utils.Time2Sec(expires)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires '%s': %v", expires, err)
+	}
+	expireTime := time.Now().Add(time.Duration(secs) * time.Second)
+	return utils.SignIndex(priKey, data, utils.NextIndexSerial(fpath), expireTime)
+}
+
+/**
+ *	Sign packages.json (the list of downloadable packages) in place
+ */
+func signPackagesFile(fpath string) error {
+	return signPackagesTo(fpath, fpath)
+}
+
+/**
+ *	Sign packages.json src and write the signed copy to dst, the serial follows the previous dst
+ */
+func signPackagesTo(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if data, err = signIndexData(data, dst, optIndexKey, optIndexExpires); err != nil {
+		return err
+	}
+	fmt.Printf("sign %s\n", dst)
+	return os.WriteFile(dst, data, 0666)
+}
+
 /**
  *	检查 dir 是否是 baseDir 或其子目录
  */
@@ -250,6 +392,7 @@ func startsWithDotDot(path string) bool {
  *	Build {package}/{os}/{arch}/packages.json for each platform
  */
 func makePackages() error {
+	allPackages = PackagesNode{Packages: make(map[string]*PackageNode)}
 	// Traverse all package.json files to build index files
 	optBuildDir := filepath.Join(optBuildDir)
 	filepath.Walk(optBuildDir, func(fpath string, f os.FileInfo, err error) error {
@@ -268,6 +411,9 @@ func makePackages() error {
 	// Get the newest version
 	getNewest()
 	saveAllPackages()
+	if optIndexPackages != "" {
+		return signPackagesFile(optIndexPackages)
+	}
 	return nil
 }
 
@@ -315,7 +461,8 @@ func getPlatformsDir(fpath string) string {
 var indexCmd = &cobra.Command{
 	Use:   "index {build-dir | -b build-dir}",
 	Short: "Generate index files (packages.json/platforms.json/platform.json)",
-	Long:  `Scan directorys and generate index files`,
+	Long: `Scan directorys and generate index files.
+The highest version becomes the newest, unless the newest version was set by 'smc package newest' or 'smc package promote'`,
 
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -330,6 +477,9 @@ var indexCmd = &cobra.Command{
 }
 
 var optBuildDir string
+var optIndexKey string
+var optIndexExpires string
+var optIndexPackages string
 
 func init() {
 	packageCmd.AddCommand(indexCmd)
@@ -337,7 +487,12 @@ func init() {
 	indexCmd.Example = `  # Scan ./build directory and generate index files based on signed packages
   smc package index -b ./build
   # Or specify build directory as argument
-  smc package index ./build`
+  smc package index ./build
+  # Sign index files with release key, and sign packages.json too
+  smc package index ./build -k costrict-private.pem --expires 30d --packages ./build/packages.json`
 	indexCmd.Flags().SortFlags = false
 	indexCmd.Flags().StringVarP(&optBuildDir, "build", "b", ".", "Build directory: location of package files")
+	indexCmd.Flags().StringVarP(&optIndexKey, "key", "k", "", "Private key file used to sign index files")
+	indexCmd.Flags().StringVarP(&optIndexExpires, "expires", "e", "90d", "Validity period of signed index files (s/m/h/d)")
+	indexCmd.Flags().StringVar(&optIndexPackages, "packages", "", "packages.json file to sign as well")
 }
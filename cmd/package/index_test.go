@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+// TestIndexNewest checks re-indexing releases a higher version, unless the newest version was set explicitly
+func TestIndexNewest(t *testing.T) {
+	buildDir := t.TempDir()
+	platDir := filepath.Join(buildDir, "app", "linux", "amd64")
+	addVersion := func(ver string) {
+		pkg := utils.PackageVersion{PackageName: "app", PackageType: utils.PackageTypeExec, FileName: "app",
+			Os: "linux", Arch: "amd64"}
+		pkg.VersionId.Parse(ver)
+		os.MkdirAll(filepath.Join(platDir, ver), 0775)
+		pkg.Save(filepath.Join(platDir, ver, "package.json"))
+	}
+	index := func() *utils.PlatformInfo {
+		optBuildDir, optIndexKey, optIndexPackages = buildDir, "", ""
+		if err := makePackages(); err != nil {
+			t.Fatal(err)
+		}
+		plat, err := loadPackagesFile(filepath.Join(platDir, "platform.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plat
+	}
+	overview := func() string {
+		var ov utils.PackageOverview
+		data, _ := os.ReadFile(filepath.Join(buildDir, "app", "platforms.json"))
+		json.Unmarshal(data, &ov)
+		newest := ov.Overviews["linux-amd64"].Newest.VersionId
+		return newest.String()
+	}
+
+	addVersion("1.0.0")
+	index()
+	addVersion("1.1.0")
+	if plat := index(); plat.Newest.VersionId.String() != "1.1.0" || plat.NewestSet || overview() != "1.1.0" {
+		t.Fatalf("newest after indexing 1.1.0 = %s (set: %v), platforms.json %s",
+			plat.Newest.VersionId.String(), plat.NewestSet, overview())
+	}
+
+	// 'smc package newest' holds the release back at 1.0.0
+	plat, _ := loadPackagesFile(filepath.Join(platDir, "platform.json"))
+	if err := setNewest(plat, utils.DefaultChannel, "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	savePackagesFile(filepath.Join(platDir, "platform.json"), plat, "", "")
+	addVersion("1.2.0")
+	if plat := index(); plat.Newest.VersionId.String() != "1.0.0" || !plat.NewestSet || overview() != "1.0.0" {
+		t.Errorf("explicit newest after indexing 1.2.0 = %s (set: %v), platforms.json %s",
+			plat.Newest.VersionId.String(), plat.NewestSet, overview())
+	}
+
+	// The explicit newest is removed, the highest version is released again
+	os.RemoveAll(filepath.Join(platDir, "1.0.0"))
+	if plat := index(); plat.Newest.VersionId.String() != "1.2.0" || plat.NewestSet {
+		t.Errorf("newest after removing 1.0.0 = %s (set: %v)", plat.Newest.VersionId.String(), plat.NewestSet)
+	}
+}
@@ -0,0 +1,281 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in lint report
+ */
+type Lint_Columns struct {
+	File    string `json:"file"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+/**
+ *	Validate a configuration file against the embedded schema for its name
+ *	Files without a schema are only checked to be valid JSON
+ */
+func lintSchema(fname string, schemaName string) ([]utils.SchemaError, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return lintData(fname, data, schemaName)
+}
+
+/**
+ *	Validate configuration data named fname, see lintSchema
+ */
+func lintData(fname string, data []byte, schemaName string) ([]utils.SchemaError, error) {
+	if schemaName == "" {
+		name, ok := utils.SchemaFor(fname)
+		if !ok {
+			if filepath.Ext(fname) == ".json" && !json.Valid(data) {
+				var v interface{}
+				return nil, fmt.Errorf("invalid JSON: %v", json.Unmarshal(data, &v))
+			}
+			return nil, nil
+		}
+		schemaName = name
+	}
+	return utils.ValidateConfig(schemaName, data)
+}
+
+/**
+ *	Find packages.json in the directory of fname or its parents
+ */
+func findPackagesFile(fname string) string {
+	dir, err := filepath.Abs(filepath.Dir(fname))
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, "packages.json")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+/**
+ *	Cross-check packages and services referenced by system-spec.json against packages.json
+ */
+func crossCheckSpec(data []byte, cfg *PublishConfig) []utils.SchemaError {
+	spec := &utils.SystemSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil // already reported by schema validation
+	}
+	var errs []utils.SchemaError
+	types := make(map[string]string)
+	for _, b := range cfg.Builds {
+		types[b.Name] = b.Type
+		if types[b.Name] == "" {
+			types[b.Name] = string(utils.PackageTypeExec)
+		}
+	}
+	check := func(path string, c utils.ComponentSpec, kind utils.PackageType) {
+		if !slices.Contains(cfg.Packages, c.Name) {
+			errs = append(errs, utils.SchemaError{Path: path, Message: fmt.Sprintf("package '%s' doesn't exist in packages.json", c.Name)})
+		} else if t, ok := types[c.Name]; ok && t != string(kind) {
+			errs = append(errs, utils.SchemaError{Path: path, Message: fmt.Sprintf("package '%s' is built as %s, not %s", c.Name, t, kind)})
+		}
+	}
+	executables := make(map[string]bool)
+	if spec.Manager.Component.Name != "" {
+		check("$.manager.component", spec.Manager.Component, utils.PackageTypeExec)
+		executables[spec.Manager.Component.Name] = true
+	}
+	for i, c := range spec.Components {
+		check(fmt.Sprintf("$.components[%d]", i), c, utils.PackageTypeExec)
+		executables[c.Name] = true
+	}
+	for i, c := range spec.Configurations {
+		check(fmt.Sprintf("$.configurations[%d]", i), c, utils.PackageTypeConf)
+	}
+	services := spec.Services
+	paths := make([]string, 0, len(services)+1)
+	for i := range services {
+		paths = append(paths, fmt.Sprintf("$.services[%d]", i))
+	}
+	if spec.Manager.Service.Name != "" {
+		services = append(services, spec.Manager.Service)
+		paths = append(paths, "$.manager.service")
+	}
+	seen := make(map[string]bool)
+	for i, s := range services {
+		if seen[s.Name] {
+			errs = append(errs, utils.SchemaError{Path: paths[i], Message: fmt.Sprintf("service '%s' is declared more than once", s.Name)})
+		}
+		seen[s.Name] = true
+		if !executables[s.Name] {
+			errs = append(errs, utils.SchemaError{Path: paths[i], Message: fmt.Sprintf("service '%s' isn't a declared component", s.Name)})
+		}
+	}
+	return errs
+}
+
+/**
+ *	A configuration to lint: a file, or the layers rendered for a platform
+ */
+type lintTarget struct {
+	Name   string
+	Layers []string
+}
+
+/**
+ *	Configurations built from packages.json: conf targets rendered for every platform,
+ *	platforms with the same layers are linted once
+ */
+func confTargets(buildDir string, cfg *PublishConfig) []lintTarget {
+	var targets []lintTarget
+	seen := make(map[string]bool)
+	for _, b := range cfg.Builds {
+		if b.Type != string(utils.PackageTypeConf) || b.Path == "" || b.Target == "" {
+			continue
+		}
+		for _, p := range publishPlatforms {
+			osName, arch, _ := strings.Cut(p, "/")
+			layers, err := confLayers(filepath.Join(buildDir, b.Path), b.Target, osName, arch)
+			if err != nil {
+				continue
+			}
+			name := strings.Join(layers, " + ")
+			if !seen[name] {
+				seen[name] = true
+				targets = append(targets, lintTarget{Name: name, Layers: layers})
+			}
+		}
+	}
+	return targets
+}
+
+func fileExists(fname string) bool {
+	info, err := os.Stat(fname)
+	return err == nil && !info.IsDir()
+}
+
+func loadPublishConfig(fname string) (*PublishConfig, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &PublishConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", fname, err)
+	}
+	return cfg, nil
+}
+
+func lintFiles(files []string) error {
+	cfgFile := optLintConfig
+	var targets []lintTarget
+	if len(files) == 0 {
+		if cfgFile == "" {
+			cfgFile = filepath.Join(optLintBuildDir, "packages.json")
+		}
+		cfg, err := loadPublishConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		targets = confTargets(optLintBuildDir, cfg)
+	}
+	for _, fname := range files {
+		targets = append(targets, lintTarget{Name: fname, Layers: []string{fname}})
+	}
+	var dataList []*orderedmap.OrderedMap
+	report := func(fname string, e utils.SchemaError) {
+		recordMap, _ := utils.StructToOrderedMap(Lint_Columns{File: fname, Path: e.Path, Message: e.Message})
+		dataList = append(dataList, recordMap)
+	}
+	for _, target := range targets {
+		fname := target.Name
+		data, err := renderLayers(target.Layers)
+		var errs []utils.SchemaError
+		if err == nil {
+			schemaName := optLintSchema
+			if schemaName == "" {
+				schemaName, _ = utils.SchemaFor(target.Layers[0])
+			}
+			errs, err = lintData(target.Layers[0], data, schemaName)
+		}
+		if err != nil {
+			report(fname, utils.SchemaError{Path: "$", Message: err.Error()})
+			continue
+		}
+		for _, e := range errs {
+			report(fname, e)
+		}
+		if name, _ := utils.SchemaFor(target.Layers[0]); name != "system-spec" && optLintSchema != "system-spec" {
+			continue
+		}
+		pkgsFile := cfgFile
+		if pkgsFile == "" {
+			pkgsFile = findPackagesFile(target.Layers[0])
+		}
+		if pkgsFile == "" {
+			fmt.Printf("warning: packages.json isn't found, skip cross-checking %s\n", fname)
+			continue
+		}
+		cfg, err := loadPublishConfig(pkgsFile)
+		if err != nil {
+			return err
+		}
+		for _, e := range crossCheckSpec(data, cfg) {
+			report(fname, e)
+		}
+	}
+	if len(dataList) > 0 {
+		utils.PrintFormat(dataList)
+	}
+	fmt.Printf("%d files checked, %d problems\n", len(targets), len(dataList))
+	if len(dataList) > 0 {
+		return fmt.Errorf("lint failed: %d problems", len(dataList))
+	}
+	return nil
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [file...]",
+	Short: "Validate configuration files",
+	Long: fmt.Sprintf(`Validate configuration files against the embedded JSON schemas (%v), chosen by file name.
+system-spec.json is also cross-checked against packages.json: every referenced component and configuration must be
+a known package of the right type, and every service must be a declared component.
+Without files, lint every conf target listed in {build}/packages.json as rendered for each platform, see 'smc package render'`, utils.SchemaNames()),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return lintFiles(args)
+	},
+}
+
+var optLintBuildDir string
+var optLintConfig string
+var optLintSchema string
+
+func init() {
+	packageCmd.AddCommand(lintCmd)
+
+	lintCmd.Example = `  # Lint all configuration packages declared in ./build/packages.json
+  smc package lint -b ./build
+  # Lint one file, with a schema other than the one matching its name
+  smc package lint ./my-spec.json --schema system-spec`
+	lintCmd.SilenceUsage = true
+	lintCmd.Flags().SortFlags = false
+	lintCmd.Flags().StringVarP(&optLintBuildDir, "build", "b", ".", "Build directory: location of packages.json")
+	lintCmd.Flags().StringVarP(&optLintConfig, "config", "c", "", "packages.json used to cross-check system-spec.json (default the nearest one)")
+	lintCmd.Flags().StringVar(&optLintSchema, "schema", "", "Schema to validate with (default chosen by file name)")
+}
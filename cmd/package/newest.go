@@ -10,22 +10,21 @@ import (
 )
 
 /**
- *	Set the latest version
+ *	Set the latest version of the channel, the 'stable' channel is the newest version
  */
-func setNewest(packages *utils.PlatformInfo, ver string) error {
+func setNewest(packages *utils.PlatformInfo, channel, ver string) error {
 	var verId utils.VersionNumber
 	err := verId.Parse(ver)
 	if err != nil {
 		return err
 	}
-	for _, v := range packages.Versions {
-		if utils.CompareVersion(v.VersionId, verId) != 0 {
-			continue
-		}
-		packages.Newest = v
-		return nil
+	if err := packages.SetChannel(channel, verId); err != nil {
+		return err
+	}
+	if channel == utils.DefaultChannel {
+		packages.NewestSet = true
 	}
-	return fmt.Errorf("version '%s' not exist", ver)
+	return nil
 }
 
 /**
@@ -44,13 +43,18 @@ func loadPackagesFile(fname string) (*utils.PlatformInfo, error) {
 }
 
 /**
- *	Save package list file
+ *	Save package list file, re-signed with private key file keyFile
  */
-func savePackagesFile(fname string, packages *utils.PlatformInfo) error {
+func savePackagesFile(fname string, packages *utils.PlatformInfo, keyFile, expires string) error {
+	// The content changes, so the old signature is invalid and must be re-signed
+	packages.IndexMeta = utils.IndexMeta{}
 	data, err := json.MarshalIndent(packages, "", "  ")
 	if err != nil {
 		return err
 	}
+	if data, err = signIndexData(data, fname, keyFile, expires); err != nil {
+		return err
+	}
 	if err = os.WriteFile(fname, data, 0664); err != nil {
 		return err
 	}
@@ -65,10 +69,10 @@ func editPackages() error {
 	if err != nil {
 		return err
 	}
-	if err = setNewest(packages, optNewestVer); err != nil {
+	if err = setNewest(packages, optNewestChannel, optNewestVer); err != nil {
 		return err
 	}
-	if err = savePackagesFile(optPackagesFile, packages); err != nil {
+	if err = savePackagesFile(optPackagesFile, packages, optNewestKey, optNewestExpires); err != nil {
 		return err
 	}
 	return nil
@@ -77,7 +81,7 @@ func editPackages() error {
 var newestCmd = &cobra.Command{
 	Use:   "newest {packages | -p packages} -v version",
 	Short: "Modify the newest version setting in package list file",
-	Long:  `Modifies the newest version setting in package list file, 'smc package upgrade' command will update to this version by default`,
+	Long:  `Modifies the newest version of a release channel in package list file, 'smc package upgrade' command will update to the newest version of the subscribed channel by default`,
 	Args:  cobra.MaximumNArgs(1),
 
 	Run: func(cmd *cobra.Command, args []string) {
@@ -92,14 +96,24 @@ var newestCmd = &cobra.Command{
 
 var optPackagesFile string
 var optNewestVer string
+var optNewestChannel string
+var optNewestKey string
+var optNewestExpires string
 
 func init() {
 	packageCmd.AddCommand(newestCmd)
 
 	newestCmd.Example = `  # Modify latest version in build/packages-windows-amd64.json to 1.2.1213
   # Setting latest version allows publishing test packages without affecting users, unless user specifies version during update
-  smc package newest build/packages-windows-amd64.json -v 1.2.1213`
+  smc package newest build/packages-windows-amd64.json -v 1.2.1213
+  # Modify latest version and re-sign the index file
+  smc package newest shenma/windows/amd64/platform.json -n 1.2.1213 -k costrict-private.pem
+  # Publish a test version to the beta channel only
+  smc package newest shenma/windows/amd64/platform.json -n 1.3.0-beta.1 -c beta -k costrict-private.pem`
 	newestCmd.Flags().SortFlags = false
 	newestCmd.Flags().StringVarP(&optPackagesFile, "packages", "p", "", "package list file")
 	newestCmd.Flags().StringVarP(&optNewestVer, "version", "n", "", "Default latest version for user updates")
+	newestCmd.Flags().StringVarP(&optNewestChannel, "channel", "c", utils.DefaultChannel, "Release channel whose newest version is modified")
+	newestCmd.Flags().StringVarP(&optNewestKey, "key", "k", "", "Private key file used to re-sign the index file")
+	newestCmd.Flags().StringVarP(&optNewestExpires, "expires", "e", "90d", "Validity period of the signed index file (s/m/h/d)")
 }
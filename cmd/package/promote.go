@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Promote the newest version of channel 'from' to channel 'to' in one platform.json
+ *	Returns the promoted version
+ */
+func promotePlatform(fpath string) (utils.VersionNumber, error) {
+	plat, err := loadPackagesFile(fpath)
+	if err != nil {
+		return utils.VersionNumber{}, err
+	}
+	from, ok := plat.GetChannel(optPromoteFrom)
+	if !ok {
+		return utils.VersionNumber{}, fmt.Errorf("channel '%s' not exist", optPromoteFrom)
+	}
+	if optPromoteVer != "" {
+		var ver utils.VersionNumber
+		if err := ver.Parse(optPromoteVer); err != nil {
+			return ver, err
+		}
+		if utils.CompareVersion(ver, from.VersionId) != 0 {
+			return ver, fmt.Errorf("version %s isn't the newest version of channel '%s' (%s)",
+				ver.String(), optPromoteFrom, from.VersionId.String())
+		}
+	}
+	old, _ := plat.GetChannel(optPromoteTo)
+	if err := plat.SetChannel(optPromoteTo, from.VersionId); err != nil {
+		return from.VersionId, err
+	}
+	if optPromoteTo == utils.DefaultChannel {
+		plat.NewestSet = true
+	}
+	if err := savePackagesFile(fpath, plat, optPromoteKey, optPromoteExpires); err != nil {
+		return from.VersionId, err
+	}
+	oldVer := "-"
+	if old.InfoUrl != "" {
+		oldVer = old.VersionId.String()
+	}
+	fmt.Printf("promote %s/%s: %s -> %s (%s: %s => %s)\n", plat.Os, plat.Arch,
+		optPromoteFrom, optPromoteTo, optPromoteTo, oldVer, from.VersionId.String())
+	return from.VersionId, nil
+}
+
+/**
+ *	Update the newest version of the platform in platforms.json after promoting to 'stable'
+ */
+func promoteOverview(platsDir string, platDir string, ver utils.VersionNumber) error {
+	fpath := filepath.Join(platsDir, "platforms.json")
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	var ov utils.PackageOverview
+	if err = json.Unmarshal(data, &ov); err != nil {
+		return err
+	}
+	var pkgVer utils.PackageVersion
+	if err = pkgVer.Load(filepath.Join(platDir, ver.String(), "package.json")); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s-%s", pkgVer.Os, pkgVer.Arch)
+	platOv, ok := ov.Overviews[key]
+	if !ok {
+		return fmt.Errorf("platform '%s' not exist in %s", key, fpath)
+	}
+	platOv.Newest = getVersionOverview(&pkgVer)
+	ov.Overviews[key] = platOv
+
+	ov.IndexMeta = utils.IndexMeta{}
+	if data, err = json.MarshalIndent(ov, "", "  "); err != nil {
+		return err
+	}
+	if data, err = signIndexData(data, fpath, optPromoteKey, optPromoteExpires); err != nil {
+		return err
+	}
+	return os.WriteFile(fpath, data, 0666)
+}
+
+/**
+ *	Find platform.json files of the package in build directory, os/arch may be '*'
+ */
+func findPlatformFiles(buildDir, pkgName, osName, arch string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(buildDir, pkgName, osName, arch, "platform.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no platform.json of package '%s' found in '%s'", pkgName, buildDir)
+	}
+	return files, nil
+}
+
+/**
+ *	Promote a version of the package between channels on all (or specified) platforms
+ */
+func promotePackage(pkgName string) error {
+	if err := utils.CheckChannel(optPromoteTo); err != nil {
+		return err
+	}
+	if optPromoteFrom == optPromoteTo {
+		return fmt.Errorf("source and target channel are both '%s'", optPromoteTo)
+	}
+	platsDir := filepath.Join(optPromoteBuildDir, pkgName)
+	files, err := findPlatformFiles(optPromoteBuildDir, pkgName, optPromoteOs, optPromoteArch)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, fpath := range files {
+		ver, err := promotePlatform(fpath)
+		if err == nil && optPromoteTo == utils.DefaultChannel {
+			err = promoteOverview(platsDir, filepath.Dir(fpath), ver)
+		}
+		if err != nil {
+			fmt.Printf("error: promote %s failed: %v\n", fpath, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d platforms failed to promote", failed)
+	}
+	return nil
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote {package} --from channel --to channel [-v version]",
+	Short: "Promote the newest version of a release channel to another channel",
+	Long:  `Set the newest version of the target channel to the newest version of the source channel in platform.json of each platform, and re-sign the index files`,
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := promotePackage(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var optPromoteBuildDir string
+var optPromoteFrom string
+var optPromoteTo string
+var optPromoteVer string
+var optPromoteOs string
+var optPromoteArch string
+var optPromoteKey string
+var optPromoteExpires string
+
+func init() {
+	packageCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Example = `  # Release the beta version 1.3.0 of costrict to all users on all platforms
+  smc package promote costrict --from beta --to stable -v 1.3.0 -b ./build -k costrict-private.pem
+  # Promote the nightly build to the beta channel on linux/amd64 only
+  smc package promote costrict --from nightly --to beta --os linux --arch amd64 -k costrict-private.pem`
+	promoteCmd.Flags().SortFlags = false
+	promoteCmd.Flags().StringVarP(&optPromoteBuildDir, "build", "b", ".", "Build directory: location of package files")
+	promoteCmd.Flags().StringVar(&optPromoteFrom, "from", "beta", "Source channel")
+	promoteCmd.Flags().StringVar(&optPromoteTo, "to", utils.DefaultChannel, "Target channel")
+	promoteCmd.Flags().StringVarP(&optPromoteVer, "version", "v", "", "Expected newest version of the source channel, promote nothing if it doesn't match")
+	promoteCmd.Flags().StringVar(&optPromoteOs, "os", "*", "Only promote the platform with this operating system")
+	promoteCmd.Flags().StringVar(&optPromoteArch, "arch", "*", "Only promote the platform with this architecture")
+	promoteCmd.Flags().StringVarP(&optPromoteKey, "key", "k", "", "Private key file used to re-sign the index files")
+	promoteCmd.Flags().StringVarP(&optPromoteExpires, "expires", "e", "90d", "Validity period of the signed index files (s/m/h/d)")
+}
@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in prune report
+ */
+type Prune_Columns struct {
+	Package  string `json:"package"`
+	Platform string `json:"platform"`
+	Version  string `json:"version"`
+	Age      string `json:"age"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+}
+
+/**
+ *	A version directory in the build directory
+ */
+type pruneVersion struct {
+	Dir     string
+	Version utils.VersionNumber
+	Time    time.Time //Time the version was built (modification time of package.json)
+	Reasons []string  //Why the version is kept, removed if empty
+}
+
+func (v *pruneVersion) keep(reason string) {
+	if !slices.Contains(v.Reasons, reason) {
+		v.Reasons = append(v.Reasons, reason)
+	}
+}
+
+/**
+ *	Collect reasons why versions of a platform must be kept:
+ *	the newest version, versions referenced by channels or rollouts, and versions clients fall back to from a rollout
+ */
+func protectVersions(platDir string, vers []*pruneVersion) {
+	protect := func(ver utils.VersionNumber, reason string) {
+		for _, v := range vers {
+			if utils.CompareVersion(v.Version, ver) == 0 {
+				v.keep(reason)
+			}
+		}
+	}
+	// The highest stable version becomes the newest when platform.json is rebuilt from scratch
+	for _, v := range vers {
+		if !v.Version.IsPreRelease() {
+			v.keep("newest")
+			break
+		}
+	}
+	plat, err := loadPackagesFile(filepath.Join(platDir, "platform.json"))
+	if err != nil {
+		return
+	}
+	if plat.Newest.InfoUrl != "" {
+		protect(plat.Newest.VersionId, "newest")
+	}
+	for name, addr := range plat.Channels {
+		protect(addr.VersionId, "channel:"+name)
+	}
+	for _, rule := range plat.Rollouts {
+		protect(rule.VersionId, "rollout")
+		// Machines out of the rollout get the fallback version, the same choice as clients make
+		if addr, ok := plat.RolloutFallback(rule.VersionId); ok {
+			protect(addr.VersionId, "rollout-fallback")
+		}
+	}
+}
+
+/**
+ *	Load versions of a platform directory, sorted from the newest
+ */
+func loadPruneVersions(platDir string) ([]*pruneVersion, error) {
+	entries, err := os.ReadDir(platDir)
+	if err != nil {
+		return nil, err
+	}
+	var vers []*pruneVersion
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		fpath := filepath.Join(platDir, e.Name(), "package.json")
+		var pkgVer utils.PackageVersion
+		if err := pkgVer.Load(fpath); err != nil || pkgVer.VersionId.String() != e.Name() {
+			continue
+		}
+		info, err := os.Stat(fpath)
+		if err != nil {
+			continue
+		}
+		vers = append(vers, &pruneVersion{
+			Dir:     filepath.Join(platDir, e.Name()),
+			Version: pkgVer.VersionId,
+			Time:    info.ModTime(),
+		})
+	}
+	sort.Slice(vers, func(i, j int) bool {
+		return utils.CompareVersion(vers[i].Version, vers[j].Version) > 0
+	})
+	return vers, nil
+}
+
+/**
+ *	Apply retention policies to versions of a platform
+ */
+func retainVersions(platDir string, vers []*pruneVersion, keep int, keepDays int) {
+	protectVersions(platDir, vers)
+	for i, v := range vers {
+		if i < keep {
+			v.keep(fmt.Sprintf("last-%d", keep))
+		}
+		if keepDays > 0 && time.Since(v.Time) < time.Duration(keepDays)*24*time.Hour {
+			v.keep(fmt.Sprintf("within-%dd", keepDays))
+		}
+	}
+}
+
+/**
+ *	Check that the index files can be regenerated before removing anything:
+ *	the key file must be a valid private key, and signed index files must not be replaced by unsigned ones
+ */
+func checkPruneKey(buildDir, keyFile, expires string) error {
+	if keyFile != "" {
+		priKey, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		if _, err := utils.PublicKeyOf(priKey); err != nil {
+			return fmt.Errorf("invalid private key '%s': %v", keyFile, err)
+		}
+		if _, err := utils.Time2Sec(expires); err != nil {
+			return fmt.Errorf("invalid expires '%s': %v", expires, err)
+		}
+		return nil
+	}
+	files, _ := filepath.Glob(filepath.Join(buildDir, "*", "*", "*", "platform.json"))
+	for _, f := range files {
+		if plat, err := loadPackagesFile(f); err == nil && plat.Signature != "" {
+			return fmt.Errorf("%s is signed, re-indexing needs the private key (-k)", f)
+		}
+	}
+	return nil
+}
+
+/**
+ *	Remove versions of packages in the build directory which aren't kept by retention policies
+ */
+func prunePackages(names []string) error {
+	if optPruneKeep < 1 {
+		return fmt.Errorf("--keep must be at least 1")
+	}
+	if len(names) == 0 {
+		names = []string{"*"}
+	}
+	var platDirs []string
+	for _, name := range names {
+		files, err := findPlatformFiles(optPruneBuildDir, name, optPruneOs, optPruneArch)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			platDirs = append(platDirs, filepath.Dir(f))
+		}
+	}
+	var dataList []*orderedmap.OrderedMap
+	var removes []string
+	for _, platDir := range platDirs {
+		vers, err := loadPruneVersions(platDir)
+		if err != nil {
+			return err
+		}
+		retainVersions(platDir, vers, optPruneKeep, optPruneKeepDays)
+		rel, _ := filepath.Rel(optPruneBuildDir, platDir)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for _, v := range vers {
+			row := Prune_Columns{
+				Package:  parts[0],
+				Platform: strings.Join(parts[1:], "/"),
+				Version:  v.Version.String(),
+				Age:      fmt.Sprintf("%dd", int(time.Since(v.Time).Hours()/24)),
+				Action:   "keep",
+				Reason:   strings.Join(v.Reasons, ","),
+			}
+			if len(v.Reasons) == 0 {
+				row.Action = "remove"
+				removes = append(removes, v.Dir)
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+	}
+	if len(dataList) > 0 {
+		utils.PrintFormat(dataList)
+	}
+	if optPruneDryRun {
+		fmt.Printf("%d versions would be removed\n", len(removes))
+		return nil
+	}
+	if len(removes) == 0 {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+	if err := checkPruneKey(optPruneBuildDir, optPruneKey, optPruneExpires); err != nil {
+		return err
+	}
+	for _, dir := range removes {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		fmt.Printf("remove %s\n", dir)
+	}
+	// Versions removed from the tree must disappear from the index files as well
+	optBuildDir = optPruneBuildDir
+	optIndexKey = optPruneKey
+	optIndexExpires = optPruneExpires
+	optIndexPackages = ""
+	return makePackages()
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [package...]",
+	Short: "Remove old versions from the build directory by retention policies",
+	Long: `Remove version directories which aren't kept by any retention policy, then regenerate index files.
+A version is kept if it is one of the last N versions of its platform, is built within the last D days,
+is the newest version, is referenced by a release channel or a rollout, or is the version clients fall back to from a rollout`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := prunePackages(args); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var optPruneBuildDir string
+var optPruneOs string
+var optPruneArch string
+var optPruneKeep int
+var optPruneKeepDays int
+var optPruneKey string
+var optPruneExpires string
+var optPruneDryRun bool
+
+func init() {
+	packageCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Example = `  # Show which versions of all packages would be removed, keeping the last 5 versions of each platform
+  smc package prune -b ./build --keep 5 --dry-run
+  # Remove versions of costrict older than 30 days except the last 3, and re-sign the index files
+  smc package prune costrict -b ./build --keep 3 --keep-days 30 -k costrict-private.pem`
+	pruneCmd.Flags().SortFlags = false
+	pruneCmd.Flags().StringVarP(&optPruneBuildDir, "build", "b", ".", "Build directory: location of package files")
+	pruneCmd.Flags().StringVar(&optPruneOs, "os", "*", "Only prune the platform with this operating system")
+	pruneCmd.Flags().StringVar(&optPruneArch, "arch", "*", "Only prune the platform with this architecture")
+	pruneCmd.Flags().IntVar(&optPruneKeep, "keep", 3, "Keep the last N versions of each platform")
+	pruneCmd.Flags().IntVar(&optPruneKeepDays, "keep-days", 0, "Keep versions built within the last N days")
+	pruneCmd.Flags().StringVarP(&optPruneKey, "key", "k", "", "Private key file used to re-sign the index files")
+	pruneCmd.Flags().StringVarP(&optPruneExpires, "expires", "e", "90d", "Validity period of the signed index files (s/m/h/d)")
+	pruneCmd.Flags().BoolVar(&optPruneDryRun, "dry-run", false, "Only show which versions would be removed")
+}
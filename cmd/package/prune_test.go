@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+// TestRetainVersions checks keep-N, keep-days, and protection of the newest, channel and rollout versions
+func TestRetainVersions(t *testing.T) {
+	platDir := t.TempDir()
+	names := []string{"1.7.0-beta.1", "1.6.0", "1.5.0", "1.4.0", "1.3.0", "1.2.0", "1.1.0", "1.0.0"}
+	var vers []*pruneVersion
+	addrs := make(map[string]utils.VersionAddr)
+	plat := utils.PlatformInfo{PackageName: "app", Os: "linux", Arch: "amd64"}
+	for i, name := range names {
+		v := &pruneVersion{Dir: filepath.Join(platDir, name), Time: time.Now().Add(-time.Duration(i)*24*time.Hour - time.Hour)}
+		v.Version.Parse(name)
+		vers = append(vers, v)
+		addrs[name] = utils.VersionAddr{VersionId: v.Version, InfoUrl: "/app/linux/amd64/" + name + "/package.json"}
+		plat.Versions = append(plat.Versions, addrs[name])
+	}
+	plat.Newest = addrs["1.2.0"]
+	plat.Channels = map[string]utils.VersionAddr{"beta": addrs["1.7.0-beta.1"]}
+	fallback := addrs["1.2.0"].VersionId
+	plat.Rollouts = []utils.RolloutRule{{VersionId: addrs["1.6.0"].VersionId, Percentage: 10, Fallback: &fallback}}
+	data, _ := json.Marshal(plat)
+	os.WriteFile(filepath.Join(platDir, "platform.json"), data, 0644)
+
+	retainVersions(platDir, vers, 1, 3)
+	want := map[string][]string{
+		"1.7.0-beta.1": {"channel:beta", "last-1", "within-3d"},
+		"1.6.0":        {"newest", "rollout", "within-3d"},
+		"1.5.0":        {"within-3d"},
+		"1.2.0":        {"newest", "rollout-fallback"},
+	}
+	for _, v := range vers {
+		got := slices.Clone(v.Reasons)
+		slices.Sort(got)
+		if !slices.Equal(got, want[v.Version.String()]) {
+			t.Errorf("reasons of %s = %v, want %v", v.Version.String(), got, want[v.Version.String()])
+		}
+	}
+}
+
+// TestCheckPruneKey checks a signed repository can't be re-indexed without a valid key
+func TestCheckPruneKey(t *testing.T) {
+	buildDir := t.TempDir()
+	platDir := filepath.Join(buildDir, "app", "linux", "amd64")
+	os.MkdirAll(platDir, 0775)
+	_, priKey, _ := utils.GenKeys(utils.KeyTypeEd25519)
+	keyFile := filepath.Join(buildDir, "private.pem")
+	os.WriteFile(keyFile, priKey, 0600)
+	data, _ := json.Marshal(utils.PlatformInfo{PackageName: "app", Os: "linux", Arch: "amd64"})
+	os.WriteFile(filepath.Join(platDir, "platform.json"), data, 0644)
+	if err := checkPruneKey(buildDir, "", "90d"); err != nil {
+		t.Errorf("unsigned repository without key rejected: %v", err)
+	}
+	data, _ = utils.SignIndex(priKey, data, 1, time.Now().Add(time.Hour))
+	os.WriteFile(filepath.Join(platDir, "platform.json"), data, 0644)
+
+	if err := checkPruneKey(buildDir, "", "90d"); err == nil {
+		t.Error("signed repository accepted without key")
+	}
+	if err := checkPruneKey(buildDir, filepath.Join(buildDir, "missing.pem"), "90d"); err == nil {
+		t.Error("missing key file accepted")
+	}
+	if err := checkPruneKey(buildDir, keyFile, "90d"); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+}
@@ -0,0 +1,460 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	An entry of 'builds' in packages.json
+ */
+type BuildSpec struct {
+	Name        string `json:"name"`
+	Path        string `json:"path,omitempty"`     //Source directory, relative to the build directory
+	Version     string `json:"version"`            //Version to publish
+	Type        string `json:"type,omitempty"`     //exec/conf/archive, default exec
+	Target      string `json:"target,omitempty"`   //conf/archive: file copied from {path}/{os}/{arch} or {path}/common
+	FileName    string `json:"filename,omitempty"` //File installation name/path
+	Description string `json:"description,omitempty"`
+	Probe       string `json:"probe,omitempty"`
+}
+
+/**
+ *	packages.json in the build directory
+ */
+type PublishConfig struct {
+	Packages []string    `json:"packages"`
+	Builds   []BuildSpec `json:"builds"`
+}
+
+/**
+ *	A package version of one platform to be published
+ */
+type publishItem struct {
+	Spec   *BuildSpec
+	Os     string
+	Arch   string
+	Source string   //File to copy (archive), empty for exec
+	Layers []string //conf: base file and overlays merged into the package file
+	File   string   //Package file in the build directory
+}
+
+func (item *publishItem) dir() string {
+	return filepath.Join(item.Spec.Name, item.Os, item.Arch, item.Spec.Version)
+}
+
+var publishPlatforms = []string{
+	"linux/amd64", "linux/arm64",
+	"windows/amd64", "windows/arm64",
+	"darwin/amd64", "darwin/arm64",
+}
+
+/**
+ *	Signed copy of packages.json uploaded by --upload-packages, the tracked packages.json is left unchanged
+ */
+const signedPackagesFile = ".packages.signed.json"
+
+/**
+ *	Load storage backends of the named environments from the environments file
+ */
+func loadStorages(fname string, names []string) (map[string]utils.Storage, error) {
+	storages := make(map[string]utils.Storage)
+	if len(names) == 0 {
+		return storages, nil
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var envs map[string]utils.StorageConfig
+	if err := json.Unmarshal(data, &envs); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", fname, err)
+	}
+	for _, name := range names {
+		cfg, ok := envs[name]
+		if !ok {
+			return nil, fmt.Errorf("environment '%s' isn't defined in %s", name, fname)
+		}
+		s, err := utils.NewStorage(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("environment '%s': %v", name, err)
+		}
+		storages[name] = s
+	}
+	return storages, nil
+}
+
+/**
+ *	Select builds to publish, all builds if no name is given
+ */
+func selectBuilds(cfg *PublishConfig, names []string) ([]*BuildSpec, error) {
+	var specs []*BuildSpec
+	for i := range cfg.Builds {
+		spec := &cfg.Builds[i]
+		if len(names) > 0 && !slices.Contains(names, spec.Name) {
+			continue
+		}
+		if spec.Version == "" {
+			return nil, fmt.Errorf("version of '%s' isn't set", spec.Name)
+		}
+		var ver utils.VersionNumber
+		if err := ver.Parse(spec.Version); err != nil {
+			return nil, fmt.Errorf("invalid version '%s' of '%s': %v", spec.Version, spec.Name, err)
+		}
+		if spec.Type == "" {
+			spec.Type = string(utils.PackageTypeExec)
+		}
+		if spec.Type != string(utils.PackageTypeExec) && spec.Path != "" && spec.Target == "" {
+			return nil, fmt.Errorf("'target' of '%s' isn't set", spec.Name)
+		}
+		if spec.Description == "" {
+			spec.Description = "No description information"
+		}
+		specs = append(specs, spec)
+	}
+	for _, name := range names {
+		found := false
+		for _, spec := range specs {
+			found = found || spec.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("package '%s' isn't found in builds", name)
+		}
+	}
+	return specs, nil
+}
+
+/**
+ *	Find platforms to publish for spec
+ *	Builds with source path are built for all platforms (conf/archive skips platforms without source file),
+ *	otherwise the files already in the build directory are published
+ */
+func planBuild(spec *BuildSpec) ([]*publishItem, error) {
+	var items []*publishItem
+	for _, p := range publishPlatforms {
+		if len(optPublishPlatforms) > 0 && !slices.Contains(optPublishPlatforms, p) {
+			continue
+		}
+		osName, arch, _ := strings.Cut(p, "/")
+		item := &publishItem{Spec: spec, Os: osName, Arch: arch}
+		verDir := filepath.Join(optPublishBuildDir, item.dir())
+		if spec.Path == "" || optPublishNoBuild {
+			entries, err := os.ReadDir(verDir)
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				if e.Type().IsRegular() && e.Name() != "package.json" {
+					item.File = filepath.Join(verDir, e.Name())
+					break
+				}
+			}
+			if item.File == "" {
+				continue
+			}
+		} else if spec.Type == string(utils.PackageTypeExec) {
+			fname := spec.Name
+			if osName == "windows" {
+				fname += ".exe"
+			}
+			item.File = filepath.Join(verDir, fname)
+		} else if spec.Type == string(utils.PackageTypeConf) {
+			layers, err := confLayers(filepath.Join(optPublishBuildDir, spec.Path), spec.Target, osName, arch)
+			if err != nil {
+				fmt.Printf("warning: %v, skipping...\n", err)
+				continue
+			}
+			item.Layers = layers
+			item.File = filepath.Join(verDir, filepath.Base(spec.Target))
+		} else {
+			srcDir := filepath.Join(optPublishBuildDir, spec.Path)
+			item.Source = filepath.Join(srcDir, osName, arch, spec.Target)
+			if _, err := os.Stat(item.Source); err != nil {
+				item.Source = filepath.Join(srcDir, "common", spec.Target)
+				if _, err := os.Stat(item.Source); err != nil {
+					fmt.Printf("warning: %s of %s/%s doesn't exist, skipping...\n", spec.Target, osName, arch)
+					continue
+				}
+			}
+			item.File = filepath.Join(verDir, filepath.Base(spec.Target))
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("nothing to publish for '%s' %s", spec.Name, spec.Version)
+	}
+	return items, nil
+}
+
+/**
+ *	Build the package file of item: run build.py for exec, copy the target file for others
+ */
+func buildItem(item *publishItem) error {
+	if err := os.MkdirAll(filepath.Dir(item.File), 0775); err != nil {
+		return err
+	}
+	if len(item.Layers) > 0 {
+		data, err := renderLayers(item.Layers)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(item.File, data, 0644)
+	}
+	if item.Source != "" {
+		data, err := os.ReadFile(item.Source)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(item.File, data, 0644)
+	}
+	output, err := filepath.Abs(item.File)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("python", "./build.py", "--software", item.Spec.Version,
+		"--os", item.Os, "--arch", item.Arch, "--output", output)
+	cmd.Dir = filepath.Join(optPublishBuildDir, item.Spec.Path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("build %s for %s/%s failed: %v", item.Spec.Name, item.Os, item.Arch, err)
+	}
+	return nil
+}
+
+/**
+ *	Files of published items in upload order: version directories first, then platform.json
+ *	and platforms.json, so that clients never see an index referring to missing files
+ */
+func getUploadFiles(items []*publishItem) ([]string, error) {
+	var files, indexes, pkgs []string
+	for _, item := range items {
+		err := filepath.Walk(filepath.Join(optPublishBuildDir, item.dir()), func(fpath string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+				files = append(files, fpath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, filepath.Join(optPublishBuildDir, item.Spec.Name, item.Os, item.Arch, "platform.json"))
+		if !slices.Contains(pkgs, item.Spec.Name) {
+			pkgs = append(pkgs, item.Spec.Name)
+		}
+	}
+	for _, name := range pkgs {
+		indexes = append(indexes, filepath.Join(optPublishBuildDir, name, "platforms.json"))
+	}
+	return append(files, indexes...), nil
+}
+
+func publishPackages(names []string) error {
+	cfgFile := optPublishConfig
+	if cfgFile == "" {
+		cfgFile = filepath.Join(optPublishBuildDir, "packages.json")
+	}
+	cfg, err := loadPublishConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	envsFile := optPublishEnvsFile
+	if envsFile == "" {
+		envsFile = filepath.Join(optPublishBuildDir, "environments.json")
+	}
+	storages, err := loadStorages(envsFile, optPublishTo)
+	if err != nil {
+		return err
+	}
+	specs, err := selectBuilds(cfg, names)
+	if err != nil {
+		return err
+	}
+	var items []*publishItem
+	for _, spec := range specs {
+		plan, err := planBuild(spec)
+		if err != nil {
+			return err
+		}
+		items = append(items, plan...)
+	}
+	// Published versions are immutable, clients may have cached and verified them.
+	// Without --to the build directory is the repository, its versions aren't rebuilt and re-signed either
+	targets := optPublishTo
+	if len(targets) == 0 {
+		local, err := utils.NewStorage(utils.StorageConfig{Type: "local", Path: optPublishBuildDir})
+		if err != nil {
+			return err
+		}
+		targets = []string{"build"}
+		storages = map[string]utils.Storage{"build": local}
+	}
+	var conflicts []string
+	for _, envName := range targets {
+		s := storages[envName]
+		for _, item := range items {
+			name := filepath.ToSlash(filepath.Join(item.dir(), "package.json"))
+			exists, err := s.Exists(name)
+			if err != nil {
+				return fmt.Errorf("check '%s' in %s failed: %v", name, envName, err)
+			}
+			if exists {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s", envName, filepath.ToSlash(item.dir())))
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("refuse to republish existing versions, bump the version in %s:\n  %s",
+			cfgFile, strings.Join(conflicts, "\n  "))
+	}
+	if optPublishDryRun {
+		for _, item := range items {
+			switch {
+			case item.Spec.Path == "" || optPublishNoBuild:
+				fmt.Printf("pack    %s\n", item.File)
+			case len(item.Layers) > 1:
+				fmt.Printf("render  %s -> %s\n", strings.Join(item.Layers, " + "), item.File)
+			case len(item.Layers) == 1:
+				fmt.Printf("copy    %s -> %s\n", item.Layers[0], item.File)
+			case item.Source != "":
+				fmt.Printf("copy    %s -> %s\n", item.Source, item.File)
+			default:
+				fmt.Printf("build   %s (%s %s/%s)\n", item.File, item.Spec.Path, item.Os, item.Arch)
+			}
+		}
+		for _, envName := range optPublishTo {
+			fmt.Printf("upload  %d package(s) and index files to %s\n", len(items), envName)
+		}
+		return nil
+	}
+	if optPublishKey == "" {
+		return fmt.Errorf("private key file (-k) is required to publish")
+	}
+
+	for _, item := range items {
+		if item.Spec.Path != "" && !optPublishNoBuild {
+			fmt.Printf("==== Building %s %s for %s/%s ====\n", item.Spec.Name, item.Spec.Version, item.Os, item.Arch)
+			if err := buildItem(item); err != nil {
+				return err
+			}
+		}
+		err := makePackage(packSpec{
+			Package:     item.Spec.Name,
+			From:        item.File,
+			KeyFile:     optPublishKey,
+			Os:          item.Os,
+			Arch:        item.Arch,
+			Version:     item.Spec.Version,
+			Type:        item.Spec.Type,
+			FileName:    item.Spec.FileName,
+			Description: item.Spec.Description,
+			Algo:        utils.ChecksumSha256,
+			Probe:       item.Spec.Probe,
+			Deltas:      optPublishDeltas,
+		})
+		if err != nil {
+			return fmt.Errorf("pack %s failed: %v", item.File, err)
+		}
+	}
+
+	optBuildDir = optPublishBuildDir
+	optIndexKey = optPublishKey
+	optIndexExpires = optPublishExpires
+	optIndexPackages = ""
+	if err := makePackages(); err != nil {
+		return err
+	}
+	signedPackages := filepath.Join(optPublishBuildDir, signedPackagesFile)
+	if optPublishUploadPackages {
+		if err := signPackagesTo(cfgFile, signedPackages); err != nil {
+			return err
+		}
+	}
+
+	files, err := getUploadFiles(items)
+	if err != nil {
+		return err
+	}
+	if optPublishUploadPackages {
+		files = append(files, signedPackages)
+	}
+	for _, envName := range optPublishTo {
+		s := storages[envName]
+		for _, fpath := range files {
+			rel, err := filepath.Rel(optPublishBuildDir, fpath)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = filepath.Base(fpath)
+			}
+			if fpath == signedPackages {
+				rel = "packages.json"
+			}
+			name := filepath.ToSlash(rel)
+			fmt.Printf("upload %s to %s\n", name, envName)
+			if err := s.Put(name, fpath); err != nil {
+				return fmt.Errorf("upload '%s' to %s failed: %v", name, envName, err)
+			}
+		}
+		fmt.Printf("Published %d package(s) to %s\n", len(items), envName)
+	}
+	return nil
+}
+
+var publishCmd = &cobra.Command{
+	Use:   "publish [package...]",
+	Short: "Build, sign, index and upload packages described in packages.json",
+	Long: `Build packages listed in 'builds' of packages.json for all platforms, sign them, regenerate index files and upload them to the named environments.
+Environments are defined in environments.json as {"<env>": {"type": "local|s3|webdav", ...}}, credentials are read from environment variables.
+A version already existing in an environment, or in the build directory when no environment is given, is never republished.
+The newest version moves to the highest published version, unless it was set explicitly with 'smc package newest'.
+With --upload-packages, a signed copy of packages.json is uploaded, the packages.json in the build directory isn't modified`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return publishPackages(args)
+	},
+}
+
+var optPublishBuildDir string
+var optPublishConfig string
+var optPublishEnvsFile string
+var optPublishTo []string
+var optPublishPlatforms []string
+var optPublishKey string
+var optPublishExpires string
+var optPublishDeltas int
+var optPublishNoBuild bool
+var optPublishUploadPackages bool
+var optPublishDryRun bool
+
+func init() {
+	packageCmd.AddCommand(publishCmd)
+
+	publishCmd.Example = `  # Show what would be built and uploaded for costrict
+  smc package publish costrict -b ./build --to prod --dry-run
+  # Build and publish all packages to test and prod, with deltas from the previous 2 versions
+  smc package publish -b ./build -k costrict-private.pem --to test --to prod -d 2
+  # Publish the files already in the build directory, and the signed packages.json
+  smc package publish system -b ./build -k costrict-private.pem --to prod --no-build --upload-packages`
+	publishCmd.SilenceUsage = true
+	publishCmd.Flags().SortFlags = false
+	publishCmd.Flags().StringVarP(&optPublishBuildDir, "build", "b", ".", "Build directory: location of packages.json and package files")
+	publishCmd.Flags().StringVarP(&optPublishConfig, "config", "c", "", "packages.json describing builds (default {build}/packages.json)")
+	publishCmd.Flags().StringVar(&optPublishEnvsFile, "envs", "", "File defining environments (default {build}/environments.json)")
+	publishCmd.Flags().StringArrayVarP(&optPublishTo, "to", "t", nil, "Environment to upload to, can be repeated (default build locally only)")
+	publishCmd.Flags().StringArrayVar(&optPublishPlatforms, "platform", nil, "Platform os/arch to publish, can be repeated (default all)")
+	publishCmd.Flags().StringVarP(&optPublishKey, "key", "k", "", "Private key file used to sign packages and index files")
+	publishCmd.Flags().StringVarP(&optPublishExpires, "expires", "e", "90d", "Validity period of signed index files (s/m/h/d)")
+	publishCmd.Flags().IntVarP(&optPublishDeltas, "deltas", "d", 0, "Generate delta files from the previous N versions")
+	publishCmd.Flags().BoolVar(&optPublishNoBuild, "no-build", false, "Don't build, publish package files already in the build directory")
+	publishCmd.Flags().BoolVar(&optPublishUploadPackages, "upload-packages", false, "Sign and upload packages.json as well")
+	publishCmd.Flags().BoolVar(&optPublishDryRun, "dry-run", false, "Only show what would be built and uploaded")
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+// TestPublishLocal checks versions in the build directory aren't republished, and packages.json is signed as a copy
+func TestPublishLocal(t *testing.T) {
+	buildDir := t.TempDir()
+	repoDir := t.TempDir()
+	_, priKey, _ := utils.GenKeys(utils.KeyTypeEd25519)
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	os.WriteFile(keyFile, priKey, 0600)
+	cfg := []byte(`{"packages": ["app"], "builds": [{"name": "app", "version": "1.0.0", "probe": "none"}]}`)
+	cfgFile := filepath.Join(buildDir, "packages.json")
+	os.WriteFile(cfgFile, cfg, 0644)
+	os.WriteFile(filepath.Join(buildDir, "environments.json"),
+		[]byte(`{"prod": {"type": "local", "path": "`+filepath.ToSlash(repoDir)+`"}}`), 0644)
+	verDir := filepath.Join(buildDir, "app", "linux", "amd64", "1.0.0")
+	os.MkdirAll(verDir, 0775)
+	os.WriteFile(filepath.Join(verDir, "app"), []byte("#!/bin/sh\n"), 0755)
+
+	optPublishBuildDir, optPublishConfig, optPublishEnvsFile = buildDir, "", ""
+	optPublishPlatforms = []string{"linux/amd64"}
+	optPublishKey, optPublishExpires = keyFile, "1d"
+	optPublishTo, optPublishNoBuild, optPublishUploadPackages = nil, false, false
+	if err := publishPackages(nil); err != nil {
+		t.Fatalf("publish to the build directory: %v", err)
+	}
+	plat, err := loadPackagesFile(filepath.Join(buildDir, "app", "linux", "amd64", "platform.json"))
+	if newest := plat.Newest.VersionId; err != nil || newest.String() != "1.0.0" {
+		t.Fatalf("newest after publish = %s, %v", newest.String(), err)
+	}
+	if err := publishPackages(nil); err == nil || !strings.Contains(err.Error(), "republish") {
+		t.Errorf("version in the build directory republished: %v", err)
+	}
+
+	optPublishTo, optPublishNoBuild, optPublishUploadPackages = []string{"prod"}, true, true
+	defer func() { optPublishTo, optPublishNoBuild, optPublishUploadPackages = nil, false, false }()
+	if err := publishPackages(nil); err != nil {
+		t.Fatalf("publish to prod: %v", err)
+	}
+	if data, _ := os.ReadFile(cfgFile); !bytes.Equal(data, cfg) {
+		t.Error("packages.json in the build directory is modified")
+	}
+	if data, _ := os.ReadFile(filepath.Join(repoDir, "packages.json")); !bytes.Contains(data, []byte(`"signature"`)) {
+		t.Errorf("uploaded packages.json isn't signed: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "app", "linux", "amd64", "1.0.0", "package.json")); err != nil {
+		t.Errorf("package isn't uploaded: %v", err)
+	}
+}
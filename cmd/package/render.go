@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in render diff
+ */
+type Render_Columns struct {
+	Platform  string `json:"platform"`
+	Path      string `json:"path"`
+	Common    string `json:"common"`
+	Effective string `json:"effective"`
+}
+
+/**
+ *	Overlay file name of a configuration target: costrict.json -> costrict.patch.json
+ */
+func overlayName(target string) string {
+	ext := filepath.Ext(target)
+	return strings.TrimSuffix(target, ext) + ".patch" + ext
+}
+
+/**
+ *	Layers of a configuration target for the platform, the base first:
+ *	- base: {src}/{os}/{arch}/{target} if it is kept as a full copy, otherwise {src}/common/{target}
+ *	- overlays: {src}/{os}/{name}.patch.json, then {src}/{os}/{arch}/{name}.patch.json
+ */
+func confLayers(srcDir, target, osName, arch string) ([]string, error) {
+	base := filepath.Join(srcDir, osName, arch, target)
+	if !fileExists(base) {
+		base = filepath.Join(srcDir, "common", target)
+		if !fileExists(base) {
+			return nil, fmt.Errorf("%s of %s/%s doesn't exist", target, osName, arch)
+		}
+	}
+	layers := []string{base}
+	if filepath.Ext(target) != ".json" {
+		return layers, nil
+	}
+	for _, overlay := range []string{
+		filepath.Join(srcDir, osName, overlayName(target)),
+		filepath.Join(srcDir, osName, arch, overlayName(target)),
+	} {
+		if fileExists(overlay) {
+			layers = append(layers, overlay)
+		}
+	}
+	return layers, nil
+}
+
+/**
+ *	Deep-merge overlays onto the base with JSON merge-patch semantics
+ *	A single layer is returned as is, keeping its original formatting
+ */
+func renderLayers(layers []string) ([]byte, error) {
+	data, err := os.ReadFile(layers[0])
+	if err != nil || len(layers) == 1 {
+		return data, err
+	}
+	doc, err := utils.ParseOrderedJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse '%s' failed: %v", layers[0], err)
+	}
+	for _, overlay := range layers[1:] {
+		data, err := os.ReadFile(overlay)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := utils.ParseOrderedJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse '%s' failed: %v", overlay, err)
+		}
+		doc = utils.MergePatch(doc, patch)
+	}
+	return utils.MarshalOrderedJSON(doc)
+}
+
+/**
+ *	Find the conf build of the package in packages.json
+ */
+func findConfBuild(name string) (*BuildSpec, error) {
+	cfgFile := optRenderConfig
+	if cfgFile == "" {
+		cfgFile = filepath.Join(optRenderBuildDir, "packages.json")
+	}
+	cfg, err := loadPublishConfig(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfg.Builds {
+		b := &cfg.Builds[i]
+		if b.Name != name {
+			continue
+		}
+		if b.Type != string(utils.PackageTypeConf) || b.Path == "" || b.Target == "" {
+			return nil, fmt.Errorf("'%s' isn't a conf package with path and target", name)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("package '%s' isn't found in %s", name, cfgFile)
+}
+
+/**
+ *	Show how the effective configuration of each platform differs from the common base
+ */
+func diffPlatforms(srcDir, target string) error {
+	common := filepath.Join(srcDir, "common", target)
+	baseData, err := os.ReadFile(common)
+	if err != nil {
+		return err
+	}
+	base, err := utils.ParseOrderedJSON(baseData)
+	if err != nil {
+		return fmt.Errorf("parse '%s' failed: %v", common, err)
+	}
+	var dataList []*orderedmap.OrderedMap
+	for _, p := range publishPlatforms {
+		osName, arch, _ := strings.Cut(p, "/")
+		layers, err := confLayers(srcDir, target, osName, arch)
+		if err != nil {
+			return err
+		}
+		data, err := renderLayers(layers)
+		if err != nil {
+			return err
+		}
+		doc, err := utils.ParseOrderedJSON(data)
+		if err != nil {
+			return fmt.Errorf("parse '%s' failed: %v", layers[0], err)
+		}
+		changes := utils.DiffJSON(base, doc)
+		if len(changes) == 0 {
+			changes = []utils.JSONChange{{Path: "(same as common)"}}
+		}
+		for _, c := range changes {
+			row := Render_Columns{Platform: p, Path: c.Path, Common: utils.JSONText(c.Old), Effective: utils.JSONText(c.New)}
+			if c.Old == nil && c.New == nil {
+				row.Common, row.Effective = "", ""
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+	}
+	utils.PrintFormat(dataList)
+	return nil
+}
+
+func renderConf(name string) error {
+	spec, err := findConfBuild(name)
+	if err != nil {
+		return err
+	}
+	srcDir := filepath.Join(optRenderBuildDir, spec.Path)
+	if optRenderDiff {
+		return diffPlatforms(srcDir, spec.Target)
+	}
+	layers, err := confLayers(srcDir, spec.Target, optRenderOs, optRenderArch)
+	if err != nil {
+		return err
+	}
+	data, err := renderLayers(layers)
+	if err != nil {
+		return err
+	}
+	if optRenderOutput == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(optRenderOutput, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("render %s -> %s\n", strings.Join(layers, " + "), optRenderOutput)
+	return nil
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render {package}",
+	Short: "Render the effective configuration of a conf package for a platform",
+	Long: `Render a conf package declared in packages.json for a platform: the common file deep-merged with
+overlays {path}/{os}/{name}.patch.json and {path}/{os}/{arch}/{name}.patch.json (JSON merge-patch, RFC 7386).
+A full copy {path}/{os}/{arch}/{target} replaces the common file as the base.
+'smc package publish' renders conf packages the same way`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return renderConf(args[0])
+	},
+}
+
+var optRenderBuildDir string
+var optRenderConfig string
+var optRenderOs string
+var optRenderArch string
+var optRenderOutput string
+var optRenderDiff bool
+
+func init() {
+	packageCmd.AddCommand(renderCmd)
+
+	renderCmd.Example = `  # Print costrict.json effective on linux/amd64
+  smc package render costrict-config -b ./build -s linux -a amd64
+  # Show how each platform differs from the common costrict.json
+  smc package render costrict-config -b ./build --diff`
+	renderCmd.SilenceUsage = true
+	renderCmd.Flags().SortFlags = false
+	renderCmd.Flags().StringVarP(&optRenderBuildDir, "build", "b", ".", "Build directory: location of packages.json")
+	renderCmd.Flags().StringVarP(&optRenderConfig, "config", "c", "", "packages.json describing builds (default {build}/packages.json)")
+	renderCmd.Flags().StringVarP(&optRenderOs, "os", "s", runtime.GOOS, "Target operating system")
+	renderCmd.Flags().StringVarP(&optRenderArch, "arch", "a", runtime.GOARCH, "Target hardware architecture")
+	renderCmd.Flags().StringVarP(&optRenderOutput, "output", "o", "", "Write the configuration to the file instead of stdout")
+	renderCmd.Flags().BoolVar(&optRenderDiff, "diff", false, "Show differences from the common base for every platform")
+}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in rollout list
+ */
+type Rollout_Columns struct {
+	Platform   string `json:"platform"`
+	Version    string `json:"version"`
+	Percentage string `json:"percentage"`
+	Machines   string `json:"machines"`
+	MinVersion string `json:"minVersion"`
+	Fallback   string `json:"fallback"`
+	Channels   string `json:"channels"`
+}
+
+/**
+ *	Get channels whose newest version is ver
+ */
+func getVersionChannels(plat *utils.PlatformInfo, ver utils.VersionNumber) string {
+	var names []string
+	if plat.Newest.InfoUrl != "" && utils.CompareVersion(plat.Newest.VersionId, ver) == 0 {
+		names = append(names, utils.DefaultChannel)
+	}
+	for name, addr := range plat.Channels {
+		if utils.CompareVersion(addr.VersionId, ver) == 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+/**
+ *	Get the version machines out of the rollout get: --fallback, the fallback of the existing rule,
+ *	or the newest version released before the rollout
+ *	Returns nil if there is none, then machines out of the rollout keep their installed versions
+ */
+func getRolloutFallback(plat *utils.PlatformInfo, ver utils.VersionNumber) (*utils.VersionNumber, error) {
+	if optRolloutFallback != "" {
+		fallback := &utils.VersionNumber{}
+		if err := fallback.Parse(optRolloutFallback); err != nil {
+			return nil, err
+		}
+		return fallback, nil
+	}
+	if old := plat.GetRollout(ver); old != nil && old.Fallback != nil {
+		return old.Fallback, nil
+	}
+	if plat.Newest.InfoUrl != "" && utils.CompareVersion(plat.Newest.VersionId, ver) < 0 {
+		fallback := plat.Newest.VersionId
+		return &fallback, nil
+	}
+	return nil, nil
+}
+
+/**
+ *	Set rollout rule of the version in platform.json of each platform
+ */
+func setRollout(pkgName string) error {
+	rule := utils.RolloutRule{Percentage: optRolloutPercent}
+	if err := rule.VersionId.Parse(optRolloutVer); err != nil {
+		return err
+	}
+	for _, m := range strings.Split(optRolloutMachines, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			rule.Machines = append(rule.Machines, m)
+		}
+	}
+	if optRolloutMinVer != "" {
+		rule.MinVersion = &utils.VersionNumber{}
+		if err := rule.MinVersion.Parse(optRolloutMinVer); err != nil {
+			return err
+		}
+	}
+	if len(rule.Machines) > 0 && rule.Percentage >= 100 {
+		return fmt.Errorf("machines are useless when percentage is 100")
+	}
+	files, err := findPlatformFiles(optRolloutBuildDir, pkgName, optRolloutOs, optRolloutArch)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, fpath := range files {
+		plat, err := loadPackagesFile(fpath)
+		platRule := rule
+		if err == nil {
+			platRule.Fallback, err = getRolloutFallback(plat, rule.VersionId)
+		}
+		if err == nil {
+			err = plat.SetRollout(platRule)
+		}
+		if err == nil {
+			err = savePackagesFile(fpath, plat, optRolloutKey, optRolloutExpires)
+		}
+		if err != nil {
+			fmt.Printf("error: set rollout of %s failed: %v\n", fpath, err)
+			failed++
+			continue
+		}
+		fmt.Printf("rollout %s/%s %s: %d%%\n", plat.Os, plat.Arch, rule.VersionId.String(), rule.Percentage)
+		if platRule.Fallback == nil && rule.Percentage < 100 {
+			fmt.Printf("warning: no fallback for %s/%s, machines out of the rollout keep their versions and new installs fail, set it with --fallback\n",
+				plat.Os, plat.Arch)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d platforms failed to set rollout", failed)
+	}
+	return nil
+}
+
+/**
+ *	Show rollout rules in platform.json of each platform
+ */
+func showRollout(pkgName string) error {
+	files, err := findPlatformFiles(optRolloutBuildDir, pkgName, optRolloutOs, optRolloutArch)
+	if err != nil {
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	for _, fpath := range files {
+		plat, err := loadPackagesFile(fpath)
+		if err != nil {
+			fmt.Printf("error: load %s failed: %v\n", fpath, err)
+			continue
+		}
+		for _, rule := range plat.Rollouts {
+			row := Rollout_Columns{
+				Platform:   fmt.Sprintf("%s/%s", plat.Os, plat.Arch),
+				Version:    rule.VersionId.String(),
+				Percentage: fmt.Sprintf("%d%%", rule.Percentage),
+				Machines:   strings.Join(rule.Machines, ","),
+				MinVersion: "-",
+				Fallback:   "-",
+				Channels:   getVersionChannels(plat, rule.VersionId),
+			}
+			if rule.MinVersion != nil {
+				row.MinVersion = rule.MinVersion.String()
+			}
+			if rule.Fallback != nil {
+				row.Fallback = rule.Fallback.String()
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+	}
+	if len(dataList) == 0 {
+		fmt.Printf("No rollout in progress, all versions of '%s' are fully released\n", pkgName)
+		return nil
+	}
+	utils.PrintFormat(dataList)
+	return nil
+}
+
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Manage staged rollouts of package versions",
+	Long: `Manage staged rollouts: a version with a rollout rule is only upgraded automatically on machines whose ID is in the allow-list, or falls in the percentage.
+Other machines get the fallback version, which is the newest version when the rollout starts unless --fallback is given`,
+}
+
+var rolloutSetCmd = &cobra.Command{
+	Use:   "set {package} -v version --percent N [--machines id,...] [--min-version version] [--fallback version]",
+	Short: "Set the rollout rule of a version, percentage 100 completes the rollout",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setRollout(args[0])
+	},
+}
+
+var rolloutShowCmd = &cobra.Command{
+	Use:   "show {package}",
+	Short: "Show rollout rules of a package",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showRollout(args[0])
+	},
+}
+
+var optRolloutBuildDir string
+var optRolloutOs string
+var optRolloutArch string
+var optRolloutVer string
+var optRolloutPercent int
+var optRolloutMachines string
+var optRolloutMinVer string
+var optRolloutFallback string
+var optRolloutKey string
+var optRolloutExpires string
+
+func init() {
+	packageCmd.AddCommand(rolloutCmd)
+	rolloutCmd.AddCommand(rolloutSetCmd)
+	rolloutCmd.AddCommand(rolloutShowCmd)
+
+	rolloutCmd.Example = `  # Release costrict 1.3.0 to 5% of machines, and the test machines
+  smc package rollout set costrict -v 1.3.0 --percent 5 --machines m-001,m-002 -k costrict-private.pem
+  # Machines out of the rollout stay on 1.2.0, when the newest version was already moved to 1.3.0 by re-indexing
+  smc package rollout set costrict -v 1.3.0 --percent 5 --fallback 1.2.0 -k costrict-private.pem
+  # Only machines already running 1.2.0 or above take part in the rollout
+  smc package rollout set costrict -v 1.3.0 --percent 20 --min-version 1.2.0 -k costrict-private.pem
+  # Complete the rollout
+  smc package rollout set costrict -v 1.3.0 --percent 100 -k costrict-private.pem
+  # Show rollouts in progress
+  smc package rollout show costrict`
+	for _, c := range []*cobra.Command{rolloutSetCmd, rolloutShowCmd} {
+		c.Flags().SortFlags = false
+		c.Flags().StringVarP(&optRolloutBuildDir, "build", "b", ".", "Build directory: location of package files")
+		c.Flags().StringVar(&optRolloutOs, "os", "*", "Only the platform with this operating system")
+		c.Flags().StringVar(&optRolloutArch, "arch", "*", "Only the platform with this architecture")
+	}
+	rolloutSetCmd.Flags().StringVarP(&optRolloutVer, "version", "v", "", "Version to roll out")
+	rolloutSetCmd.Flags().IntVar(&optRolloutPercent, "percent", 0, "Percentage of machines allowed to upgrade (0-100)")
+	rolloutSetCmd.Flags().StringVar(&optRolloutMachines, "machines", "", "Machine IDs always allowed to upgrade, separated by ','")
+	rolloutSetCmd.Flags().StringVar(&optRolloutMinVer, "min-version", "", "Only machines with this version or above installed take part in the percentage")
+	rolloutSetCmd.Flags().StringVar(&optRolloutFallback, "fallback", "", "Version for machines out of the rollout, default the newest version released before")
+	rolloutSetCmd.Flags().StringVarP(&optRolloutKey, "key", "k", "", "Private key file used to re-sign the index files")
+	rolloutSetCmd.Flags().StringVarP(&optRolloutExpires, "expires", "e", "90d", "Validity period of the signed index files (s/m/h/d)")
+	rolloutSetCmd.MarkFlagRequired("version")
+}
@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Serve the package repository directory over HTTP
+ */
+func servePackages() error {
+	info, err := os.Stat(optServeDir)
+	if err != nil {
+		if !os.IsNotExist(err) || optServeUpstream == "" {
+			return err
+		}
+		if err = os.MkdirAll(optServeDir, 0775); err != nil {
+			return err
+		}
+	} else if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", optServeDir)
+	}
+	ttl, err := utils.Time2Sec(optServeIndexTTL)
+	if err != nil {
+		return fmt.Errorf("invalid index-ttl '%s': %v", optServeIndexTTL, err)
+	}
+	m := utils.NewMirror(optServeDir, optServePrefix, optServeUpstream, time.Duration(ttl)*time.Second)
+	if optServeUpstream != "" {
+		fmt.Printf("Mirror %s at http://%s%s, cache: %s\n", optServeUpstream, optServeAddr, m.Prefix, optServeDir)
+	} else {
+		fmt.Printf("Serve %s at http://%s%s\n", optServeDir, optServeAddr, m.Prefix)
+	}
+	return http.ListenAndServe(optServeAddr, m)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve {build-dir | -d build-dir}",
+	Short: "Serve a package repository over HTTP, optionally as a pull-through mirror",
+	Long:  `Serve a directory laid out as <package>/<os>/<arch>/<ver>/package.json with its index files over HTTP. With --upstream, files missing locally are fetched from the upstream repository and cached`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			optServeDir = args[0]
+		}
+		return servePackages()
+	},
+}
+
+var optServeDir string
+var optServeAddr string
+var optServePrefix string
+var optServeUpstream string
+var optServeIndexTTL string
+
+func init() {
+	packageCmd.AddCommand(serveCmd)
+
+	serveCmd.Example = `  # Serve ./build, clients set SMC_BASE_URL=http://<host>:8080
+  smc package serve ./build --addr :8080
+  # LAN mirror of the cloud repository, caching into /var/cache/smc
+  smc package serve /var/cache/smc --upstream https://zgsm.sangfor.com/costrict --index-ttl 10m`
+	serveCmd.Flags().SortFlags = false
+	serveCmd.Flags().StringVarP(&optServeDir, "dir", "d", ".", "Repository directory, or cache directory in mirror mode")
+	serveCmd.Flags().StringVarP(&optServeAddr, "addr", "a", ":8080", "Listening address")
+	serveCmd.Flags().StringVar(&optServePrefix, "prefix", "/costrict", "URL path prefix, clients access {SMC_BASE_URL}/costrict")
+	serveCmd.Flags().StringVarP(&optServeUpstream, "upstream", "u", "", "Upstream repository URL, enables pull-through mirror mode")
+	serveCmd.Flags().StringVar(&optServeIndexTTL, "index-ttl", "5m", "How long cached index files are used before fetching again (s/m/h/d)")
+}
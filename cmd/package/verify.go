@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in verify report
+ */
+type Verify_Columns struct {
+	Path    string `json:"path"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+/**
+ *	Audit the repository directory, fail if any issue is found
+ */
+func verifyRepository() error {
+	cfg := utils.UpgradeConfig{
+		Policy:      utils.VerifyPolicy(optVerifyPolicy),
+		IndexPolicy: utils.VerifyPolicy(optVerifyPolicy),
+		TrustFile:   optVerifyTrust,
+	}
+	if optVerifyPubKey != "" {
+		data, err := os.ReadFile(optVerifyPubKey)
+		if err != nil {
+			return err
+		}
+		cfg.PublicKey = string(data)
+	}
+	report := utils.AuditRepository(optVerifyDir, cfg)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if optVerifyOutput != "" {
+		if err := os.WriteFile(optVerifyOutput, data, 0644); err != nil {
+			return err
+		}
+	}
+	if optVerifyJson {
+		fmt.Println(string(data))
+	} else {
+		var dataList []*orderedmap.OrderedMap
+		for _, issue := range report.Issues {
+			recordMap, _ := utils.StructToOrderedMap(Verify_Columns(issue))
+			dataList = append(dataList, recordMap)
+		}
+		if len(dataList) > 0 {
+			utils.PrintFormat(dataList)
+		}
+		fmt.Printf("Checked %d descriptors and %d index files in '%s', %d issues\n",
+			report.Descriptors, report.Indexes, optVerifyDir, len(report.Issues))
+	}
+	if !report.Passed {
+		return fmt.Errorf("verify '%s' failed: %d issues\n", optVerifyDir, len(report.Issues))
+	}
+	return nil
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify {build-dir | -b build-dir}",
+	Short: "Verify integrity of a package repository before uploading",
+	Long: `Check every package.json (size, checksum and signature of the package file), and every platform.json/platforms.json
+(signature, expiry, newest version, listed versions and orphan version directories) in the build directory.
+Exits with non-zero status if any issue is found, so that it can gate releases`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			optVerifyDir = args[0]
+		}
+		return verifyRepository()
+	},
+}
+
+var optVerifyDir string
+var optVerifyPubKey string
+var optVerifyTrust string
+var optVerifyPolicy string
+var optVerifyJson bool
+var optVerifyOutput string
+
+func init() {
+	packageCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Example = `  # Verify ./build with the release public key
+  smc package verify ./build -p costrict-public.pem
+  # Write a machine-readable report for the CI pipeline
+  smc package verify ./build -p costrict-public.pem -o verify-report.json`
+	verifyCmd.SilenceUsage = true
+	verifyCmd.Flags().SortFlags = false
+	verifyCmd.Flags().StringVarP(&optVerifyDir, "build", "b", ".", "Build directory: location of package files")
+	verifyCmd.Flags().StringVarP(&optVerifyPubKey, "public-key", "p", "", "Public key file used to verify signatures (default the built-in key)")
+	verifyCmd.Flags().StringVar(&optVerifyTrust, "trust", "", "Trust store file whose keys are accepted as well (default the trust store of this machine)")
+	verifyCmd.Flags().StringVar(&optVerifyPolicy, "policy", string(utils.VerifyPolicyStrict), "Verification policy: strict, or compat to accept md5 checksums, checksum-only signatures and unsigned indexes")
+	verifyCmd.Flags().BoolVar(&optVerifyJson, "json", false, "Print the report as JSON")
+	verifyCmd.Flags().StringVarP(&optVerifyOutput, "output", "o", "", "Write the JSON report to the file")
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in health report
+ */
+type Health_Columns struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Health   string `json:"health"`
+	Latency  string `json:"latency"`
+	Message  string `json:"message"`
+}
+
+func checkHealth(names []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	var services []utils.ServiceSpec
+	var err error
+	if len(names) > 0 {
+		services, err = selectServices(names)
+	} else {
+		services, err = loadServices()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	var results []utils.HealthResult
+	unhealthy := 0
+	for _, s := range services {
+		r := utils.CheckServiceHealth(s, "", time.Duration(optHealthTimeout)*time.Second)
+		if !r.Healthy {
+			unhealthy++
+		}
+		results = append(results, r)
+	}
+	if optHealthJson {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		var dataList []*orderedmap.OrderedMap
+		for _, r := range results {
+			row := Health_Columns{
+				Name:     r.Name,
+				Protocol: r.Protocol,
+				Address:  r.Address,
+				Health:   "healthy",
+				Latency:  r.Latency.Round(time.Millisecond).String(),
+				Message:  r.Message,
+			}
+			if !r.Healthy {
+				row.Health = "unhealthy"
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+		utils.PrintFormat(dataList)
+	}
+	if unhealthy > 0 {
+		return fmt.Errorf("%d services are unhealthy", unhealthy)
+	}
+	return nil
+}
+
+var healthCmd = &cobra.Command{
+	Use:   "health [service...]",
+	Short: "Probe health of services",
+	Long: `Probe every declared service, or the named ones: HTTP GET on the health path of http services
+('/' if no health path is declared), TCP connect otherwise. Exits with non-zero status if any service is unhealthy`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return checkHealth(args)
+	},
+}
+
+var optHealthTimeout int
+var optHealthJson bool
+
+func init() {
+	serviceCmd.AddCommand(healthCmd)
+
+	healthCmd.Example = `  smc service health
+  smc service health codebase-indexer --json`
+	healthCmd.SilenceUsage = true
+	healthCmd.Flags().SortFlags = false
+	healthCmd.Flags().IntVarP(&optHealthTimeout, "timeout", "t", 3, "Seconds to wait for each probe")
+	healthCmd.Flags().BoolVar(&optHealthJson, "json", false, "Print the results as JSON")
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in service list
+ */
+type Service_Columns struct {
+	Name       string `json:"name"`
+	Startup    string `json:"startup"`
+	Protocol   string `json:"protocol"`
+	Port       string `json:"port"`
+	Accessible string `json:"accessible"`
+	Status     string `json:"status"`
+	Pid        string `json:"pid"`
+}
+
+func listServices() error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	services, err := loadServices()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	for _, s := range services {
+		row := Service_Columns{
+			Name:       s.Name,
+			Startup:    s.Startup,
+			Protocol:   s.Protocol,
+			Port:       fmt.Sprint(s.Port),
+			Accessible: s.Accessible,
+			Status:     utils.ServiceStopped,
+			Pid:        "-",
+		}
+		if state, err := utils.LoadServiceState("", s.Name); err == nil {
+			row.Status = state.Status
+			if state.Active() && state.Port != s.Port {
+				row.Port = fmt.Sprintf("%d (declared %d)", state.Port, s.Port)
+			}
+			if state.Pid > 0 && state.Active() {
+				row.Pid = fmt.Sprint(state.Pid)
+			}
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	utils.PrintFormat(dataList)
+	return nil
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List services declared in system spec",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listServices()
+	},
+}
+
+func init() {
+	serviceCmd.AddCommand(listCmd)
+	listCmd.Example = `  smc service list`
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in metrics
+ */
+type Metrics_Columns struct {
+	Metric string `json:"metric"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Rate   string `json:"rate"`
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+/**
+ *	Print metrics as a table, counters with their rate since the previous scrape
+ */
+func printMetrics(families []utils.MetricFamily, prev map[string]float64, elapsed time.Duration) map[string]float64 {
+	values := make(map[string]float64)
+	var dataList []*orderedmap.OrderedMap
+	for _, f := range families {
+		for _, s := range f.Samples {
+			key := s.Name + s.LabelString()
+			values[key] = s.Value
+			row := Metrics_Columns{Metric: key, Type: f.Type, Value: formatValue(s.Value), Rate: "-"}
+			if old, ok := prev[key]; ok && f.Type == "counter" && elapsed > 0 {
+				row.Rate = fmt.Sprintf("%.2f/s", (s.Value-old)/elapsed.Seconds())
+			}
+			recordMap, _ := utils.StructToOrderedMap(row)
+			dataList = append(dataList, recordMap)
+		}
+	}
+	if len(dataList) > 0 {
+		utils.PrintFormat(dataList)
+	} else {
+		fmt.Println("No metric")
+	}
+	return values
+}
+
+func showMetrics(name string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	services, err := selectServices([]string{name})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	timeout := time.Duration(optMetricsTimeout) * time.Second
+	var prev map[string]float64
+	var last time.Time
+	for {
+		families, err := utils.ScrapeMetrics(services[0], "", timeout)
+		if optMetricsFilter != "" {
+			families = slices.DeleteFunc(families, func(f utils.MetricFamily) bool {
+				return !strings.Contains(f.Name, optMetricsFilter)
+			})
+		}
+		now := time.Now()
+		if optMetricsWatch > 0 && !optMetricsJson {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("%s metrics, every %ds: %s\n\n", name, optMetricsWatch, now.Format(time.DateTime))
+		}
+		switch {
+		case err != nil && optMetricsWatch <= 0:
+			fmt.Println(err)
+			return err
+		case err != nil:
+			fmt.Println(err)
+		case optMetricsJson && optMetricsWatch > 0:
+			data, err := json.Marshal(families)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		case optMetricsJson:
+			data, err := json.MarshalIndent(families, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		default:
+			prev = printMetrics(families, prev, now.Sub(last))
+			last = now
+		}
+		if optMetricsWatch <= 0 {
+			return nil
+		}
+		time.Sleep(time.Duration(optMetricsWatch) * time.Second)
+	}
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics service",
+	Short: "Scrape metrics of a service",
+	Long: `Scrape the Prometheus text exposition from the metrics endpoint declared for the service and print it as a table.
+With --watch, refresh periodically and show the rate of counters; with --json, print one JSON document per scrape`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showMetrics(args[0])
+	},
+}
+
+var optMetricsWatch int
+var optMetricsFilter string
+var optMetricsTimeout int
+var optMetricsJson bool
+
+func init() {
+	serviceCmd.AddCommand(metricsCmd)
+
+	metricsCmd.Example = `  smc service metrics codebase-indexer
+  # Refresh every 5 seconds, only metrics whose name contains 'http'
+  smc service metrics codebase-indexer -w 5 -f http`
+	metricsCmd.SilenceUsage = true
+	metricsCmd.Flags().SortFlags = false
+	metricsCmd.Flags().IntVarP(&optMetricsWatch, "watch", "w", 0, "Refresh every N seconds")
+	metricsCmd.Flags().StringVarP(&optMetricsFilter, "filter", "f", "", "Only show metrics whose name contains the text")
+	metricsCmd.Flags().IntVarP(&optMetricsTimeout, "timeout", "t", 3, "Seconds to wait for each scrape")
+	metricsCmd.Flags().BoolVar(&optMetricsJson, "json", false, "Print the metrics as JSON")
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Management services",
+	Long: `Management services declared in system-spec.json, list, start, stop, restart, status, health, metrics, etc.
+Each service is supervised by a background 'smc service run' process which restarts it with backoff,
+its state (pid, port) and output are kept in ~/.costrict/run`,
+}
+
+const serviceExample = `  # List services and their state
+  smc service list
+  # Start all services whose startup is 'always', without the manager service
+  smc service start`
+
+var optServiceSpecFile string
+
+func init() {
+	common.RootCmd.AddCommand(serviceCmd)
+
+	serviceCmd.Example = serviceExample
+	serviceCmd.PersistentFlags().StringVar(&optServiceSpecFile, "spec", "", "System spec file (default ~/.costrict/share/system-spec.json)")
+}
+
+func loadSystemSpec() (*utils.SystemSpec, error) {
+	specFile := optServiceSpecFile
+	if specFile == "" {
+		specFile = utils.DefaultSystemSpecFile("")
+	}
+	spec := &utils.SystemSpec{}
+	if err := spec.Load(specFile); err != nil {
+		return nil, fmt.Errorf("load system spec '%s' failed: %v", specFile, err)
+	}
+	return spec, nil
+}
+
+/**
+ *	Load services declared in system-spec.json: the manager service first, then the others
+ */
+func loadServices() ([]utils.ServiceSpec, error) {
+	spec, err := loadSystemSpec()
+	if err != nil {
+		return nil, err
+	}
+	var services []utils.ServiceSpec
+	if spec.Manager.Service.Name != "" {
+		services = append(services, spec.Manager.Service)
+	}
+	services = append(services, spec.Services...)
+	return services, nil
+}
+
+/**
+ *	Select services by name, or services whose startup is 'always' if no name is given
+ *	The manager service (the keeper) starts the other services by itself, so that running it
+ *	together with them would run every service twice; it is only selected when named explicitly
+ */
+func selectServices(names []string) ([]utils.ServiceSpec, error) {
+	spec, err := loadSystemSpec()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		var selected []utils.ServiceSpec
+		for _, s := range spec.Services {
+			if s.Startup == utils.StartupAlways {
+				selected = append(selected, s)
+			}
+		}
+		return selected, nil
+	}
+	services, err := loadServices()
+	if err != nil {
+		return nil, err
+	}
+	var selected []utils.ServiceSpec
+	for _, name := range names {
+		found := false
+		for _, s := range services {
+			if s.Name == name {
+				selected = append(selected, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("service '%s' isn't declared in system spec", name)
+		}
+	}
+	return selected, nil
+}
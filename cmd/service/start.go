@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Time to wait for a supervisor to start its service
+ */
+const startTimeout = 5 * time.Second
+
+/**
+ *	Launch a background supervisor ('smc service run') for the service, and wait until the service is started
+ */
+func startService(spec utils.ServiceSpec) (utils.ServiceState, error) {
+	if state, err := utils.LoadServiceState("", spec.Name); err == nil && state.Active() {
+		return state, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return utils.ServiceState{}, err
+	}
+	args := []string{"service", "run", spec.Name}
+	if optServiceSpecFile != "" {
+		args = append(args, "--spec", optServiceSpecFile)
+	}
+	if err := os.MkdirAll(utils.ServiceRunDir(""), 0775); err != nil {
+		return utils.ServiceState{}, err
+	}
+	logFile, err := os.OpenFile(utils.ServiceLogFile("", spec.Name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return utils.ServiceState{}, err
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return utils.ServiceState{}, err
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		state, err := utils.LoadServiceState("", spec.Name)
+		if err != nil || state.SupervisorPid != pid {
+			continue
+		}
+		switch state.Status {
+		case utils.ServiceRunning:
+			return state, nil
+		case utils.ServiceExited, utils.ServiceDead:
+			return state, fmt.Errorf("service '%s' exited: %s", spec.Name, state.LastExit)
+		}
+	}
+	return utils.ServiceState{}, fmt.Errorf("service '%s' didn't start in %v, see '%s'", spec.Name,
+		startTimeout, utils.ServiceLogFile("", spec.Name))
+}
+
+/**
+ *	Start services and print their state
+ */
+func startServices(names []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	services, err := selectServices(names)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	var dataList []*orderedmap.OrderedMap
+	failed := 0
+	for _, s := range services {
+		state, err := startService(s)
+		row := Status_Columns{Name: s.Name, Status: state.Status, Pid: "-", Port: "-", Uptime: "-"}
+		if err != nil {
+			row.Status = fmt.Sprintf("failed: %v", err)
+			failed++
+		} else {
+			row.Pid = fmt.Sprint(state.Pid)
+			row.Port = fmt.Sprint(state.Port)
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	if len(dataList) == 0 {
+		fmt.Println("No service to start")
+		return nil
+	}
+	utils.PrintFormat(dataList)
+	if failed > 0 {
+		return fmt.Errorf("%d services failed to start", failed)
+	}
+	return nil
+}
+
+/**
+ *	Supervise the service in foreground until SIGINT/SIGTERM
+ */
+func runService(name string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	services, err := selectServices([]string{name})
+	if err != nil {
+		return err
+	}
+	if state, err := utils.LoadServiceState("", name); err == nil && state.Active() && state.SupervisorPid != os.Getpid() {
+		return fmt.Errorf("service '%s' is already supervised by process %d", name, state.SupervisorPid)
+	}
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	signal.Ignore(syscall.SIGHUP)
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+	return utils.NewSupervisor(services[0], "").Run(stop)
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start [service...]",
+	Short: "Start services in background",
+	Long: `Start the named services, or all services whose startup is 'always', each under a background supervisor which restarts it with backoff when it exits.
+The manager service (such as costrict) starts the other services by itself, it is only started when named`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return startServices(args)
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:    "run service",
+	Short:  "Run and supervise a service in foreground",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runService(args[0])
+	},
+}
+
+func init() {
+	serviceCmd.AddCommand(startCmd)
+	serviceCmd.AddCommand(runCmd)
+
+	startCmd.Example = `  # Start all services whose startup is 'always', without the manager service
+  smc service start
+  # Start codebase-indexer
+  smc service start codebase-indexer
+  # Start the manager service, which starts the other services by itself
+  smc service start costrict`
+	startCmd.SilenceUsage = true
+	runCmd.SilenceUsage = true
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Fields displayed in service status
+ */
+type Status_Columns struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Pid      string `json:"pid"`
+	Port     string `json:"port"`
+	Uptime   string `json:"uptime"`
+	Restarts int    `json:"restarts"`
+	LastExit string `json:"lastExit"`
+}
+
+func showStatus(names []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	var services []utils.ServiceSpec
+	var err error
+	if len(names) > 0 {
+		services, err = selectServices(names)
+	} else {
+		services, err = loadServices()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	var states []utils.ServiceState
+	for _, s := range services {
+		state, err := utils.LoadServiceState("", s.Name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			state = utils.ServiceState{Name: s.Name, Status: utils.ServiceStopped}
+		}
+		states = append(states, state)
+	}
+	if optStatusJson {
+		data, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	var dataList []*orderedmap.OrderedMap
+	for _, state := range states {
+		row := Status_Columns{
+			Name:     state.Name,
+			Status:   state.Status,
+			Pid:      "-",
+			Port:     "-",
+			Uptime:   "-",
+			Restarts: state.Restarts,
+			LastExit: state.LastExit,
+		}
+		if state.Active() {
+			row.Port = fmt.Sprint(state.Port)
+		}
+		if state.Status == utils.ServiceRunning {
+			row.Pid = fmt.Sprint(state.Pid)
+			row.Uptime = time.Since(state.StartTime).Truncate(time.Second).String()
+		}
+		if optStatusVerbose {
+			fmt.Printf("%s: %s %s\n  log: %s\n", state.Name, state.Command, strings.Join(state.Args, " "), state.LogFile)
+		}
+		recordMap, _ := utils.StructToOrderedMap(row)
+		dataList = append(dataList, recordMap)
+	}
+	utils.PrintFormat(dataList)
+	return nil
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [service...]",
+	Short: "Show state of services",
+	Long:  `Show state of services: pid, actual port, uptime, restarts and the last exit reason`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showStatus(args)
+	},
+}
+
+var optStatusJson bool
+var optStatusVerbose bool
+
+func init() {
+	serviceCmd.AddCommand(statusCmd)
+
+	statusCmd.Example = `  smc service status
+  smc service status codebase-indexer --json`
+	statusCmd.Flags().SortFlags = false
+	statusCmd.Flags().BoolVar(&optStatusJson, "json", false, "Print the state as JSON")
+	statusCmd.Flags().BoolVarP(&optStatusVerbose, "verbose", "v", false, "Show command lines and log files as well")
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zgsm-ai/smc/cmd/common"
+	"github.com/zgsm-ai/smc/internal/utils"
+)
+
+/**
+ *	Stop services, all started services if no name is given
+ */
+func stopServices(names []string) error {
+	if err := common.InitCommonEnv(); err != nil {
+		return err
+	}
+	services, err := loadServices()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if len(names) > 0 {
+		if _, err := selectServices(names); err != nil {
+			fmt.Println(err)
+			return err
+		}
+	} else {
+		for _, s := range services {
+			names = append(names, s.Name)
+		}
+	}
+	failed := 0
+	for _, name := range names {
+		state, err := utils.LoadServiceState("", name)
+		if err != nil || !state.Active() { //never started or already stopped
+			continue
+		}
+		if err := utils.StopService("", name, time.Duration(optStopTimeout)*time.Second); err != nil {
+			fmt.Printf("Stop service '%s' failed: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Service '%s' is stopped\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d services failed to stop", failed)
+	}
+	return nil
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop [service...]",
+	Short: "Stop services",
+	Long:  `Stop the named services, or all running services, together with their supervisors`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stopServices(args)
+	},
+}
+
+var restartCmd = &cobra.Command{
+	Use:   "restart [service...]",
+	Short: "Restart services",
+	Long:  `Stop and then start the named services, or all services whose startup is 'always'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := stopServices(args); err != nil {
+			return err
+		}
+		return startServices(args)
+	},
+}
+
+var optStopTimeout int
+
+func init() {
+	serviceCmd.AddCommand(stopCmd)
+	serviceCmd.AddCommand(restartCmd)
+
+	stopCmd.Example = `  # Stop all services
+  smc service stop
+  # Stop codebase-indexer
+  smc service stop codebase-indexer`
+	restartCmd.Example = `  smc service restart codebase-indexer`
+	stopCmd.SilenceUsage = true
+	restartCmd.SilenceUsage = true
+	stopCmd.Flags().IntVarP(&optStopTimeout, "timeout", "t", 10, "Seconds to wait for a service to stop")
+	restartCmd.Flags().IntVarP(&optStopTimeout, "timeout", "t", 10, "Seconds to wait for a service to stop")
+}
@@ -5,15 +5,16 @@ package cmd
 
 import (
 	_ "github.com/zgsm-ai/smc/cmd/cert"
+	_ "github.com/zgsm-ai/smc/cmd/client"
 	_ "github.com/zgsm-ai/smc/cmd/component"
 	_ "github.com/zgsm-ai/smc/cmd/config"
 	_ "github.com/zgsm-ai/smc/cmd/extension"
 	_ "github.com/zgsm-ai/smc/cmd/package"
 	_ "github.com/zgsm-ai/smc/cmd/pool"
 	_ "github.com/zgsm-ai/smc/cmd/prompt"
+	_ "github.com/zgsm-ai/smc/cmd/service"
 	_ "github.com/zgsm-ai/smc/cmd/task"
 	_ "github.com/zgsm-ai/smc/cmd/template"
 	_ "github.com/zgsm-ai/smc/cmd/tool"
 	_ "github.com/zgsm-ai/smc/cmd/variable"
-	_ "github.com/zgsm-ai/smc/cmd/client"	
 )
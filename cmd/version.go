@@ -37,4 +37,10 @@ func init() {
 	common.RootCmd.AddCommand(versionCmd)
 
 	versionCmd.Example = `  smc version`
+
+	//	Enables 'smc --version', which packages may declare as their health probe
+	common.RootCmd.Version = SoftwareVer
+	if common.RootCmd.Version == "" {
+		common.RootCmd.Version = "dev"
+	}
 }
@@ -11,6 +11,7 @@ require (
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/iancoleman/orderedmap v0.3.0
 	github.com/jedib0t/go-pretty/v6 v6.6.7
+	github.com/klauspost/compress v1.18.0
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.5.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -26,8 +26,20 @@ var (
 	Logfile       string //Log file
 	Debug         string //Debug level(Off,Err,Dbg), controls output verbosity
 	SkipSSL       bool   //skip ssl verify:InsecureSkipVerify
+	VerifyPolicy  string //Package verification policy(compat,strict)
+	IndexPolicy   string //Index verification policy(strict,compat)
+	PreRelease    bool   //Accept pre-release versions when upgrading automatically
+	Channel       string //Release channel subscribed to(stable,beta,nightly...)
+	CacheKeep     int    //Versions of each package kept in the package cache
+	CacheMaxSize  string //Max total size of the package cache(such as 2G), empty for unlimited
+	CacheMaxAge   string //Max age of cached versions(such as 90d), empty for unlimited
 )
 
+/**
+ *	Release channel names: lowercase letters, digits, '_' and '-', such as stable, beta, nightly
+ */
+var ChannelExp = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
 /**
  *	Default environment variable registry
  */
@@ -76,6 +88,23 @@ func InitEnvs() {
 		"Costrict vscode version", "", NewString(&VscodeVersion))
 	defEnvs.Register("SMC_SKIP_SSL", "skipSsl",
 		"Skip SSL verification", "false", NewBool(&SkipSSL))
+	policyExp := regexp.MustCompile(`^(compat|strict)$`)
+	defEnvs.Register("SMC_VERIFY_POLICY", "verifyPolicy",
+		"Package verification policy: compat (accept legacy md5 and checksum-only signed packages), strict", "compat", NewLimitedString(&VerifyPolicy, policyExp))
+	defEnvs.Register("SMC_INDEX_POLICY", "indexPolicy",
+		"Index verification policy: strict, compat (accept unsigned platform.json/platforms.json never seen signed)", "strict", NewLimitedString(&IndexPolicy, policyExp))
+	defEnvs.Register("SMC_ALLOW_PRERELEASE", "allowPreRelease",
+		"Accept pre-release versions (such as 1.2.0-beta.1) when upgrading automatically", "false", NewBool(&PreRelease))
+	defEnvs.Register("SMC_CHANNEL", "channel",
+		"Release channel used when upgrading to the newest version: stable,beta,nightly...", "stable", NewLimitedString(&Channel, ChannelExp))
+	defEnvs.Register("SMC_CACHE_KEEP", "cacheKeep",
+		"Versions of each package kept in the package cache", "3", NewInt(&CacheKeep))
+	sizeExp := regexp.MustCompile(`^([0-9]+[KMGT]?)?$`)
+	defEnvs.Register("SMC_CACHE_MAX_SIZE", "cacheMaxSize",
+		"Max total size of the package cache, such as 500M or 2G, empty for unlimited", "", NewLimitedString(&CacheMaxSize, sizeExp))
+	ageExp := regexp.MustCompile(`^([0-9]+[smhd])?$`)
+	defEnvs.Register("SMC_CACHE_MAX_AGE", "cacheMaxAge",
+		"Max age of cached versions, such as 90d, empty for unlimited", "", NewLimitedString(&CacheMaxAge, ageExp))
 
 	defEnvs.Load(ConfigPath(".smc/smc.env"))
 	defEnvs.SetOnChange(func() error {
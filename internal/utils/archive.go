@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ *	archive包解压后的文件清单，保存在包描述文件旁边: package/{package}-{ver}.files.json
+ */
+type PackageManifest struct {
+	Dir   string   `json:"dir"`   //解压目录
+	Files []string `json:"files"` //解压出的文件，相对解压目录的路径
+}
+
+/**
+ *	判断文件名是否是支持的压缩包格式
+ */
+func IsArchiveFile(fname string) bool {
+	name := strings.ToLower(fname)
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+/**
+ *	把dir和压缩包内的文件名name拼接成目标路径，拒绝绝对路径和跳出dir的路径
+ */
+func safeJoin(dir, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return filepath.Join(dir, cleaned), nil
+}
+
+/**
+ *	解压过程中的状态
+ */
+type extractor struct {
+	dir   string
+	files []string
+}
+
+/**
+ *	把一个文件写入解压目录，记录到文件清单
+ */
+func (e *extractor) writeFile(name string, mode os.FileMode, r io.Reader) error {
+	fpath, err := safeJoin(e.dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	rel, _ := filepath.Rel(e.dir, fpath)
+	e.files = append(e.files, filepath.ToSlash(rel))
+	return nil
+}
+
+func (e *extractor) extractTarGz(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := safeJoin(e.dir, hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		default: //链接等特殊文件可能指向解压目录外，不予支持
+			log.Printf("Ignore '%s' in archive '%s': unsupported type '%c'\n", hdr.Name, fname, hdr.Typeflag)
+		}
+	}
+}
+
+func (e *extractor) extractZip(fname string) error {
+	zr, err := zip.OpenReader(fname)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if _, err := safeJoin(e.dir, zf.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			log.Printf("Ignore '%s' in archive '%s': unsupported mode '%v'\n", zf.Name, fname, mode)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = e.writeFile(zf.Name, mode, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ *	把压缩包fname解压到目录dir，返回解压出的文件清单
+ *	@description
+ *	- 先解压到临时目录{dir}.partial，全部成功后再移入dir，避免非法的压缩包留下部分文件
+ *	- 只解压普通文件，拒绝绝对路径及含有'..'跳出解压目录的文件
+ */
+func ExtractArchive(fname, dir string) (PackageManifest, error) {
+	manifest := PackageManifest{Dir: dir}
+	staging := dir + ".partial"
+	if err := os.RemoveAll(staging); err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(staging)
+
+	e := &extractor{dir: staging}
+	var err error
+	lower := strings.ToLower(fname)
+	if strings.HasSuffix(lower, ".zip") {
+		err = e.extractZip(fname)
+	} else if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+		err = e.extractTarGz(fname)
+	} else {
+		err = fmt.Errorf("unsupported archive format: %s", fname)
+	}
+	if err != nil {
+		return manifest, err
+	}
+	for _, name := range e.files {
+		src := filepath.Join(staging, filepath.FromSlash(name))
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return manifest, err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return manifest, err
+		}
+	}
+	sort.Strings(e.files)
+	manifest.Files = e.files
+	return manifest, nil
+}
+
+func (m *PackageManifest) Load(fname string) error {
+	bytes, err := os.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+func (m *PackageManifest) Save(fname string) error {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, bytes, 0644)
+}
+
+/**
+ *	删除清单中的文件，以及因此变空的目录(不会删除清单之外的文件)
+ */
+func (m *PackageManifest) Remove() error {
+	dirs := map[string]bool{m.Dir: true}
+	for _, name := range m.Files {
+		fpath, err := safeJoin(m.Dir, name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for d := filepath.Dir(fpath); d != m.Dir && strings.HasPrefix(d, m.Dir); d = filepath.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	//	先删除深层目录
+	var sorted []string
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	for _, d := range sorted {
+		if isDirEmpty(d) {
+			os.Remove(d)
+		}
+	}
+	return nil
+}
+
+/**
+ *	archive包的解压目录
+ *	- 指定了TargetPath：{TargetPath}/{ver}
+ *	- FileName含有目录：{BaseDir}/{FileName所在目录}/{ver}
+ *	- 其它：{BaseDir}/lib/{package}/{ver}
+ */
+func (u *Upgrader) archiveDir(pkg PackageVersion) string {
+	ver := pkg.VersionId.String()
+	if u.TargetPath != "" {
+		return filepath.Join(u.TargetPath, ver)
+	}
+	if dir, _ := filepath.Split(pkg.FileName); dir != "" {
+		return filepath.Join(u.BaseDir, dir, ver)
+	}
+	return filepath.Join(u.BaseDir, "lib", u.packageName, ver)
+}
+
+/**
+ *	archive包的文件清单路径
+ */
+func (u *Upgrader) manifestFile(ver VersionNumber) string {
+	return filepath.Join(u.packageDir, fmt.Sprintf("%s-%s.files.json", u.packageName, ver.String()))
+}
+
+/**
+ *	解压archive包到版本目录，并在包描述文件旁记录文件清单
+ */
+func (u *Upgrader) extractPackage(pkg PackageVersion, cacheFname string) error {
+	dir := u.archiveDir(pkg)
+	manifest, err := ExtractArchive(cacheFname, dir)
+	if err != nil {
+		return err
+	}
+	//	重新安装同一版本时，删除旧清单中有、新清单中没有的文件
+	var old PackageManifest
+	if err := old.Load(u.manifestFile(pkg.VersionId)); err == nil {
+		keep := make(map[string]bool)
+		for _, f := range manifest.Files {
+			keep[f] = true
+		}
+		var stale []string
+		for _, f := range old.Files {
+			if !keep[f] {
+				stale = append(stale, f)
+			}
+		}
+		old.Files = stale
+		old.Remove()
+	}
+	return manifest.Save(u.manifestFile(pkg.VersionId))
+}
+
+/**
+ *	删除archive包某个版本解压出的文件及其清单，清单不存在则不做任何事
+ */
+func (u *Upgrader) removeManifestFiles(ver VersionNumber) error {
+	fname := u.manifestFile(ver)
+	var manifest PackageManifest
+	if err := manifest.Load(fname); err != nil {
+		return nil
+	}
+	if err := manifest.Remove(); err != nil {
+		return err
+	}
+	return os.Remove(fname)
+}
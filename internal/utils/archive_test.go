@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTarGz(t *testing.T, fname string, files map[string]string) {
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	zw.Close()
+}
+
+func writeZip(t *testing.T, fname string, files map[string]string) {
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+}
+
+// TestExtractArchive checks extraction of tar.gz/zip packages and path traversal protection
+func TestExtractArchive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"bin/tool": "tool", "models/a.bin": "aaa", "README": "readme"}
+	writeTarGz(t, filepath.Join(dir, "good.tar.gz"), files)
+	writeZip(t, filepath.Join(dir, "good.zip"), files)
+	for _, name := range []string{"good.tar.gz", "good.zip"} {
+		out := filepath.Join(dir, name+".out")
+		m, err := ExtractArchive(filepath.Join(dir, name), out)
+		if err != nil || len(m.Files) != 3 {
+			t.Fatalf("ExtractArchive(%s) = %v, %v", name, m.Files, err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(out, "models", "a.bin")); string(data) != "aaa" {
+			t.Errorf("%s: extracted content mismatch", name)
+		}
+	}
+
+	evil := map[string]string{"ok.txt": "ok", "../../escape.txt": "evil"}
+	writeTarGz(t, filepath.Join(dir, "evil.tar.gz"), evil)
+	writeZip(t, filepath.Join(dir, "evil.zip"), evil)
+	for _, name := range []string{"evil.tar.gz", "evil.zip"} {
+		out := filepath.Join(dir, "x", "y", name+".out")
+		if _, err := ExtractArchive(filepath.Join(dir, name), out); err == nil {
+			t.Errorf("%s: path traversal accepted", name)
+		}
+		if _, err := os.Stat(filepath.Join(out, "ok.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: partial extraction left files", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Error("file escaped extraction directory")
+	}
+}
+
+// TestArchivePackage checks installing and removing an archive package by its manifest
+func TestArchivePackage(t *testing.T) {
+	u := NewUpgrader("models", UpgradeConfig{BaseDir: t.TempDir()})
+	pkg := PackageVersion{PackageName: "models", PackageType: PackageTypeArchive,
+		FileName: "share/models/models.tar.gz", VersionId: VersionNumber{Major: 1, Minor: 0, Micro: 0}}
+	if err := pkg.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := filepath.Join(u.packageDir, "1.0.0")
+	os.MkdirAll(cacheDir, 0775)
+	writeTarGz(t, filepath.Join(cacheDir, "models.tar.gz"), map[string]string{"a.bin": "a", "sub/b.bin": "b"})
+	pkg.Save(filepath.Join(u.packageDir, "models-1.0.0.json"))
+	if err := u.activatePackage(pkg); err != nil {
+		t.Fatalf("activatePackage error: %v", err)
+	}
+	dir := filepath.Join(u.BaseDir, "share", "models", "1.0.0")
+	if data, _ := os.ReadFile(filepath.Join(dir, "sub", "b.bin")); string(data) != "b" {
+		t.Fatal("archive not extracted to versioned directory")
+	}
+	var m PackageManifest
+	if err := m.Load(filepath.Join(u.packageDir, "models-1.0.0.files.json")); err != nil || len(m.Files) != 2 {
+		t.Fatalf("manifest = %v, %v", m, err)
+	}
+
+	// Files not in the manifest are kept
+	os.WriteFile(filepath.Join(dir, "user.cfg"), []byte("keep"), 0644)
+	if err := u.RemovePackage(nil); err != nil {
+		t.Fatalf("RemovePackage error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.bin")); !os.IsNotExist(err) {
+		t.Error("manifest file not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub")); !os.IsNotExist(err) {
+		t.Error("empty directory not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user.cfg")); err != nil {
+		t.Error("file outside manifest removed")
+	}
+	if _, err := os.Stat(filepath.Join(u.packageDir, "models-1.0.0.files.json")); !os.IsNotExist(err) {
+		t.Error("manifest not removed")
+	}
+}
@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ *	检查项
+ */
+const (
+	AuditDescriptor = "descriptor" //包描述文件内容或位置不正确
+	AuditSize       = "size"       //包文件大小不符
+	AuditChecksum   = "checksum"   //包文件散列值不符
+	AuditSignature  = "signature"  //包或索引的签名无效
+	AuditIndex      = "index"      //索引文件无法解析或内容不一致
+	AuditMissing    = "missing"    //索引引用的文件不存在
+	AuditOrphan     = "orphan"     //存在于目录中但没有被索引引用
+)
+
+/**
+ *	检查发现的一个问题
+ */
+type AuditIssue struct {
+	Path    string `json:"path"`    //相对仓库目录的路径
+	Check   string `json:"check"`   //检查项
+	Message string `json:"message"` //问题描述
+}
+
+/**
+ *	仓库完整性检查报告
+ */
+type AuditReport struct {
+	Dir         string       `json:"dir"`         //仓库目录
+	Descriptors int          `json:"descriptors"` //检查的包描述文件数
+	Indexes     int          `json:"indexes"`     //检查的索引文件数
+	Issues      []AuditIssue `json:"issues"`      //发现的问题
+	Passed      bool         `json:"passed"`      //没有问题
+}
+
+type auditor struct {
+	u      *Upgrader
+	dir    string
+	report *AuditReport
+}
+
+func (a *auditor) fail(fpath, check, format string, args ...interface{}) {
+	rel, err := filepath.Rel(a.dir, fpath)
+	if err != nil {
+		rel = fpath
+	}
+	a.report.Issues = append(a.report.Issues, AuditIssue{
+		Path:    filepath.ToSlash(rel),
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+/**
+ *	把索引中的地址(如/app/linux/amd64/1.0.0/package.json)转换为仓库中的文件路径
+ */
+func (a *auditor) urlPath(url string) (string, error) {
+	return safeJoin(a.dir, strings.TrimPrefix(path.Clean("/"+url), "/"))
+}
+
+func (a *auditor) exists(url string) bool {
+	fpath, err := a.urlPath(url)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(fpath)
+	return err == nil && !info.IsDir()
+}
+
+/**
+ *	检查包描述文件：位置、内容、包文件大小、散列值及签名
+ */
+func (a *auditor) checkDescriptor(fpath string) {
+	a.report.Descriptors++
+	var pkg PackageVersion
+	if err := pkg.Load(fpath); err != nil {
+		a.fail(fpath, AuditDescriptor, "load failed: %v", err)
+		return
+	}
+	if err := pkg.Verify(); err != nil {
+		a.fail(fpath, AuditDescriptor, "%v", err)
+		return
+	}
+	verDir := filepath.Dir(fpath)
+	rel, _ := filepath.Rel(a.dir, verDir)
+	expected := filepath.Join(pkg.PackageName, pkg.Os, pkg.Arch, pkg.VersionId.String())
+	if rel != expected {
+		a.fail(fpath, AuditDescriptor, "descriptor of %s should be in %s", pkg.PackageName, filepath.ToSlash(expected))
+	}
+	dataFile := filepath.Join(verDir, filepath.Base(pkg.FileName))
+	algo := pkg.ChecksumAlgo
+	if algo == "" {
+		algo = ChecksumMd5
+	}
+	if algo == ChecksumMd5 && a.u.Policy != VerifyPolicyCompat {
+		a.fail(fpath, AuditChecksum, "checksum algorithm '%s' is not allowed by policy '%s'", algo, a.u.Policy)
+	}
+	size, sum, err := CalcFileChecksum(dataFile, algo)
+	if err != nil {
+		a.fail(dataFile, AuditMissing, "package file: %v", err)
+		return
+	}
+	if size != pkg.Size {
+		a.fail(dataFile, AuditSize, "size %d, descriptor says %d", size, pkg.Size)
+	}
+	if sum != pkg.Checksum {
+		a.fail(dataFile, AuditChecksum, "%s %s, descriptor says %s", algo, sum, pkg.Checksum)
+		return
+	}
+	if err := a.u.verifyPackageSign(pkg); err != nil {
+		a.fail(fpath, AuditSignature, "%v", err)
+	}
+}
+
+/**
+ *	读取并验证索引文件的签名和有效期，解析到obj
+ */
+func (a *auditor) loadIndex(fpath string, obj interface{}) bool {
+	a.report.Indexes++
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		a.fail(fpath, AuditMissing, "%v", err)
+		return false
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		a.fail(fpath, AuditIndex, "unmarshal failed: %v", err)
+		return false
+	}
+	rel, _ := filepath.Rel(a.dir, fpath)
+	if _, err := a.u.verifyIndexSignature(filepath.ToSlash(rel), data); err != nil {
+		a.fail(fpath, AuditSignature, "%v", err)
+	}
+	return true
+}
+
+/**
+ *	检查platform.json：最新版本、通道及分阶段发布引用的版本都已列出，列出的文件都存在，版本目录都被列出
+ */
+func (a *auditor) checkPlatform(platDir string) *PlatformInfo {
+	fpath := filepath.Join(platDir, "platform.json")
+	plat := &PlatformInfo{}
+	if !a.loadIndex(fpath, plat) {
+		return nil
+	}
+	listed := make(map[string]bool)
+	for _, v := range plat.Versions {
+		ver := v.VersionId.String()
+		listed[ver] = true
+		if !a.exists(v.InfoUrl) {
+			a.fail(fpath, AuditMissing, "descriptor of %s '%s' doesn't exist", ver, v.InfoUrl)
+		} else if fp, _ := a.urlPath(v.InfoUrl); fp != "" {
+			var pkg PackageVersion
+			if err := pkg.Load(fp); err == nil && CompareVersion(pkg.VersionId, v.VersionId) != 0 {
+				a.fail(fpath, AuditIndex, "'%s' is version %s, listed as %s", v.InfoUrl, pkg.VersionId.String(), ver)
+			}
+		}
+		if !a.exists(v.AppUrl) {
+			a.fail(fpath, AuditMissing, "package file of %s '%s' doesn't exist", ver, v.AppUrl)
+		}
+		for _, d := range v.Deltas {
+			if !a.exists(d.Url) {
+				a.fail(fpath, AuditMissing, "delta of %s '%s' doesn't exist", ver, d.Url)
+			}
+		}
+	}
+	if len(plat.Versions) == 0 {
+		a.fail(fpath, AuditIndex, "no version is listed")
+	} else if plat.Newest.InfoUrl == "" || !listed[plat.Newest.VersionId.String()] {
+		a.fail(fpath, AuditIndex, "newest version %s isn't listed", plat.Newest.VersionId.String())
+	}
+	channels := make([]string, 0, len(plat.Channels))
+	for name := range plat.Channels {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	for _, name := range channels {
+		addr := plat.Channels[name]
+		if ver := addr.VersionId.String(); !listed[ver] {
+			a.fail(fpath, AuditIndex, "version %s of channel '%s' isn't listed", ver, name)
+		}
+	}
+	for _, rule := range plat.Rollouts {
+		if ver := rule.VersionId.String(); !listed[ver] {
+			a.fail(fpath, AuditIndex, "version %s of rollout isn't listed", ver)
+		}
+	}
+	entries, _ := os.ReadDir(platDir)
+	for _, e := range entries {
+		if e.IsDir() && !listed[e.Name()] {
+			a.fail(filepath.Join(platDir, e.Name()), AuditOrphan, "version directory isn't listed in platform.json")
+		}
+	}
+	return plat
+}
+
+/**
+ *	检查platforms.json：列出的平台与目录一致，各平台的最新版本与platform.json一致
+ */
+func (a *auditor) checkPackage(pkgDir string) {
+	fpath := filepath.Join(pkgDir, "platforms.json")
+	var ov PackageOverview
+	hasOverview := a.loadIndex(fpath, &ov)
+	listed := make(map[string]bool)
+	for _, p := range ov.Platforms {
+		listed[p.Os+"/"+p.Arch] = true
+	}
+	platFiles, _ := filepath.Glob(filepath.Join(pkgDir, "*", "*", "platform.json"))
+	for _, pf := range platFiles {
+		platDir := filepath.Dir(pf)
+		osName, arch := filepath.Base(filepath.Dir(platDir)), filepath.Base(platDir)
+		plat := a.checkPlatform(platDir)
+		if !hasOverview {
+			continue
+		}
+		key := osName + "/" + arch
+		if !listed[key] {
+			a.fail(platDir, AuditOrphan, "platform isn't listed in platforms.json")
+			continue
+		}
+		delete(listed, key)
+		platOv, ok := ov.Overviews[osName+"-"+arch]
+		if !ok {
+			a.fail(fpath, AuditIndex, "overview of %s doesn't exist", key)
+		} else if plat != nil && CompareVersion(platOv.Newest.VersionId, plat.Newest.VersionId) != 0 {
+			a.fail(fpath, AuditIndex, "newest version of %s is %s, platform.json says %s",
+				key, platOv.Newest.VersionId.String(), plat.Newest.VersionId.String())
+		}
+	}
+	var missing []string
+	for key := range listed {
+		missing = append(missing, key)
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		a.fail(fpath, AuditMissing, "platform.json of %s doesn't exist", key)
+	}
+	// 有版本目录但没有生成platform.json的平台
+	verDirs, _ := filepath.Glob(filepath.Join(pkgDir, "*", "*", "*", "package.json"))
+	reported := make(map[string]bool)
+	for _, vf := range verDirs {
+		platDir := filepath.Dir(filepath.Dir(vf))
+		if _, err := os.Stat(filepath.Join(platDir, "platform.json")); os.IsNotExist(err) && !reported[platDir] {
+			reported[platDir] = true
+			a.fail(platDir, AuditMissing, "platform.json doesn't exist")
+		}
+	}
+}
+
+/**
+ *	检查构建好的仓库目录dir，用于上传前把关
+ *	@description
+ *	- 每个package.json：包文件的大小、散列值及签名(用cfg指定的公钥/信任库验证)
+ *	- 每个platforms.json/platform.json：签名及有效期，最新版本存在，所有版本都被列出，没有孤立的版本目录
+ *	- 根目录有packages.json时检查签名及列出的包都存在
+ */
+func AuditRepository(dir string, cfg UpgradeConfig) AuditReport {
+	a := &auditor{u: NewUpgrader("", cfg), dir: dir, report: &AuditReport{Dir: dir}}
+	filepath.Walk(dir, func(fpath string, f os.FileInfo, err error) error {
+		if err != nil {
+			a.fail(fpath, AuditMissing, "%v", err)
+			return nil
+		}
+		if !f.IsDir() && f.Name() == "package.json" {
+			a.checkDescriptor(fpath)
+		}
+		return nil
+	})
+	pkgs := make(map[string]bool)
+	descs, _ := filepath.Glob(filepath.Join(dir, "*", "*", "*", "*", "package.json"))
+	for _, d := range descs {
+		pkgs[filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(d))))] = true
+	}
+	overviews, _ := filepath.Glob(filepath.Join(dir, "*", "platforms.json"))
+	for _, ov := range overviews {
+		pkgs[filepath.Dir(ov)] = true
+	}
+	var pkgDirs []string
+	for d := range pkgs {
+		pkgDirs = append(pkgDirs, d)
+	}
+	sort.Strings(pkgDirs)
+	for _, d := range pkgDirs {
+		a.checkPackage(d)
+	}
+	listFile := filepath.Join(dir, "packages.json")
+	if _, err := os.Stat(listFile); err == nil {
+		var list PackageList
+		if a.loadIndex(listFile, &list) {
+			for _, name := range list.Packages {
+				if !pkgs[filepath.Join(dir, name)] {
+					a.fail(listFile, AuditMissing, "package '%s' doesn't exist", name)
+				}
+			}
+		}
+	}
+	a.report.Passed = len(a.report.Issues) == 0
+	return *a.report
+}
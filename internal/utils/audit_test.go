@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAuditRepository checks a signed repository passes, and tampered files and orphan versions are reported
+func TestAuditRepository(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	repo := t.TempDir()
+	platDir := filepath.Join(repo, "app", "linux", "amd64")
+	verDir := filepath.Join(platDir, "1.0.0")
+	os.MkdirAll(verDir, 0775)
+	appFile := filepath.Join(verDir, "app")
+	os.WriteFile(appFile, testContent(1000), 0644)
+	size, sum, _ := CalcFileChecksum(appFile, ChecksumSha256)
+	pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+		Os: "linux", Arch: "amd64", Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256,
+		VersionId: VersionNumber{Major: 1}}
+	signPackage(priKey, &pkg)
+	pkg.Save(filepath.Join(verDir, "package.json"))
+
+	expires := time.Now().Add(time.Hour)
+	addr := VersionAddr{VersionId: pkg.VersionId, AppUrl: "/app/linux/amd64/1.0.0/app", InfoUrl: "/app/linux/amd64/1.0.0/package.json"}
+	data, _ := json.Marshal(PlatformInfo{PackageName: "app", Os: "linux", Arch: "amd64", Newest: addr, Versions: []VersionAddr{addr}})
+	data, _ = SignIndex(priKey, data, 1, expires)
+	os.WriteFile(filepath.Join(platDir, "platform.json"), data, 0644)
+	ov := PackageOverview{PackageName: "app", Platforms: []PlatformId{{Os: "linux", Arch: "amd64"}},
+		Overviews: map[string]PlatformOverview{"linux-amd64": {Os: "linux", Arch: "amd64", Newest: VersionOverview{VersionId: pkg.VersionId}}}}
+	data, _ = json.Marshal(ov)
+	data, _ = SignIndex(priKey, data, 1, expires)
+	os.WriteFile(filepath.Join(repo, "app", "platforms.json"), data, 0644)
+
+	cfg := UpgradeConfig{BaseDir: t.TempDir(), PublicKey: string(pubKey), Policy: VerifyPolicyStrict}
+	report := AuditRepository(repo, cfg)
+	if !report.Passed || report.Descriptors != 1 || report.Indexes != 2 {
+		t.Fatalf("report of a good repository = %+v", report)
+	}
+
+	otherKey, _, _ := GenKeys(KeyTypeEd25519)
+	cfg.PublicKey = string(otherKey)
+	if report := AuditRepository(repo, cfg); report.Passed {
+		t.Error("repository signed by an untrusted key passes")
+	}
+
+	cfg.PublicKey = string(pubKey)
+	os.WriteFile(appFile, testContent(999), 0644)
+	os.MkdirAll(filepath.Join(platDir, "0.9.0"), 0775)
+	report = AuditRepository(repo, cfg)
+	checks := make(map[string]string)
+	for _, issue := range report.Issues {
+		checks[issue.Check] = issue.Path
+	}
+	if report.Passed || checks[AuditSize] != "app/linux/amd64/1.0.0/app" || checks[AuditChecksum] == "" ||
+		checks[AuditOrphan] != "app/linux/amd64/0.9.0" {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+}
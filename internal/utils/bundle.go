@@ -0,0 +1,405 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/**
+ *	离线包的清单文件名，位于离线包(tar.gz)的根目录
+ */
+const BundleManifestName = "bundle.json"
+
+/**
+ *	离线包中的一个文件
+ */
+type BundleFile struct {
+	Name     string `json:"name"`     //文件在离线包中的路径，与云端仓库的路径相同
+	Size     int64  `json:"size"`     //文件大小
+	Checksum string `json:"checksum"` //sha256
+}
+
+/**
+ *	离线包清单，签名方式与索引文件相同
+ *	离线包的目录结构与云端仓库相同:
+ *	- {package}/{os}/{arch}/platform.json
+ *	- {package}/{os}/{arch}/{ver}/package.json
+ *	- {package}/{os}/{arch}/{ver}/{filename}
+ */
+type BundleManifest struct {
+	IndexMeta
+	Created int64        `json:"created"` //导出时间(Unix时间戳，秒)
+	Files   []BundleFile `json:"files"`
+}
+
+/**
+ *	要导出的包：指定平台上的指定版本，没有指定版本则导出最新版本
+ */
+type BundleItem struct {
+	PackageName string
+	Os          string
+	Arch        string
+	Versions    []VersionNumber
+}
+
+/**
+ *	导出离线包的过程状态
+ */
+type bundleWriter struct {
+	tw       *tar.Writer
+	manifest BundleManifest
+}
+
+func (b *bundleWriter) addFile(name string, fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size, sum, err := CalcFileChecksum(fname, ChecksumSha256)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(b.tw, f); err != nil {
+		return err
+	}
+	b.manifest.Files = append(b.manifest.Files, BundleFile{Name: name, Size: int64(size), Checksum: sum})
+	return nil
+}
+
+func (b *bundleWriter) addData(name string, data []byte, tmpDir string) error {
+	fname := filepath.Join(tmpDir, "data")
+	if err := os.WriteFile(fname, data, 0644); err != nil {
+		return err
+	}
+	return b.addFile(name, fname)
+}
+
+/**
+ *	从云端下载一个平台的索引、包描述和包文件，加入离线包
+ *	下载的内容按在线升级的规则校验，不合法的包不会被导出
+ */
+func (u *Upgrader) exportPlatform(b *bundleWriter, vers []VersionNumber, tmpDir string) error {
+	prefix := path.Join(u.packageName, u.Os, u.Arch)
+	data, err := GetBytes(fmt.Sprintf("%s/%s/platform.json", u.BaseUrl, prefix), nil)
+	if err != nil {
+		return err
+	}
+	var plat PlatformInfo
+	if err = json.Unmarshal(data, &plat); err != nil {
+		return err
+	}
+	if err = u.verifyIndex(prefix+"/platform.json", data); err != nil {
+		return err
+	}
+	if err = b.addData(prefix+"/platform.json", data, tmpDir); err != nil {
+		return err
+	}
+	var addrs []VersionAddr
+	if len(vers) == 0 {
+		addr := u.newestVersion(plat, nil)
+		if addr.InfoUrl == "" {
+			return fmt.Errorf("no version of '%s' is released to this machine", u.packageName)
+		}
+		addrs = append(addrs, addr)
+	}
+	for _, ver := range vers {
+		found := false
+		for _, v := range plat.Versions {
+			if CompareVersion(v.VersionId, ver) == 0 {
+				addrs = append(addrs, v)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("version %s of '%s' isn't exist", ver.String(), prefix)
+		}
+	}
+	for _, addr := range addrs {
+		pkg, info, err := u.getPackageInfo(addr)
+		if err != nil {
+			return err
+		}
+		verDir := path.Join(prefix, pkg.VersionId.String())
+		_, fname := filepath.Split(pkg.FileName)
+		cacheFname := filepath.Join(tmpDir, fname)
+		opts := DefaultDownloadOptions
+		opts.Progress = u.Progress
+		if err = DownloadFile(u.BaseUrl+addr.AppUrl, nil, cacheFname, opts); err != nil {
+			return err
+		}
+		if err = u.verifyIntegrity(pkg, cacheFname); err != nil {
+			return err
+		}
+		if err = b.addData(verDir+"/package.json", info, tmpDir); err != nil {
+			return err
+		}
+		if err = b.addFile(verDir+"/"+fname, cacheFname); err != nil {
+			return err
+		}
+		os.Remove(cacheFname)
+		log.Printf("Export '%s' %s for %s/%s\n", u.packageName, pkg.VersionId.String(), u.Os, u.Arch)
+	}
+	return nil
+}
+
+/**
+ *	导出离线包到文件fname，用私钥priKey对清单签名(为空则不签名)，签名在expires后失效
+ */
+func ExportBundle(cfg UpgradeConfig, items []BundleItem, fname string, priKey []byte, expires time.Time) (BundleManifest, error) {
+	b := &bundleWriter{}
+	tmpDir, err := os.MkdirTemp("", "smc-bundle-*")
+	if err != nil {
+		return b.manifest, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	//	先把文件写入临时的tar，生成清单后，再把清单放在最前面写入最终的离线包
+	body := filepath.Join(tmpDir, "body.tar")
+	f, err := os.Create(body)
+	if err != nil {
+		return b.manifest, err
+	}
+	b.tw = tar.NewWriter(f)
+	for _, item := range items {
+		c := cfg
+		c.Os, c.Arch = item.Os, item.Arch
+		u := NewUpgrader(item.PackageName, c)
+		if err := u.exportPlatform(b, item.Versions, tmpDir); err != nil {
+			f.Close()
+			return b.manifest, fmt.Errorf("export '%s' for %s/%s failed: %v", item.PackageName, item.Os, item.Arch, err)
+		}
+	}
+	if err := b.tw.Close(); err != nil {
+		f.Close()
+		return b.manifest, err
+	}
+	f.Close()
+
+	b.manifest.Created = time.Now().Unix()
+	data, err := json.MarshalIndent(&b.manifest, "", "  ")
+	if err != nil {
+		return b.manifest, err
+	}
+	if len(priKey) > 0 {
+		if data, err = SignIndex(priKey, data, uint64(b.manifest.Created), expires); err != nil {
+			return b.manifest, err
+		}
+	}
+	err = writeAtomic(fname, 0644, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		tw := tar.NewWriter(zw)
+		hdr := &tar.Header{Name: BundleManifestName, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+		in, err := os.Open(body)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		tr := tar.NewReader(in)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+	return b.manifest, err
+}
+
+/**
+ *	离线索引的路径: package/offline/{package}/{os}/{arch}/platform.json
+ *	无法连接云端时，GetRemoteVersions使用离线索引
+ */
+func (u *Upgrader) offlineIndexFile() string {
+	return filepath.Join(u.packageDir, "offline", u.packageName, u.Os, u.Arch, "platform.json")
+}
+
+/**
+ *	校验离线包清单，以及解压到dir的文件与清单一致
+ */
+func (u *Upgrader) verifyBundle(dir string) (BundleManifest, error) {
+	var manifest BundleManifest
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if err != nil {
+		return manifest, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid bundle: %v", err)
+	}
+	//	离线包可能以任意顺序导入，所以只校验签名和有效期，不校验序号
+	if _, err = u.verifyIndexSignature(BundleManifestName, data); err != nil {
+		return manifest, err
+	}
+	listed := make(map[string]bool)
+	for _, f := range manifest.Files {
+		fpath, err := safeJoin(dir, f.Name)
+		if err != nil {
+			return manifest, err
+		}
+		size, sum, err := CalcFileChecksum(fpath, ChecksumSha256)
+		if err != nil {
+			return manifest, err
+		}
+		if int64(size) != f.Size || sum != f.Checksum {
+			return manifest, fmt.Errorf("file '%s' in bundle is corrupted", f.Name)
+		}
+		listed[filepath.ToSlash(filepath.Clean(filepath.FromSlash(f.Name)))] = true
+	}
+	//	拒绝清单之外的文件
+	err = filepath.WalkDir(dir, func(fpath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, fpath)
+		if rel = filepath.ToSlash(rel); rel != BundleManifestName && !listed[rel] {
+			return fmt.Errorf("file '%s' isn't listed in bundle manifest", rel)
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+/**
+ *	导入一个包：校验索引和包，保存离线索引，把包放入本地缓存
+ */
+func (u *Upgrader) importPlatform(dir string) ([]PackageVersion, error) {
+	platDir := filepath.Join(dir, u.packageName, u.Os, u.Arch)
+	data, err := os.ReadFile(filepath.Join(platDir, "platform.json"))
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s/%s/%s/platform.json", u.packageName, u.Os, u.Arch)
+	if err = u.verifyIndex(name, data); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(platDir)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []PackageVersion
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		verDir := filepath.Join(platDir, e.Name())
+		info, err := os.ReadFile(filepath.Join(verDir, "package.json"))
+		if err != nil {
+			return pkgs, err
+		}
+		var pkg PackageVersion
+		if err = json.Unmarshal(info, &pkg); err != nil {
+			return pkgs, err
+		}
+		if err = pkg.Verify(); err != nil {
+			return pkgs, err
+		}
+		if pkg.PackageName != u.packageName || pkg.VersionId.String() != e.Name() {
+			return pkgs, fmt.Errorf("package.json in '%s' doesn't match its path", verDir)
+		}
+		_, fname := filepath.Split(pkg.FileName)
+		if err = u.verifyIntegrity(pkg, filepath.Join(verDir, fname)); err != nil {
+			return pkgs, err
+		}
+		cacheDir := filepath.Join(u.packageDir, pkg.VersionId.String())
+		if err = os.MkdirAll(cacheDir, 0775); err != nil {
+			return pkgs, err
+		}
+		if err = copyFileAtomic(filepath.Join(verDir, fname), filepath.Join(cacheDir, fname), 0644); err != nil {
+			return pkgs, err
+		}
+		pkgFile := filepath.Join(u.packageDir, fmt.Sprintf("%s-%s.json", u.packageName, pkg.VersionId.String()))
+		if err = writeFileAtomic(pkgFile, info, 0644); err != nil {
+			return pkgs, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	offline := u.offlineIndexFile()
+	if err = os.MkdirAll(filepath.Dir(offline), 0775); err != nil {
+		return pkgs, err
+	}
+	return pkgs, writeFileAtomic(offline, data, 0644)
+}
+
+/**
+ *	导入离线包fname到本地包缓存，只导入本机平台(cfg.Os/cfg.Arch)的包
+ *	索引和包的校验与在线升级完全相同，导入后upgrade/activate可以在离线时使用
+ */
+func ImportBundle(cfg UpgradeConfig, fname string) ([]PackageVersion, error) {
+	u := NewUpgrader("", cfg)
+	stage := filepath.Join(u.packageDir, "offline.partial")
+	os.RemoveAll(stage)
+	defer os.RemoveAll(stage)
+	e := &extractor{dir: stage}
+	if err := e.extractTarGz(fname); err != nil {
+		return nil, fmt.Errorf("extract bundle '%s' failed: %v", fname, err)
+	}
+	manifest, err := u.verifyBundle(stage)
+	if err != nil {
+		return nil, err
+	}
+	//	清单中本机平台的包
+	names := make(map[string]bool)
+	for _, f := range manifest.Files {
+		dir, base := path.Split(f.Name)
+		if base != "platform.json" {
+			continue
+		}
+		dir, arch := path.Split(path.Clean(dir))
+		dir, osName := path.Split(path.Clean(dir))
+		if osName == u.Os && arch == u.Arch {
+			names[path.Clean(dir)] = true
+		}
+	}
+	var pkgNames []string
+	for name := range names {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+	var pkgs []PackageVersion
+	for _, name := range pkgNames {
+		pu := NewUpgrader(name, cfg)
+		imported, err := pu.importPlatform(stage)
+		pkgs = append(pkgs, imported...)
+		if err != nil {
+			return pkgs, fmt.Errorf("import '%s' failed: %v", name, err)
+		}
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBundle exports a signed bundle from a repository and upgrades from it without network
+func TestBundle(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	srcDir := t.TempDir()
+	content := testContent(4096)
+	appFile := filepath.Join(srcDir, "app")
+	os.WriteFile(appFile, content, 0644)
+	size, sum, _ := CalcFileChecksum(appFile, ChecksumSha256)
+
+	cfg := UpgradeConfig{PublicKey: string(pubKey), Policy: VerifyPolicyStrict, NoSetPath: true}
+	u := NewUpgrader("app", cfg)
+	pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+		Os: u.Os, Arch: u.Arch, Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256,
+		VersionId: VersionNumber{Major: 1, Minor: 2}, Probe: "none"}
+	signPackage(priKey, &pkg)
+	prefix := "/app/" + u.Os + "/" + u.Arch
+	addr := VersionAddr{VersionId: pkg.VersionId, AppUrl: prefix + "/1.2.0/app", InfoUrl: prefix + "/1.2.0/package.json"}
+	plat := PlatformInfo{PackageName: "app", Os: u.Os, Arch: u.Arch, Newest: addr, Versions: []VersionAddr{addr}}
+	platData, _ := json.Marshal(plat)
+	platData, err := SignIndex(priKey, platData, 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/platform.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(platData)
+	})
+	mux.HandleFunc(addr.InfoUrl, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pkg)
+	})
+	mux.HandleFunc(addr.AppUrl, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, appFile)
+	})
+	srv := httptest.NewServer(mux)
+
+	exportCfg := cfg
+	exportCfg.BaseDir = t.TempDir()
+	exportCfg.BaseUrl = srv.URL
+	bundle := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	items := []BundleItem{{PackageName: "app", Os: u.Os, Arch: u.Arch}}
+	if _, err := ExportBundle(exportCfg, items, bundle, priKey, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("ExportBundle: %v", err)
+	}
+	srv.Close()
+
+	// A bundle signed by an untrusted key is rejected
+	otherKey, _, _ := GenKeys(KeyTypeEd25519)
+	importCfg := cfg
+	importCfg.BaseDir = t.TempDir()
+	importCfg.BaseUrl = srv.URL
+	importCfg.PublicKey = string(otherKey)
+	if _, err := ImportBundle(importCfg, bundle); err == nil {
+		t.Error("bundle signed by an untrusted key is imported")
+	}
+
+	importCfg.PublicKey = string(pubKey)
+	pkgs, err := ImportBundle(importCfg, bundle)
+	if err != nil || len(pkgs) != 1 || pkgs[0].VersionId.String() != "1.2.0" {
+		t.Fatalf("ImportBundle = %+v, %v", pkgs, err)
+	}
+	// The repository is gone, upgrading uses the offline index and the cached package
+	ou := NewUpgrader("app", importCfg)
+	got, upgraded, err := ou.UpgradePackage(nil)
+	if err != nil || !upgraded || got.VersionId.String() != "1.2.0" {
+		t.Fatalf("offline UpgradePackage = %s, %v, %v", got.VersionId.String(), upgraded, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ou.installDir, "app")); string(data) != string(content) {
+		t.Error("installed file doesn't match the bundle")
+	}
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/zgsm-ai/smc/internal/env"
+)
+
+/**
+ *	默认的发布通道，它的最新版本就是platform.json中的newest
+ */
+const DefaultChannel = "stable"
+
+/**
+ *	检查通道名称，通道名称由小写字母、数字、'_'、'-'组成，如 stable、beta、nightly
+ */
+func CheckChannel(name string) error {
+	if !env.ChannelExp.MatchString(name) {
+		return fmt.Errorf("invalid channel name '%s'", name)
+	}
+	return nil
+}
+
+/**
+ *	获取通道name的最新版本
+ *	stable通道对应newest，兼容不认识通道的旧版本客户端
+ */
+func (p *PlatformInfo) GetChannel(name string) (VersionAddr, bool) {
+	if name == "" || name == DefaultChannel {
+		return p.Newest, p.Newest.InfoUrl != ""
+	}
+	addr, ok := p.Channels[name]
+	return addr, ok
+}
+
+/**
+ *	把通道name的最新版本设置为版本列表中的ver
+ */
+func (p *PlatformInfo) SetChannel(name string, ver VersionNumber) error {
+	if err := CheckChannel(name); err != nil {
+		return err
+	}
+	for _, v := range p.Versions {
+		if CompareVersion(v.VersionId, ver) != 0 {
+			continue
+		}
+		if name == DefaultChannel {
+			p.Newest = v
+			return nil
+		}
+		if p.Channels == nil {
+			p.Channels = make(map[string]VersionAddr)
+		}
+		p.Channels[name] = v
+		return nil
+	}
+	return fmt.Errorf("version '%s' not exist", ver.String())
+}
+
+/**
+ *	选择自动升级的目标版本
+ *	- 默认使用stable通道的最新版本(Newest)，但它是预发布版本时，改用最高的正式版本
+ *	- 允许预发布版本时，如果有高于Newest的预发布版本，则使用其中最高的
+ *	- 订阅了其它通道(如beta)时，使用该通道的最新版本，除非stable通道的版本更高
+ *	  通道是用户明确选择的，所以通道指向预发布版本时也会使用
+ *	- 本机(已安装版本cur，未安装为nil)不在选中版本的分阶段发布范围内时，退回到规则记录的版本或保持已安装的版本
+ *	  未安装且没有可安装的版本时返回空的地址
+ */
+func (u *Upgrader) newestVersion(plat PlatformInfo, cur *VersionNumber) VersionAddr {
+	newest := plat.Newest
+	if !u.AllowPreRelease && newest.VersionId.IsPreRelease() {
+		newest = VersionAddr{}
+		for _, v := range plat.Versions {
+			if !v.VersionId.IsPreRelease() && CompareVersion(v.VersionId, newest.VersionId) > 0 {
+				newest = v
+			}
+		}
+	} else if u.AllowPreRelease {
+		for _, v := range plat.Versions {
+			if v.VersionId.IsPreRelease() && CompareVersion(v.VersionId, newest.VersionId) > 0 {
+				newest = v
+			}
+		}
+	}
+	if u.Channel != DefaultChannel {
+		if addr, ok := plat.GetChannel(u.Channel); ok && CompareVersion(addr.VersionId, newest.VersionId) > 0 {
+			newest = addr
+		}
+	}
+	return u.rolloutFallback(&plat, newest, cur)
+}
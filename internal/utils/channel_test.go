@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestChannelVersion checks channel pointers and that subscribers get the channel's newest version
+func TestChannelVersion(t *testing.T) {
+	addr := func(s string) VersionAddr {
+		var v VersionNumber
+		v.Parse(s)
+		return VersionAddr{VersionId: v, InfoUrl: "/app/" + s + "/package.json"}
+	}
+	plat := PlatformInfo{Newest: addr("1.2.0"),
+		Versions: []VersionAddr{addr("1.1.0"), addr("1.2.0"), addr("1.3.0-beta.1"), addr("1.3.0")}}
+	beta := VersionNumber{Major: 1, Minor: 3, PreRelease: "beta.1"}
+	if err := plat.SetChannel("beta", beta); err != nil {
+		t.Fatalf("SetChannel: %v", err)
+	}
+	if err := plat.SetChannel("beta", VersionNumber{Major: 9}); err == nil {
+		t.Error("SetChannel with a missing version should fail")
+	}
+	if err := plat.SetChannel("Beta!", beta); err == nil {
+		t.Error("SetChannel with an invalid name should fail")
+	}
+
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir()})
+	for channel, want := range map[string]string{"stable": "1.2.0", "beta": "1.3.0-beta.1", "nightly": "1.2.0"} {
+		u.Channel = channel
+		if v := u.newestVersion(plat, nil).VersionId; v.String() != want {
+			t.Errorf("channel %s: newest = %s, want %s", channel, v.String(), want)
+		}
+	}
+
+	// Promoting to stable moves 'newest', which old clients understand; beta followers get it too
+	plat.SetChannel(DefaultChannel, VersionNumber{Major: 1, Minor: 3})
+	u.Channel = "beta"
+	if v := u.newestVersion(plat, nil).VersionId; v.String() != "1.3.0" {
+		t.Errorf("beta after stable promotion: newest = %s", v.String())
+	}
+	data, _ := json.Marshal(&plat)
+	var loaded PlatformInfo
+	json.Unmarshal(data, &loaded)
+	if got, ok := loaded.GetChannel("beta"); !ok || got.VersionId.String() != "1.3.0-beta.1" {
+		t.Errorf("channel lost after json round trip: %s", data)
+	}
+}
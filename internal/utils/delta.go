@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/**
+ *	差分包格式：zstd帧，以基础文件的全部内容作为原始字典(raw dictionary)，与 zstd --patch-from 相同
+ *	- 帧内不含字典ID，可以用 zstd -d --long=31 --patch-from={base} {delta} 手工还原
+ *	- 帧内含目标文件的大小及xxhash校验值，用错基础文件时还原失败
+ *	- 基础文件须整体读入内存作为字典，目标文件和还原的文件以流的方式读写
+ *	- 未采用bsdiff：生成时要为基础文件建立后缀数组，内存约为基础文件的17倍；zstd生成和还原都是流式的，还原时只需基础文件和窗口的内存
+ *	以smc自身相邻两次构建(Go程序，约25M)为例：差分包6.9M，zstd -19 --patch-from 为6.5M，完整的包gzip压缩后12.9M
+ */
+
+const deltaMaxWindow = zstd.MaxWindowSize //最远的引用距离，超过该大小的基础文件只有末尾部分可被引用
+
+/**
+ *	字典位于目标文件之前，目标文件末尾引用基础文件开头的距离为两者大小之和
+ *	引用距离取不小于该值的2的幂
+ */
+func deltaWindowSize(size int64) int {
+	w := zstd.MinWindowSize
+	for int64(w) < size && w < deltaMaxWindow {
+		w <<= 1
+	}
+	return w
+}
+
+/**
+ *	生成从基础文件baseFile升级到目标文件newFile的差分包deltaFile
+ *	返回差分包大小
+ */
+func MakeDelta(baseFile, newFile, deltaFile string) (int64, error) {
+	base, err := os.ReadFile(baseFile)
+	if err != nil {
+		return 0, err
+	}
+	in, err := os.Open(newFile)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(deltaFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(nil, zstd.WithEncoderDictRaw(0, base), zstd.WithWindowSize(deltaWindowSize(int64(len(base))+fi.Size())),
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return 0, err
+	}
+	zw.ResetContentSize(f, fi.Size())
+	if _, err := io.Copy(zw, in); err != nil {
+		zw.Close()
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if fi, err = f.Stat(); err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+/**
+ *	用基础文件baseFile和差分包deltaFile重建目标文件newFile
+ *	maxSize>0时，目标文件超过该大小则视为差分包非法
+ */
+func ApplyDelta(baseFile, deltaFile, newFile string, maxSize int64) error {
+	base, err := os.ReadFile(baseFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(deltaFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	window := deltaMaxWindow
+	if maxSize > 0 {
+		window = deltaWindowSize(int64(len(base)) + maxSize)
+	}
+	zr, err := zstd.NewReader(f, zstd.WithDecoderDictRaw(0, base), zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(uint64(window)))
+	if err != nil {
+		return fmt.Errorf("invalid delta file: %v", err)
+	}
+	defer zr.Close()
+
+	out, err := os.Create(newFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	var r io.Reader = zr
+	if maxSize > 0 {
+		r = io.LimitReader(zr, maxSize+1)
+	}
+	n, err := io.Copy(out, r)
+	if err != nil {
+		return fmt.Errorf("invalid delta file: %v", err)
+	}
+	if maxSize > 0 && n > maxSize {
+		return fmt.Errorf("delta target size exceeds limit %d", maxSize)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeVersions returns a pseudo binary and a new version of it with inserted, removed and modified data
+func makeVersions() ([]byte, []byte) {
+	rnd := rand.New(rand.NewSource(1))
+	base := make([]byte, 512*1024)
+	rnd.Read(base)
+	var target []byte
+	target = append(target, base[:100000]...)
+	target = append(target, []byte("inserted code")...)
+	target = append(target, base[100000:200000]...)
+	target = append(target, base[210000:400000]...)
+	patch := make([]byte, 3000)
+	rnd.Read(patch)
+	target = append(target, patch...)
+	target = append(target, base[403000:]...)
+	return base, target
+}
+
+// TestDelta checks that a delta rebuilds the new file exactly and is much smaller than it
+func TestDelta(t *testing.T) {
+	dir := t.TempDir()
+	base, target := makeVersions()
+	baseFile := filepath.Join(dir, "base")
+	newFile := filepath.Join(dir, "new")
+	deltaFile := filepath.Join(dir, "delta")
+	outFile := filepath.Join(dir, "out")
+	os.WriteFile(baseFile, base, 0644)
+	os.WriteFile(newFile, target, 0644)
+
+	size, err := MakeDelta(baseFile, newFile, deltaFile)
+	if err != nil {
+		t.Fatalf("MakeDelta error: %v", err)
+	}
+	if size > int64(len(target))/50 {
+		t.Errorf("delta too large: %d bytes for %d bytes file", size, len(target))
+	}
+	if err := ApplyDelta(baseFile, deltaFile, outFile, int64(len(target))); err != nil {
+		t.Fatalf("ApplyDelta error: %v", err)
+	}
+	if out, _ := os.ReadFile(outFile); !bytes.Equal(out, target) {
+		t.Fatal("rebuilt file mismatch")
+	}
+	if err := ApplyDelta(baseFile, deltaFile, outFile, int64(len(target))-1); err == nil {
+		t.Error("size limit not enforced")
+	}
+	if err := ApplyDelta(newFile, deltaFile, outFile, 0); err == nil {
+		t.Error("delta applied to wrong base file")
+	}
+}
+
+// TestGetPackageDelta checks that GetPackage rebuilds the package from the cached base version
+func TestGetPackageDelta(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	dir := t.TempDir()
+	base, target := makeVersions()
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: dir, PublicKey: string(pubKey), Policy: VerifyPolicyCompat, IndexPolicy: VerifyPolicyCompat})
+
+	describe := func(ver VersionNumber, fname string) PackageVersion {
+		size, sum, _ := CalcFileChecksum(fname, ChecksumSha256)
+		sig, _ := Sign(priKey, []byte(sum))
+		return PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+			Os: u.Os, Arch: u.Arch, Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256,
+			Sign: hex.EncodeToString(sig), VersionId: ver}
+	}
+	// version 1.0.0 is installed and cached
+	oldVer, newVer := VersionNumber{Major: 1, Minor: 0, Micro: 0}, VersionNumber{Major: 1, Minor: 0, Micro: 1}
+	os.MkdirAll(filepath.Join(u.packageDir, "1.0.0"), 0775)
+	baseFile := filepath.Join(u.packageDir, "1.0.0", "app")
+	os.WriteFile(baseFile, base, 0644)
+	oldPkg := describe(oldVer, baseFile)
+	oldPkg.Save(filepath.Join(u.packageDir, "app-1.0.0.json"))
+	oldPkg.Save(filepath.Join(u.packageDir, "app.json"))
+
+	srcDir := t.TempDir()
+	newFile := filepath.Join(srcDir, "app")
+	os.WriteFile(newFile, target, 0644)
+	newPkg := describe(newVer, newFile)
+	MakeDelta(baseFile, newFile, filepath.Join(srcDir, "1.0.0.delta"))
+
+	prefix := "/app/" + u.Os + "/" + u.Arch
+	addr := VersionAddr{VersionId: newVer, AppUrl: prefix + "/1.0.1/app", InfoUrl: prefix + "/1.0.1/package.json",
+		Deltas: []DeltaAddr{{BaseVersion: oldVer, Url: prefix + "/1.0.1/deltas/1.0.0.delta"}}}
+	plat := PlatformInfo{PackageName: "app", Os: u.Os, Arch: u.Arch, Newest: addr, Versions: []VersionAddr{addr}}
+	var fullDownloads int
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/platform.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(plat)
+	})
+	mux.HandleFunc(addr.InfoUrl, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(newPkg)
+	})
+	mux.HandleFunc(addr.Deltas[0].Url, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(srcDir, "1.0.0.delta"))
+	})
+	mux.HandleFunc(addr.AppUrl, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fullDownloads++
+		}
+		http.ServeFile(w, r, newFile)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u.BaseUrl = srv.URL
+
+	pkg, upgraded, err := u.GetPackage(nil)
+	if err != nil || !upgraded || CompareVersion(pkg.VersionId, newVer) != 0 {
+		t.Fatalf("GetPackage = %v, %v, %v", pkg.VersionId, upgraded, err)
+	}
+	if fullDownloads != 0 {
+		t.Error("full package downloaded although delta is available")
+	}
+	if data, _ := os.ReadFile(filepath.Join(u.packageDir, "1.0.1", "app")); !bytes.Equal(data, target) {
+		t.Error("rebuilt package mismatch")
+	}
+
+	// A corrupted base file makes the client fall back to the full package
+	os.Remove(filepath.Join(u.packageDir, "app-1.0.1.json"))
+	os.RemoveAll(filepath.Join(u.packageDir, "1.0.1"))
+	os.WriteFile(baseFile, target, 0644)
+	if _, _, err := u.GetPackage(nil); err != nil || fullDownloads != 1 {
+		t.Errorf("fallback to full package failed: %v, downloads %d", err, fullDownloads)
+	}
+}
@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/**
+ *	诊断项
+ */
+const (
+	DoctorDescriptor = "descriptor" //激活版本的包描述文件无效
+	DoctorIntegrity  = "integrity"  //安装的文件与包描述不符(大小、散列值、签名)
+	DoctorMissing    = "missing"    //安装的文件不存在
+	DoctorExtra      = "extra"      //不属于任何包的文件
+	DoctorTodo       = "todo"       //过期的待办或中断的升级
+	DoctorPath       = "path"       //PATH不包含安装目录
+	DoctorBashrc     = "bashrc"     //~/.bashrc中无效或重复的PATH设置
+	DoctorDrift      = "drift"      //conf包的配置文件被本地修改过，不是错误，也不会自动修复
+)
+
+/**
+ *	诊断发现的一个问题
+ */
+type DoctorIssue struct {
+	PackageName string `json:"packageName"` //相关的包，为空表示与具体的包无关
+	Check       string `json:"check"`       //诊断项
+	Message     string `json:"message"`     //问题描述
+	Fixable     bool   `json:"fixable"`     //可以自动修复
+	Fixed       bool   `json:"fixed"`       //已修复
+}
+
+type doctor struct {
+	cfg    UpgradeConfig
+	fix    bool
+	issues []DoctorIssue
+}
+
+/**
+ *	记录问题，需要修复且可以修复时执行修复函数fixFn
+ */
+func (d *doctor) report(pkgName, check string, fixFn func() error, format string, args ...interface{}) {
+	issue := DoctorIssue{
+		PackageName: pkgName,
+		Check:       check,
+		Message:     fmt.Sprintf(format, args...),
+		Fixable:     fixFn != nil,
+	}
+	if d.fix && fixFn != nil {
+		if err := fixFn(); err != nil {
+			issue.Message += fmt.Sprintf(" (fix failed: %v)", err)
+		} else {
+			issue.Fixed = true
+		}
+	}
+	d.issues = append(d.issues, issue)
+}
+
+/**
+ *	检查安装的文件fpath与包描述pkg是否一致
+ */
+func (u *Upgrader) checkInstalledFile(pkg PackageVersion, fpath string) (string, error) {
+	algo := pkg.ChecksumAlgo
+	if algo == "" {
+		algo = ChecksumMd5
+	}
+	size, sum, err := CalcFileChecksum(fpath, algo)
+	if err != nil {
+		return DoctorMissing, err
+	}
+	if size != pkg.Size {
+		return DoctorIntegrity, fmt.Errorf("size %d, descriptor says %d", size, pkg.Size)
+	}
+	if sum != pkg.Checksum {
+		return DoctorIntegrity, fmt.Errorf("%s checksum mismatch", algo)
+	}
+	if err := u.verifyPackageSign(pkg); err != nil {
+		return DoctorIntegrity, fmt.Errorf("signature error: %v", err)
+	}
+	return "", nil
+}
+
+/**
+ *	返回从缓存重新激活包的修复函数，缓存中的包不完整时返回nil(无法修复)
+ */
+func (u *Upgrader) reactivateFix(pkg PackageVersion) func() error {
+	if _, err := u.checkLocalPackage(pkg.VersionId); err != nil {
+		return nil
+	}
+	return func() error {
+		return u.activatePackage(pkg)
+	}
+}
+
+/**
+ *	诊断一个已安装的包，返回包的已安装文件(用于查找多余的文件)
+ */
+func (d *doctor) diagnosePackage(name string) []string {
+	u := NewUpgrader(name, d.cfg)
+	pkg, err := u.GetLocalVersion(nil)
+	if err != nil {
+		d.report(name, DoctorDescriptor, nil, "load active descriptor failed: %v", err)
+		return nil
+	}
+	if err := pkg.Verify(); err != nil {
+		d.report(name, DoctorDescriptor, nil, "active descriptor is invalid: %v", err)
+		return nil
+	}
+	ver := pkg.VersionId.String()
+	var owned []string
+	if pkg.PackageType == PackageTypeArchive {
+		var manifest PackageManifest
+		if err := manifest.Load(u.manifestFile(pkg.VersionId)); err != nil {
+			d.report(name, DoctorMissing, u.reactivateFix(pkg), "file list of %s doesn't exist", ver)
+			return nil
+		}
+		var missing []string
+		for _, f := range manifest.Files {
+			fpath, err := safeJoin(manifest.Dir, f)
+			if err != nil {
+				continue
+			}
+			owned = append(owned, fpath)
+			if _, err := os.Stat(fpath); err != nil {
+				missing = append(missing, f)
+			}
+		}
+		if len(missing) > 0 {
+			d.report(name, DoctorMissing, u.reactivateFix(pkg), "%d files of %s are missing, such as '%s'", len(missing), ver, missing[0])
+		}
+		d.findExtraFiles(name, manifest.Dir, owned)
+	} else {
+		fpath := u.installPath(pkg)
+		owned = append(owned, fpath)
+		check, err := u.checkInstalledFile(pkg, fpath)
+		switch {
+		case err == nil:
+		case pkg.PackageType == PackageTypeConf && check == DoctorIntegrity:
+			//	配置文件允许本地修改，重新激活会覆盖管理员的修改，所以只报告
+			d.report(name, DoctorDrift, nil, "'%s' differs from %s as shipped, run 'smc component diff %s' to inspect", fpath, ver, name)
+		default:
+			d.report(name, check, u.reactivateFix(pkg), "installed file '%s' of %s: %v", fpath, ver, err)
+		}
+	}
+
+	if todo, err := u.GetTodo(); err == nil {
+		_, pinErr := u.GetPinned()
+		switch {
+		case CompareVersion(todo.VersionId, pkg.VersionId) <= 0:
+			d.report(name, DoctorTodo, func() error {
+				u.RemoveTodo()
+				return nil
+			}, "todo %s isn't newer than the active version %s", todo.VersionId.String(), ver)
+		case pinErr == nil:
+			//	固定的包记录的待升级版本，不是问题
+		default:
+			//	applyPackage激活成功后会删除待办，残留的待办说明升级被中断
+			var fix func() error
+			if activate := u.reactivateFix(todo); activate != nil {
+				fix = func() error {
+					if err := activate(); err != nil {
+						return err
+					}
+					u.RemoveTodo()
+					return nil
+				}
+			}
+			d.report(name, DoctorTodo, fix, "upgrade to %s was interrupted", todo.VersionId.String())
+		}
+	}
+	return owned
+}
+
+/**
+ *	查找目录dir中不属于owned的文件
+ *	原子写入残留的临时文件(.*.tmp)和windows上替换文件留下的*.old可以删除，其它文件只报告
+ */
+func (d *doctor) findExtraFiles(pkgName, dir string, owned []string) {
+	known := make(map[string]bool)
+	for _, f := range owned {
+		known[filepath.Clean(f)] = true
+	}
+	filepath.Walk(dir, func(fpath string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() || known[filepath.Clean(fpath)] {
+			return nil
+		}
+		name := f.Name()
+		if (strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp")) || strings.HasSuffix(name, ".old") {
+			d.report(pkgName, DoctorExtra, func() error {
+				return os.Remove(fpath)
+			}, "leftover file '%s'", fpath)
+		} else {
+			d.report(pkgName, DoctorExtra, nil, "file '%s' doesn't belong to any package", fpath)
+		}
+		return nil
+	})
+}
+
+/**
+ *	检查PATH中是否包含安装目录
+ */
+func (d *doctor) diagnosePath(installDir string) {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(p) == filepath.Clean(installDir) {
+			return
+		}
+	}
+	d.report("", DoctorPath, func() error {
+		if runtime.GOOS == "windows" {
+			return windowsSetPATH(installDir)
+		}
+		return linuxSetPATH(installDir)
+	}, "PATH doesn't contain '%s', installed programs can't be found", installDir)
+}
+
+/**
+ *	检查linuxSetPATH写入~/.bashrc的PATH设置：目录不存在或重复的行
+ */
+func (d *doctor) diagnoseBashrc() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	bashrcPath := filepath.Join(homeDir, ".bashrc")
+	file, err := os.Open(bashrcPath)
+	if err != nil {
+		return
+	}
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	file.Close()
+	if scanner.Err() != nil {
+		return
+	}
+	const prefix = "export PATH=$PATH:"
+	seen := make(map[string]bool)
+	var kept []string
+	var broken []string
+	for _, line := range lines {
+		dir, ok := strings.CutPrefix(strings.TrimSpace(line), prefix)
+		if !ok || !strings.Contains(dir, ".costrict") {
+			kept = append(kept, line)
+			continue
+		}
+		if seen[dir] {
+			broken = append(broken, fmt.Sprintf("duplicate '%s'", dir))
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			broken = append(broken, fmt.Sprintf("'%s' doesn't exist", dir))
+			continue
+		}
+		seen[dir] = true
+		kept = append(kept, line)
+	}
+	if len(broken) == 0 {
+		return
+	}
+	d.report("", DoctorBashrc, func() error {
+		info, err := os.Stat(bashrcPath)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(bashrcPath, []byte(strings.Join(kept, "\n")+"\n"), info.Mode().Perm())
+	}, "%s has invalid PATH settings: %s", bashrcPath, strings.Join(broken, ", "))
+}
+
+/**
+ *	诊断本机安装的包
+ *	@param {UpgradeConfig} cfg - 升级配置，BaseDir为空则使用默认的.costrict目录
+ *	@param {[]string} names - 要诊断的包，为空则诊断所有已安装的包
+ *	@param {bool} fix - 是否修复可以安全修复的问题：从缓存重新激活、删除过期待办及残留文件、设置PATH、清理~/.bashrc
+ *	@returns {[]DoctorIssue} 发现的问题
+ */
+func DiagnosePackages(cfg UpgradeConfig, names []string, fix bool) ([]DoctorIssue, error) {
+	u := NewUpgrader("", cfg)
+	d := &doctor{cfg: u.UpgradeConfig, fix: fix}
+	all := len(names) == 0
+	if all {
+		entries, err := os.ReadDir(u.packageDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			var pkg PackageVersion
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			if err := pkg.Load(filepath.Join(u.packageDir, e.Name())); err == nil && e.Name() == pkg.PackageName+".json" {
+				names = append(names, pkg.PackageName)
+			}
+		}
+		sort.Strings(names)
+	}
+	var owned []string
+	hasExec := false
+	for _, name := range names {
+		owned = append(owned, d.diagnosePackage(name)...)
+		if pkg, err := NewUpgrader(name, d.cfg).GetLocalVersion(nil); err == nil && pkg.PackageType == PackageTypeExec {
+			hasExec = true
+		}
+	}
+	if all {
+		//	待办中没有安装的包
+		todos, _ := filepath.Glob(filepath.Join(u.packageDir, "todos", "*.json"))
+		for _, fname := range todos {
+			name := strings.TrimSuffix(filepath.Base(fname), ".json")
+			if !slices.Contains(names, name) {
+				d.report(name, DoctorTodo, func() error {
+					return os.Remove(fname)
+				}, "todo of a package which isn't installed")
+			}
+		}
+		d.findExtraFiles("", u.installDir, owned)
+	}
+	if hasExec && !u.NoSetPath {
+		d.diagnosePath(u.installDir)
+		if runtime.GOOS != "windows" {
+			d.diagnoseBashrc()
+		}
+	}
+	return d.issues, nil
+}
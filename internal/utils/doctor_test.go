@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDoctor checks a tampered installed file is restored from cache, stale todos and broken .bashrc lines are removed, and edited configs are kept
+func TestDoctor(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), PublicKey: string(pubKey)})
+	t.Setenv("PATH", u.installDir)
+
+	cacheDir := filepath.Join(u.packageDir, "1.0.0")
+	os.MkdirAll(cacheDir, 0775)
+	cacheFile := filepath.Join(cacheDir, "app")
+	os.WriteFile(cacheFile, testContent(1000), 0755)
+	size, sum, _ := CalcFileChecksum(cacheFile, ChecksumSha256)
+	sig, _ := Sign(priKey, []byte(sum))
+	pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+		Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256, Sign: hex.EncodeToString(sig), Probe: "none",
+		VersionId: VersionNumber{Major: 1}}
+	pkg.Save(filepath.Join(u.packageDir, "app-1.0.0.json"))
+	if err := u.activatePackage(pkg); err != nil {
+		t.Fatal(err)
+	}
+	u.AddTodo(pkg)
+	bashrc := filepath.Join(home, ".bashrc")
+	os.WriteFile(bashrc, []byte("alias ll='ls -l'\nexport PATH=$PATH:"+u.installDir+
+		"\nexport PATH=$PATH:/nonexistent/.costrict/bin\n"), 0644)
+
+	issues, err := DiagnosePackages(u.UpgradeConfig, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make(map[string]bool)
+	for _, issue := range issues {
+		checks[issue.Check] = true
+	}
+	if len(issues) != 2 || !checks[DoctorTodo] || !checks[DoctorBashrc] {
+		t.Fatalf("issues of a good installation = %+v", issues)
+	}
+
+	installed := u.installPath(pkg)
+	os.WriteFile(installed, testContent(999), 0755)
+	issues, _ = DiagnosePackages(u.UpgradeConfig, []string{"app"}, true)
+	fixed := 0
+	for _, issue := range issues {
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	if fixed != 3 || len(issues) != 3 {
+		t.Errorf("issues = %+v", issues)
+	}
+	if _, s, _ := CalcFileChecksum(installed, ChecksumSha256); s != sum {
+		t.Error("installed file isn't restored")
+	}
+	if _, err := u.GetTodo(); err == nil {
+		t.Error("stale todo isn't removed")
+	}
+	data, _ := os.ReadFile(bashrc)
+	if strings.Contains(string(data), "/nonexistent/") || !strings.Contains(string(data), "alias ll") {
+		t.Errorf(".bashrc = %q", data)
+	}
+	if issues, _ := DiagnosePackages(u.UpgradeConfig, nil, false); len(issues) != 0 {
+		t.Errorf("issues after fix = %+v", issues)
+	}
+
+	// A locally edited config is drift, which --fix must not overwrite
+	cu := NewUpgrader("app-config", u.UpgradeConfig)
+	os.WriteFile(filepath.Join(cacheDir, "app.json"), []byte("{}\n"), 0644)
+	size, sum, _ = CalcFileChecksum(filepath.Join(cacheDir, "app.json"), ChecksumSha256)
+	sig, _ = Sign(priKey, []byte(sum))
+	conf := PackageVersion{PackageName: "app-config", PackageType: PackageTypeConf, FileName: "config/app.json",
+		Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256, Sign: hex.EncodeToString(sig), VersionId: VersionNumber{Major: 1}}
+	if err := cu.activatePackage(conf); err != nil {
+		t.Fatal(err)
+	}
+	edited := []byte("{\"debug\": true}\n")
+	os.WriteFile(cu.installPath(conf), edited, 0644)
+	issues, _ = DiagnosePackages(u.UpgradeConfig, []string{"app-config"}, true)
+	if len(issues) != 1 || issues[0].Check != DoctorDrift || issues[0].Fixable || issues[0].Fixed {
+		t.Errorf("issues of an edited config = %+v", issues)
+	}
+	if data, _ := os.ReadFile(cu.installPath(conf)); string(data) != string(edited) {
+		t.Error("edited config is overwritten")
+	}
+}
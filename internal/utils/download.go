@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zgsm-ai/smc/internal/bar"
+	"github.com/zgsm-ai/smc/internal/env"
+)
+
+/**
+ *	下载选项
+ */
+type DownloadOptions struct {
+	Retries        int           //每个分片失败后的最大重试次数
+	Backoff        time.Duration //首次重试前的等待时间，之后按指数增长
+	MaxBackoff     time.Duration //重试等待时间的上限
+	Chunks         int           //并行下载的分片数，小于等于1则不分片
+	ChunkThreshold int64         //文件大小达到该值才分片下载
+	Progress       bool          //是否显示进度条
+	HeaderTimeout  time.Duration //连接及等待响应头的超时，为0则取默认值
+	StallTimeout   time.Duration //持续没有收到数据的超时，为0则取默认值
+}
+
+/**
+ *	默认下载选项
+ */
+var DefaultDownloadOptions = DownloadOptions{
+	Retries:        5,
+	Backoff:        time.Second,
+	MaxBackoff:     30 * time.Second,
+	Chunks:         4,
+	ChunkThreshold: 16 * 1024 * 1024,
+	HeaderTimeout:  30 * time.Second,
+	StallTimeout:   60 * time.Second,
+}
+
+/**
+ *	服务端返回的不可重试的错误
+ */
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+/**
+ *	下载器：通过HTTP Range支持断点续传、分片并行下载和失败重试
+ */
+type downloader struct {
+	client  *http.Client
+	urlStr  string
+	opts    DownloadOptions
+	size    int64 //文件大小，-1表示未知
+	ranges  bool  //服务器是否支持Range请求
+	counter func(n int64)
+}
+
+/**
+ *	写入文件的同时汇报进度
+ */
+type progressWriter struct {
+	w       io.Writer
+	counter func(n int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	if n > 0 && pw.counter != nil {
+		pw.counter(int64(n))
+	}
+	return n, err
+}
+
+/**
+ *	读取响应体时重置停滞计时器，计时器到期说明连接停滞
+ */
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+/**
+ *	从服务器下载一个文件到savePath
+ *	@description
+ *	- 下载过程中数据写入savePath.partial，完成后改名为savePath
+ *	- 如果存在上次中断遗留的.partial文件，使用Range请求从断点处继续下载
+ *	- 文件较大且服务器支持Range时，分成多个分片并行下载，每个分片单独续传
+ *	- 网络错误及5xx错误按指数退避重试；等待响应头或持续收不到数据超时也视为网络错误
+ */
+func DownloadFile(urlStr string, params map[string]string, savePath string, opts DownloadOptions) error {
+	if len(params) > 0 {
+		vals := make(url.Values)
+		for k, v := range params {
+			vals.Set(k, v)
+		}
+		urlStr = urlStr + "?" + vals.Encode()
+	}
+	if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+		return fmt.Errorf("DownloadFile('%s'): MkdirAll('%s') error:%v", urlStr, savePath, err)
+	}
+	if opts.HeaderTimeout <= 0 {
+		opts.HeaderTimeout = DefaultDownloadOptions.HeaderTimeout
+	}
+	if opts.StallTimeout <= 0 {
+		opts.StallTimeout = DefaultDownloadOptions.StallTimeout
+	}
+	tr := &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: opts.HeaderTimeout}).DialContext,
+		TLSHandshakeTimeout:   opts.HeaderTimeout,
+		ResponseHeaderTimeout: opts.HeaderTimeout,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: env.SkipSSL},
+	}
+	d := &downloader{
+		client: &http.Client{Transport: tr},
+		urlStr: urlStr,
+		opts:   opts,
+		size:   -1,
+	}
+	d.probe()
+
+	partial := savePath + ".partial"
+	if opts.Progress && d.size > 0 {
+		_, fname := filepath.Split(savePath)
+		bar.CreatePbar(d.size, fname)
+		defer bar.FinishPbar(fname)
+		d.counter = bar.Add64
+	}
+	var err error
+	if d.ranges && d.size >= opts.ChunkThreshold && opts.Chunks > 1 {
+		err = d.downloadChunks(partial)
+	} else {
+		err = d.downloadRange(partial, 0, d.size-1)
+	}
+	if err != nil {
+		return fmt.Errorf("DownloadFile('%s') failed: %v", urlStr, err)
+	}
+	if err := os.Rename(partial, savePath); err != nil {
+		return fmt.Errorf("DownloadFile('%s'): rename '%s' error: %v", urlStr, partial, err)
+	}
+	return nil
+}
+
+/**
+ *	探测文件大小及服务器是否支持Range请求，探测失败时退化为整体下载
+ */
+func (d *downloader) probe() {
+	req, err := http.NewRequest("HEAD", d.urlStr, nil)
+	if err != nil {
+		return
+	}
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		env.LogDbg.Printf("HEAD %s error: %v\n", d.urlStr, err)
+		return
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return
+	}
+	d.size = rsp.ContentLength
+	d.ranges = rsp.Header.Get("Accept-Ranges") == "bytes" && d.size > 0
+}
+
+/**
+ *	把文件分成opts.Chunks个分片并行下载，所有分片完成后合并到fname
+ */
+func (d *downloader) downloadChunks(fname string) error {
+	chunks := int64(d.opts.Chunks)
+	chunkSize := (d.size + chunks - 1) / chunks
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var parts []string
+	for start := int64(0); start < d.size; start += chunkSize {
+		end := start + chunkSize - 1
+		if end >= d.size {
+			end = d.size - 1
+		}
+		part := fmt.Sprintf("%s.%d", fname, len(parts))
+		parts = append(parts, part)
+		wg.Add(1)
+		go func(part string, start, end int64) {
+			defer wg.Done()
+			if err := d.downloadRange(part, start, end); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(part, start, end)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	out, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, part := range parts {
+		in, err := os.Open(part)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, part := range parts {
+		os.Remove(part)
+	}
+	return nil
+}
+
+/**
+ *	下载[start,end]区间的数据到fname，end<0表示直到文件末尾
+ *	fname中已有的数据视为已下载部分，从其后续传
+ */
+func (d *downloader) downloadRange(fname string, start, end int64) error {
+	if d.counter != nil { //上次中断前已下载的数据计入进度
+		if fi, err := os.Stat(fname); err == nil && (end < 0 || fi.Size() <= end-start+1) {
+			d.counter(fi.Size())
+		}
+	}
+	backoff := d.opts.Backoff
+	var err error
+	for attempt := 0; attempt <= d.opts.Retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Download '%s' failed: %v, retry %d/%d after %v\n",
+				d.urlStr, err, attempt, d.opts.Retries, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if d.opts.MaxBackoff > 0 && backoff > d.opts.MaxBackoff {
+				backoff = d.opts.MaxBackoff
+			}
+		}
+		var done bool
+		done, err = d.fetchRange(fname, start, end)
+		if err == nil && done {
+			return nil
+		}
+		if _, ok := err.(*permanentError); ok {
+			return err
+		}
+	}
+	return err
+}
+
+/**
+ *	发起一次请求，把数据追加到fname中
+ *	@returns {bool} 数据是否已完整下载
+ */
+func (d *downloader) fetchRange(fname string, start, end int64) (bool, error) {
+	var have int64
+	if fi, err := os.Stat(fname); err == nil {
+		have = fi.Size()
+	}
+	if end >= 0 && have > end-start+1 { //遗留文件比预期大，说明文件已变化，需要重新下载
+		have = 0
+	}
+	if end >= 0 && have == end-start+1 {
+		return true, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", d.urlStr, nil)
+	if err != nil {
+		return false, &permanentError{err}
+	}
+	if start+have > 0 || end >= 0 {
+		if end >= 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start+have, end))
+		} else {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start+have))
+		}
+	}
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch {
+	case rsp.StatusCode == http.StatusPartialContent:
+		flag |= os.O_APPEND
+		if have == 0 {
+			flag |= os.O_TRUNC
+		}
+	case rsp.StatusCode == http.StatusOK:
+		if start > 0 { //服务器不支持Range，无法下载分片
+			return false, &permanentError{fmt.Errorf("server does not support range requests")}
+		}
+		flag |= os.O_TRUNC
+		if have > 0 && d.counter != nil { //从头下载，已计入进度的数据作废
+			d.counter(-have)
+		}
+		have = 0
+	case rsp.StatusCode == http.StatusRequestedRangeNotSatisfiable && end < 0 && have > 0:
+		return true, nil //已经下载到文件末尾
+	default:
+		rspBody, _ := io.ReadAll(io.LimitReader(rsp.Body, 4096))
+		err := fmt.Errorf("code: %d, error: %s", rsp.StatusCode, string(rspBody))
+		if rsp.StatusCode >= 500 || rsp.StatusCode == http.StatusTooManyRequests {
+			return false, err
+		}
+		return false, &permanentError{err}
+	}
+	out, err := os.OpenFile(fname, flag, 0644)
+	if err != nil {
+		return false, &permanentError{err}
+	}
+	defer out.Close()
+	var stalled atomic.Bool
+	timer := time.AfterFunc(d.opts.StallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+	body := &stallReader{r: rsp.Body, timer: timer, timeout: d.opts.StallTimeout}
+	n, err := io.Copy(&progressWriter{w: out, counter: d.counter}, body)
+	if err != nil {
+		if stalled.Load() {
+			return false, fmt.Errorf("no data received in %v", d.opts.StallTimeout)
+		}
+		return false, err
+	}
+	if rsp.ContentLength >= 0 && n != rsp.ContentLength {
+		return false, fmt.Errorf("short read: %d of %d bytes", n, rsp.ContentLength)
+	}
+	return true, nil
+}
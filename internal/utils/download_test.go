@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ *	A ResponseWriter that stops writing after limit bytes, to simulate a dropped connection
+ */
+type dropWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *dropWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.limit = 0
+		return n, http.ErrAbortHandler
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// newFlakyServer serves content, dropping the connection of the first 'drops' GET requests after 'limit' bytes
+func newFlakyServer(content []byte, drops int32, limit int) (*httptest.Server, *int32) {
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && atomic.AddInt32(&gets, 1) <= drops {
+			w = &dropWriter{ResponseWriter: w, limit: limit}
+		}
+		http.ServeContent(w, r, "app", time.Time{}, bytes.NewReader(content))
+	}))
+	return srv, &gets
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	return content
+}
+
+// TestDownloadFileResume checks that a download survives dropped connections by resuming
+func TestDownloadFileResume(t *testing.T) {
+	content := testContent(256 * 1024)
+	srv, gets := newFlakyServer(content, 3, 50*1024)
+	defer srv.Close()
+
+	opts := DownloadOptions{Retries: 5, Backoff: time.Millisecond, Chunks: 1}
+	savePath := filepath.Join(t.TempDir(), "app")
+	if err := DownloadFile(srv.URL+"/app", nil, savePath, opts); err != nil {
+		t.Fatalf("DownloadFile error: %v", err)
+	}
+	data, _ := os.ReadFile(savePath)
+	if !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content mismatch, size %d", len(data))
+	}
+	if *gets != 4 {
+		t.Errorf("expected 4 GET requests, got %d", *gets)
+	}
+	if _, err := os.Stat(savePath + ".partial"); !os.IsNotExist(err) {
+		t.Error("partial file not removed")
+	}
+}
+
+// TestDownloadFileChunks checks parallel chunked download with dropped connections
+func TestDownloadFileChunks(t *testing.T) {
+	content := testContent(1024 * 1024)
+	srv, _ := newFlakyServer(content, 4, 10*1024)
+	defer srv.Close()
+
+	opts := DownloadOptions{Retries: 5, Backoff: time.Millisecond, Chunks: 4, ChunkThreshold: 1024}
+	savePath := filepath.Join(t.TempDir(), "app")
+	if err := DownloadFile(srv.URL+"/app", nil, savePath, opts); err != nil {
+		t.Fatalf("DownloadFile error: %v", err)
+	}
+	data, _ := os.ReadFile(savePath)
+	if !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content mismatch, size %d", len(data))
+	}
+}
+
+// TestDownloadFileGiveUp checks that retries are bounded and the partial file is kept for later resume
+func TestDownloadFileGiveUp(t *testing.T) {
+	content := testContent(64 * 1024)
+	srv, _ := newFlakyServer(content, 100, 1024)
+	defer srv.Close()
+
+	opts := DownloadOptions{Retries: 2, Backoff: time.Millisecond, Chunks: 1}
+	savePath := filepath.Join(t.TempDir(), "app")
+	if err := DownloadFile(srv.URL+"/app", nil, savePath, opts); err == nil {
+		t.Fatal("DownloadFile should fail")
+	}
+	fi, err := os.Stat(savePath + ".partial")
+	if err != nil || fi.Size() != 3*1024 {
+		t.Errorf("partial file should keep 3 resumed pieces: %v", err)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	if err := DownloadFile(notFound.URL+"/app", nil, savePath, opts); err == nil {
+		t.Error("DownloadFile should fail on 404")
+	}
+}
+
+// TestDownloadFileStall checks a stalled connection times out and is retried instead of hanging
+func TestDownloadFileStall(t *testing.T) {
+	content := testContent(64 * 1024)
+	release := make(chan struct{})
+	defer close(release)
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && atomic.AddInt32(&gets, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:1024])
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		http.ServeContent(w, r, "app", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	opts := DownloadOptions{Retries: 2, Backoff: time.Millisecond, Chunks: 1, StallTimeout: 100 * time.Millisecond}
+	savePath := filepath.Join(t.TempDir(), "app")
+	done := make(chan error, 1)
+	go func() {
+		done <- DownloadFile(srv.URL+"/app", nil, savePath, opts)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("DownloadFile error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("DownloadFile hangs on a stalled connection")
+	}
+	if data, _ := os.ReadFile(savePath); !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content mismatch, size %d", len(data))
+	}
+}
+
+// TestDownloadRestartProgress checks bytes counted before a resume are taken back when the server restarts from 0
+func TestDownloadRestartProgress(t *testing.T) {
+	content := testContent(8 * 1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content) // ignores Range, always 200
+	}))
+	defer srv.Close()
+
+	fname := filepath.Join(t.TempDir(), "app.partial")
+	os.WriteFile(fname, content[:1000], 0644)
+	var counted int64
+	d := &downloader{client: srv.Client(), urlStr: srv.URL, size: -1,
+		opts:    DownloadOptions{Retries: 1, Backoff: time.Millisecond, StallTimeout: time.Second},
+		counter: func(n int64) { counted += n }}
+	if err := d.downloadRange(fname, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if counted != int64(len(content)) {
+		t.Errorf("progress = %d bytes, want %d", counted, len(content))
+	}
+	if data, _ := os.ReadFile(fname); !bytes.Equal(data, content) {
+		t.Errorf("downloaded content mismatch, size %d", len(data))
+	}
+}
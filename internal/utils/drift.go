@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+ *	conf包升级时合并冲突的报告，保存在package/conflicts/{package}.json
+ */
+type ConfConflictReport struct {
+	PackageName string         `json:"packageName"`
+	File        string         `json:"file"`      //安装的配置文件，保留了本地的修改
+	NewFile     string         `json:"newFile"`   //新版本发布的配置文件
+	Version     VersionNumber  `json:"version"`   //新版本
+	Conflicts   []JSONConflict `json:"conflicts"` //冲突的位置，配置文件不是JSON时为空
+	Time        time.Time      `json:"time"`
+}
+
+/**
+ *	conf包安装的配置文件与发布的原始文件之间的差异
+ */
+type ConfDrift struct {
+	PackageName string              `json:"packageName"`
+	Version     VersionNumber       `json:"version"`            //激活的版本
+	File        string              `json:"file"`               //安装的配置文件
+	Pristine    string              `json:"pristine"`           //发布的原始文件
+	Modified    bool                `json:"modified"`           //配置文件被本地修改过
+	Changes     []JSONChange        `json:"changes,omitempty"`  //本地的修改，Old为发布的值，New为本地的值
+	Conflict    *ConfConflictReport `json:"conflict,omitempty"` //未解决的升级冲突
+}
+
+/**
+ *	conf包发布的原始文件：package/pristine/{package}/{file}
+ *	作为三方合并的基准，用于识别本地的修改
+ */
+func (u *Upgrader) pristineFile(pkg PackageVersion) string {
+	_, fname := filepath.Split(pkg.FileName)
+	return filepath.Join(u.packageDir, "pristine", u.packageName, fname)
+}
+
+func (u *Upgrader) conflictFile() string {
+	return filepath.Join(u.packageDir, "conflicts", u.packageName+".json")
+}
+
+func (u *Upgrader) savePristine(pkg PackageVersion, src string) error {
+	fname := u.pristineFile(pkg)
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+	return copyFileAtomic(src, fname, 0644)
+}
+
+/**
+ *	删除conf包的原始文件和冲突报告
+ */
+func (u *Upgrader) removeConfState() {
+	os.RemoveAll(filepath.Join(u.packageDir, "pristine", u.packageName))
+	os.Remove(u.conflictFile())
+}
+
+/**
+ *	回退conf包后，以回退到的版本缓存的包文件作为原始文件
+ */
+func (u *Upgrader) restorePristine(prev PackageVersion) {
+	_, fname := filepath.Split(prev.FileName)
+	cacheFname := filepath.Join(u.packageDir, prev.VersionId.String(), fname)
+	os.Remove(u.conflictFile())
+	if _, err := os.Stat(cacheFname); err != nil {
+		os.Remove(u.pristineFile(prev))
+		return
+	}
+	if err := u.savePristine(prev, cacheFname); err != nil {
+		log.Printf("Save pristine copy of '%s' failed: %v\n", u.packageName, err)
+	}
+}
+
+/**
+ *	获取本地配置文件的基准：优先使用保存的原始文件，没有时(旧版本安装的)使用激活版本缓存的包文件
+ */
+func (u *Upgrader) loadPristine(pkg PackageVersion) ([]byte, error) {
+	if data, err := os.ReadFile(u.pristineFile(pkg)); err == nil {
+		return data, nil
+	}
+	cur, err := u.GetLocalVersion(nil)
+	if err != nil {
+		return nil, err
+	}
+	_, fname := filepath.Split(cur.FileName)
+	return os.ReadFile(filepath.Join(u.packageDir, cur.VersionId.String(), fname))
+}
+
+/**
+ *	三方合并JSON配置：base为旧版本发布的，local为本地的，remote为新版本发布的
+ */
+func mergeConfData(base, local, remote []byte) ([]byte, []JSONConflict, error) {
+	b, err := ParseOrderedJSON(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := ParseOrderedJSON(local)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := ParseOrderedJSON(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, conflicts := MergeJSON3(b, l, r)
+	if len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+	data, err := MarshalOrderedJSON(merged)
+	return data, nil, err
+}
+
+/**
+ *	安装conf包的配置文件，保留本地的修改
+ *	@description
+ *	- 配置文件不存在或未被修改过时，直接用新版本覆盖
+ *	- 被修改过时，把旧版本到新版本的变化合并到本地的配置文件
+ *	- 无法合并(冲突或不是JSON)时保留本地的配置文件，新版本写入{file}.new，并记录冲突报告
+ *	- 合并或覆盖后，新版本的文件成为原始文件；冲突时原始文件不变，仍是本地修改的基准
+ */
+func (u *Upgrader) saveConfData(pkg PackageVersion, cacheFname string) error {
+	dataPath := u.installPath(pkg)
+	local, err := os.ReadFile(dataPath)
+	if err != nil {
+		return u.overwriteConfData(pkg, cacheFname)
+	}
+	base, err := u.loadPristine(pkg)
+	if err != nil || bytes.Equal(base, local) {
+		return u.overwriteConfData(pkg, cacheFname)
+	}
+	remote, err := os.ReadFile(cacheFname)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(base, remote) || bytes.Equal(local, remote) {
+		//	新版本没有修改配置文件，或者本地已经是新版本的内容
+		os.Remove(u.conflictFile())
+		return u.savePristine(pkg, cacheFname)
+	}
+	merged, conflicts, err := mergeConfData(base, local, remote)
+	if err == nil && len(conflicts) == 0 {
+		if err := writeFileAtomic(dataPath, merged, 0644); err != nil {
+			return err
+		}
+		log.Printf("Local changes of '%s' merged into version %s\n", dataPath, pkg.VersionId.String())
+		os.Remove(u.conflictFile())
+		return u.savePristine(pkg, cacheFname)
+	}
+	newFile := dataPath + ".new"
+	if err := copyFileAtomic(cacheFname, newFile, 0644); err != nil {
+		return err
+	}
+	report := ConfConflictReport{
+		PackageName: u.packageName,
+		File:        dataPath,
+		NewFile:     newFile,
+		Version:     pkg.VersionId,
+		Conflicts:   conflicts,
+		Time:        time.Now(),
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(u.conflictFile()), 0775); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(u.conflictFile(), data, 0644); err != nil {
+		return err
+	}
+	log.Printf("Local changes of '%s' conflict with version %s, new file saved as '%s'\n", dataPath, pkg.VersionId.String(), newFile)
+	return nil
+}
+
+func (u *Upgrader) overwriteConfData(pkg PackageVersion, cacheFname string) error {
+	if err := u.savePackageData(pkg, cacheFname); err != nil {
+		return err
+	}
+	os.Remove(u.conflictFile())
+	os.Remove(u.installPath(pkg) + ".new")
+	return u.savePristine(pkg, cacheFname)
+}
+
+/**
+ *	获取conf包未解决的升级冲突
+ */
+func (u *Upgrader) GetConfConflict() (*ConfConflictReport, error) {
+	data, err := os.ReadFile(u.conflictFile())
+	if err != nil {
+		return nil, err
+	}
+	report := &ConfConflictReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+/**
+ *	比较conf包安装的配置文件与发布的原始文件，列出本地的修改及未解决的升级冲突
+ */
+func (u *Upgrader) GetConfDrift() (ConfDrift, error) {
+	var drift ConfDrift
+	pkg, err := u.GetLocalVersion(nil)
+	if err != nil {
+		return drift, fmt.Errorf("package '%s' is not installed", u.packageName)
+	}
+	if pkg.PackageType != PackageTypeConf {
+		return drift, fmt.Errorf("package '%s' isn't a conf package", u.packageName)
+	}
+	drift.PackageName = u.packageName
+	drift.Version = pkg.VersionId
+	drift.File = u.installPath(pkg)
+	drift.Pristine = u.pristineFile(pkg)
+	drift.Conflict, _ = u.GetConfConflict()
+	base, err := u.loadPristine(pkg)
+	if err != nil {
+		return drift, fmt.Errorf("pristine copy of '%s' doesn't exist", drift.File)
+	}
+	local, err := os.ReadFile(drift.File)
+	if err != nil {
+		return drift, err
+	}
+	if bytes.Equal(base, local) {
+		return drift, nil
+	}
+	drift.Modified = true
+	b, berr := ParseOrderedJSON(base)
+	l, lerr := ParseOrderedJSON(local)
+	if berr == nil && lerr == nil {
+		drift.Changes = DiffJSON(b, l)
+	}
+	return drift, nil
+}
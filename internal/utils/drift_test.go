@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfUpgrade checks local edits of a conf package survive upgrades, and conflicts keep the local file
+func TestConfUpgrade(t *testing.T) {
+	u := NewUpgrader("app-config", UpgradeConfig{BaseDir: t.TempDir(), NoSetPath: true})
+	contents := map[string]string{
+		"1.0.0": "{\n  \"listen\": \"localhost:8080\",\n  \"log\": \"info\"\n}\n",
+		"1.1.0": "{\n  \"listen\": \"localhost:8080\",\n  \"log\": \"warn\"\n}\n",
+		"1.2.0": "{\n  \"listen\": \"localhost:9090\",\n  \"log\": \"warn\"\n}\n",
+	}
+	pkgs := make(map[string]PackageVersion)
+	for ver, content := range contents {
+		pkg := PackageVersion{PackageName: "app-config", PackageType: PackageTypeConf, FileName: "config/app.json"}
+		pkg.VersionId.Parse(ver)
+		os.MkdirAll(filepath.Join(u.packageDir, ver), 0775)
+		os.WriteFile(filepath.Join(u.packageDir, ver, "app.json"), []byte(content), 0644)
+		pkgs[ver] = pkg
+	}
+	confFile := filepath.Join(u.BaseDir, "config", "app.json")
+	read := func() string {
+		data, _ := os.ReadFile(confFile)
+		return string(data)
+	}
+
+	if err := u.activatePackage(pkgs["1.0.0"]); err != nil {
+		t.Fatalf("activate 1.0.0: %v", err)
+	}
+	if drift, err := u.GetConfDrift(); err != nil || drift.Modified {
+		t.Fatalf("drift of a fresh install = %+v, %v", drift, err)
+	}
+	os.WriteFile(confFile, []byte(strings.Replace(contents["1.0.0"], "8080", "8000", 1)), 0644)
+	drift, err := u.GetConfDrift()
+	if err != nil || !drift.Modified || len(drift.Changes) != 1 || drift.Changes[0].Path != "$.listen" {
+		t.Fatalf("drift after local edit = %+v, %v", drift, err)
+	}
+
+	// 1.1.0 changes another key, the local edit is kept
+	if err := u.activatePackage(pkgs["1.1.0"]); err != nil {
+		t.Fatalf("activate 1.1.0: %v", err)
+	}
+	if got, want := read(), strings.Replace(contents["1.1.0"], "8080", "8000", 1); got != want {
+		t.Errorf("merged file = %q, want %q", got, want)
+	}
+	if _, err := u.GetConfConflict(); err == nil {
+		t.Error("conflict reported for a clean merge")
+	}
+
+	// 1.2.0 changes the same key, the local file is kept and the new one saved aside
+	if err := u.activatePackage(pkgs["1.2.0"]); err != nil {
+		t.Fatalf("activate 1.2.0: %v", err)
+	}
+	if got, want := read(), strings.Replace(contents["1.1.0"], "8080", "8000", 1); got != want {
+		t.Errorf("local file = %q after conflict, want %q", got, want)
+	}
+	if data, _ := os.ReadFile(confFile + ".new"); string(data) != contents["1.2.0"] {
+		t.Errorf("new file = %q", data)
+	}
+	drift, err = u.GetConfDrift()
+	if err != nil || drift.Conflict == nil || len(drift.Conflict.Conflicts) != 1 || drift.Conflict.Conflicts[0].Path != "$.listen" {
+		t.Fatalf("drift after conflict = %+v, %v", drift, err)
+	}
+
+	// Rolling back restores the merged file of 1.1.0 and clears the conflict
+	if _, err := u.RollbackPackage(); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if drift, err := u.GetConfDrift(); err != nil || drift.Conflict != nil || len(drift.Changes) != 1 {
+		t.Errorf("drift after rollback = %+v, %v", drift, err)
+	}
+}
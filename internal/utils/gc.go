@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zgsm-ai/smc/internal/env"
+)
+
+/**
+ *	缓存清理的原因
+ */
+const (
+	CleanupKeep  = "keep"  //超出每个包保留的版本数
+	CleanupAge   = "age"   //超过最长保留时间
+	CleanupQuota = "quota" //缓存总大小超过上限
+)
+
+/**
+ *	缓存中的一个版本
+ */
+type CacheEntry struct {
+	VersionSummary
+	Size      int64     //占用的空间(包文件、包描述及archive包解压出的文件)
+	Time      time.Time //下载时间
+	Protected string    //不能删除的原因: active/pinned/todo/previous，为空则可以删除
+	Reason    string    //被清理的原因，为空则保留
+}
+
+/**
+ *	未设置时从SMC_CACHE_KEEP/SMC_CACHE_MAX_SIZE/SMC_CACHE_MAX_AGE获取保留策略
+ */
+func (u *Upgrader) correctRetention() {
+	if u.CacheKeep <= 0 {
+		u.CacheKeep = env.CacheKeep
+	}
+	if u.CacheKeep <= 0 {
+		u.CacheKeep = 3
+	}
+	if u.CacheMaxSize <= 0 && env.CacheMaxSize != "" {
+		q, err := QuantityParse(env.CacheMaxSize)
+		if err == nil {
+			err = q.ChangeUnit("")
+		}
+		if err != nil {
+			log.Printf("Invalid SMC_CACHE_MAX_SIZE '%s': %v\n", env.CacheMaxSize, err)
+		} else {
+			u.CacheMaxSize = q.Amend
+		}
+	}
+	if u.CacheMaxAge <= 0 && env.CacheMaxAge != "" {
+		secs, err := Time2Sec(env.CacheMaxAge)
+		if err != nil {
+			log.Printf("Invalid SMC_CACHE_MAX_AGE '%s': %v\n", env.CacheMaxAge, err)
+		} else {
+			u.CacheMaxAge = time.Duration(secs) * time.Second
+		}
+	}
+}
+
+func fileSize(fpath string) int64 {
+	if info, err := os.Stat(fpath); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+/**
+ *	获取包pkgName不能删除的版本：激活的、固定的、待升级的及回退用的前一版本
+ */
+func (u *Upgrader) protectedVersions(pkgName string) map[string]string {
+	protected := make(map[string]string)
+	files := []struct{ fpath, reason string }{
+		{filepath.Join(u.packageDir, "prev", pkgName+".json"), "previous"},
+		{filepath.Join(u.packageDir, "todos", pkgName+".json"), "todo"},
+		{filepath.Join(u.packageDir, "pinned", pkgName+".json"), "pinned"},
+		{filepath.Join(u.packageDir, pkgName+".json"), "active"},
+	}
+	for _, f := range files {
+		var pkg PackageVersion
+		if err := pkg.Load(f.fpath); err == nil {
+			protected[pkg.VersionId.String()] = f.reason
+		}
+	}
+	return protected
+}
+
+/**
+ *	扫描缓存中所有包的版本，按包名分组，每组按版本号从新到旧排序
+ */
+func (u *Upgrader) scanCache() (map[string][]*CacheEntry, error) {
+	files, err := os.ReadDir(u.packageDir)
+	if err != nil {
+		log.Printf("Cleanup: package directory '%s' read failed: %v\n", u.packageDir, err)
+		return nil, err
+	}
+	entries := make(map[string][]*CacheEntry)
+	// 遍历文件，找出所有版本描述文件（格式：{packageName}-{version}.json）
+	for _, file := range files {
+		filename := file.Name()
+		// 跳过目录、archive包的文件清单及不带'-'的激活版本描述文件
+		if file.IsDir() || !strings.HasSuffix(filename, ".json") || strings.HasSuffix(filename, ".files.json") ||
+			!strings.Contains(filename, "-") {
+			continue
+		}
+		filePath := filepath.Join(u.packageDir, filename)
+		var pkg PackageVersion
+		if err := pkg.Load(filePath); err != nil {
+			log.Printf("Cleanup: Load '%s' failed: %v\n", filePath, err)
+			continue
+		}
+		if pkg.PackageName == "" || filename != fmt.Sprintf("%s-%s.json", pkg.PackageName, pkg.VersionId.String()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		versionStr := pkg.VersionId.String()
+		_, fname := filepath.Split(pkg.FileName)
+		entry := &CacheEntry{
+			VersionSummary: VersionSummary{
+				PackageName: pkg.PackageName,
+				Version:     pkg.VersionId,
+				PackageDir:  filepath.Join(u.packageDir, versionStr),
+				DescPath:    filePath,
+				DataPath:    filepath.Join(u.packageDir, versionStr, fname),
+			},
+			Time: info.ModTime(),
+		}
+		entry.Size = info.Size() + fileSize(entry.DataPath)
+		if pkg.PackageType == PackageTypeArchive {
+			entry.ManifestPath = strings.TrimSuffix(filePath, ".json") + ".files.json"
+			var manifest PackageManifest
+			if err := manifest.Load(entry.ManifestPath); err == nil {
+				for _, f := range manifest.Files {
+					entry.Size += fileSize(filepath.Join(manifest.Dir, f))
+				}
+			}
+		}
+		entries[pkg.PackageName] = append(entries[pkg.PackageName], entry)
+	}
+	for name, versions := range entries {
+		sort.Slice(versions, func(i, j int) bool {
+			return CompareVersion(versions[i].Version, versions[j].Version) > 0
+		})
+		protected := u.protectedVersions(name)
+		for _, e := range versions {
+			e.Protected = protected[e.Version.String()]
+		}
+	}
+	return entries, nil
+}
+
+/**
+ *	按保留策略决定要清理的版本
+ *	@description
+ *	- 每个包保留最新的CacheKeep个版本
+ *	- 设置了CacheMaxAge时，清理下载时间超过CacheMaxAge的版本
+ *	- 设置了CacheMaxSize时，缓存总大小超过上限则继续从最早下载的版本开始清理，可以少于CacheKeep个
+ *	- 激活、固定、待升级及可回退的版本始终保留
+ */
+func (u *Upgrader) planCleanup(entries map[string][]*CacheEntry) []*CacheEntry {
+	var all []*CacheEntry
+	var total int64
+	now := time.Now()
+	for _, versions := range entries {
+		for i, e := range versions {
+			all = append(all, e)
+			if e.Protected == "" {
+				if i >= u.CacheKeep {
+					e.Reason = CleanupKeep
+				} else if u.CacheMaxAge > 0 && now.Sub(e.Time) > u.CacheMaxAge {
+					e.Reason = CleanupAge
+				}
+			}
+			if e.Reason == "" {
+				total += e.Size
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].PackageName != all[j].PackageName {
+			return all[i].PackageName < all[j].PackageName
+		}
+		return CompareVersion(all[i].Version, all[j].Version) > 0
+	})
+	if u.CacheMaxSize > 0 && total > u.CacheMaxSize {
+		oldest := make([]*CacheEntry, len(all))
+		copy(oldest, all)
+		sort.SliceStable(oldest, func(i, j int) bool {
+			return oldest[i].Time.Before(oldest[j].Time)
+		})
+		for _, e := range oldest {
+			if total <= u.CacheMaxSize {
+				break
+			}
+			if e.Protected == "" && e.Reason == "" {
+				e.Reason = CleanupQuota
+				total -= e.Size
+			}
+		}
+	}
+	return all
+}
+
+/**
+ *	按保留策略清理缓存
+ *	@param {bool} dryRun - 为true则只计算，不删除
+ *	@returns {[]CacheEntry} 缓存中所有的版本，Reason不为空的是被清理(dryRun时为可清理)的版本
+ */
+func (u *Upgrader) CleanupCache(dryRun bool) ([]CacheEntry, error) {
+	if _, err := os.Stat(u.packageDir); os.IsNotExist(err) {
+		log.Printf("Cleanup: package directory '%s' does not exist\n", u.packageDir)
+		return nil, err
+	}
+	entries, err := u.scanCache()
+	if err != nil {
+		return nil, err
+	}
+	var result []CacheEntry
+	for _, e := range u.planCleanup(entries) {
+		if e.Reason != "" && !dryRun {
+			removeCachedVersion(e.VersionSummary)
+		}
+		result = append(result, *e)
+	}
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCleanupCache checks keep-N, max age and quota policies, and that protected versions survive
+func TestCleanupCache(t *testing.T) {
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), CacheKeep: 3})
+	os.MkdirAll(u.packageDir, 0775)
+	// app 1.0.0 ~ 1.0.5 downloaded one day apart, 1.0.0 is active, 1.0.1 is pinned
+	now := time.Now()
+	for i := 0; i <= 5; i++ {
+		pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+			VersionId: VersionNumber{Major: 1, Micro: i}}
+		ver := pkg.VersionId.String()
+		os.MkdirAll(filepath.Join(u.packageDir, ver), 0775)
+		os.WriteFile(filepath.Join(u.packageDir, ver, "app"), testContent(1000), 0644)
+		desc := filepath.Join(u.packageDir, "app-"+ver+".json")
+		pkg.Save(desc)
+		mtime := now.Add(time.Duration(i-6) * 24 * time.Hour)
+		os.Chtimes(desc, mtime, mtime)
+		switch i {
+		case 0:
+			pkg.Save(filepath.Join(u.packageDir, "app.json"))
+		case 1:
+			u.AddPinned(pkg)
+		}
+	}
+	reasons := func(entries []CacheEntry) map[string]string {
+		m := make(map[string]string)
+		for _, e := range entries {
+			m[e.Version.String()] = e.Reason + e.Protected
+		}
+		return m
+	}
+	entries, err := u.CleanupCache(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"1.0.5": "", "1.0.4": "", "1.0.3": "", "1.0.2": CleanupKeep, "1.0.1": "pinned", "1.0.0": "active"}
+	if got := reasons(entries); len(got) != len(want) {
+		t.Fatalf("entries = %v", got)
+	} else {
+		for ver, r := range want {
+			if got[ver] != r {
+				t.Errorf("%s: %s, want %s", ver, got[ver], r)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(u.packageDir, "1.0.2", "app")); err != nil {
+		t.Error("dry run removed a version")
+	}
+
+	u.CacheMaxAge = 2*24*time.Hour + time.Hour
+	u.CacheMaxSize = 4500
+	entries, err = u.CleanupCache(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reasons(entries)
+	// 1.0.3 is too old; the quota then removes the oldest unprotected one, 1.0.4
+	if got["1.0.3"] != CleanupAge || got["1.0.4"] != CleanupQuota || got["1.0.5"] != "" {
+		t.Errorf("entries = %v", got)
+	}
+	for _, ver := range []string{"1.0.2", "1.0.3", "1.0.4"} {
+		if _, err := os.Stat(filepath.Join(u.packageDir, ver)); !os.IsNotExist(err) {
+			t.Errorf("%s isn't removed", ver)
+		}
+	}
+	for _, ver := range []string{"1.0.0", "1.0.1", "1.0.5"} {
+		if _, err := os.Stat(filepath.Join(u.packageDir, ver, "app")); err != nil {
+			t.Errorf("%s is removed", ver)
+		}
+	}
+}
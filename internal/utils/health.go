@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ *	服务健康检查的结果
+ */
+type HealthResult struct {
+	Name     string        `json:"name"`
+	Protocol string        `json:"protocol"`
+	Address  string        `json:"address"` //检查的地址，http服务为URL
+	Healthy  bool          `json:"healthy"`
+	Latency  time.Duration `json:"latency"`
+	Message  string        `json:"message"`
+}
+
+/**
+ *	服务的访问地址，服务在运行时使用实际分配的端口
+ */
+func ServiceAddress(spec ServiceSpec, baseDir string) string {
+	port := spec.Port
+	if state, err := LoadServiceState(baseDir, spec.Name); err == nil && state.Active() && state.Port > 0 {
+		port = state.Port
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+/**
+ *	把服务的接口路径转换为URL，path本身是URL时原样返回
+ */
+func serviceUrl(spec ServiceSpec, baseDir, path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	scheme := "http"
+	if spec.Protocol == "https" {
+		scheme = "https"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, ServiceAddress(spec, baseDir), path)
+}
+
+/**
+ *	检查服务的健康状态
+ *	@description
+ *	- http/https服务：GET健康检查路径，声明了health时要求返回2xx，否则请求'/'，返回非5xx即认为健康
+ *	- 其它服务：能建立TCP连接即认为健康
+ */
+func CheckServiceHealth(spec ServiceSpec, baseDir string, timeout time.Duration) HealthResult {
+	result := HealthResult{Name: spec.Name, Protocol: spec.Protocol}
+	start := time.Now()
+	if spec.Protocol != "http" && spec.Protocol != "https" {
+		result.Address = ServiceAddress(spec, baseDir)
+		conn, err := net.DialTimeout("tcp", result.Address, timeout)
+		result.Latency = time.Since(start)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		conn.Close()
+		result.Healthy = true
+		result.Message = "connected"
+		return result
+	}
+	path := spec.Health
+	if path == "" {
+		path = "/"
+	}
+	result.Address = serviceUrl(spec, baseDir, path)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(result.Address)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.Message = resp.Status
+	if spec.Health != "" {
+		result.Healthy = resp.StatusCode >= 200 && resp.StatusCode < 300
+	} else {
+		result.Healthy = resp.StatusCode < 500
+	}
+	return result
+}
+
+/**
+ *	抓取服务metrics接口的指标
+ */
+func ScrapeMetrics(spec ServiceSpec, baseDir string, timeout time.Duration) ([]MetricFamily, error) {
+	if spec.Metrics == "" {
+		return nil, fmt.Errorf("service '%s' doesn't declare a metrics endpoint", spec.Name)
+	}
+	urlStr := serviceUrl(spec, baseDir, spec.Metrics)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET '%s' failed: %s", urlStr, resp.Status)
+	}
+	families, err := ParseMetrics(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse metrics of '%s' failed: %v", urlStr, err)
+	}
+	return families, nil
+}
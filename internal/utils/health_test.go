@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServiceHealth checks HTTP and TCP probes, and scraping the metrics endpoint of a service
+func TestServiceHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/metrics":
+			fmt.Fprintln(w, "# TYPE jobs gauge\njobs 3")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	baseDir := t.TempDir()
+	spec := ServiceSpec{Name: "svc", Protocol: "http", Port: port, Metrics: "/metrics"}
+
+	if r := CheckServiceHealth(spec, baseDir, time.Second); !r.Healthy {
+		t.Errorf("http service without health path = %+v", r)
+	}
+	spec.Health = "/healthz"
+	if r := CheckServiceHealth(spec, baseDir, time.Second); r.Healthy || r.Message != "503 Service Unavailable" {
+		t.Errorf("unhealthy http service = %+v", r)
+	}
+	tcp := ServiceSpec{Name: "tcp", Protocol: "tcp", Port: port}
+	if r := CheckServiceHealth(tcp, baseDir, time.Second); !r.Healthy {
+		t.Errorf("tcp service = %+v", r)
+	}
+	families, err := ScrapeMetrics(spec, baseDir, time.Second)
+	if err != nil || len(families) != 1 || families[0].Samples[0].Value != 3 {
+		t.Errorf("metrics = %+v, %v", families, err)
+	}
+
+	srv.Close()
+	if r := CheckServiceHealth(tcp, baseDir, time.Second); r.Healthy {
+		t.Errorf("stopped service = %+v", r)
+	}
+}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iancoleman/orderedmap"
+)
+
+/**
+ *	索引文件(packages.json/platforms.json/platform.json)的签名信息
+ *	签名覆盖除signature字段外的全部内容，serial和expires用于防止回滚和冻结攻击
+ */
+type IndexMeta struct {
+	Serial    uint64 `json:"serial,omitempty"`    //索引序号，每次重新生成都会增大
+	Expires   int64  `json:"expires,omitempty"`   //过期时间(Unix时间戳，秒)
+	KeyId     string `json:"keyId,omitempty"`     //签名所用密钥的ID
+	Signature string `json:"signature,omitempty"` //签名(十六进制)
+}
+
+/**
+ *	客户端记录的最后一次见到的各索引文件序号
+ */
+type indexState struct {
+	Serials map[string]uint64 `json:"serials"`
+}
+
+/**
+ *	计算索引文件的规范化内容：去掉signature字段，按键名排序序列化
+ */
+func canonicalIndex(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	delete(obj, "signature")
+	return json.Marshal(obj)
+}
+
+/**
+ *	对索引文件内容data签名，填写serial/expires/keyId/signature字段后返回新的内容
+ */
+func SignIndex(priKey []byte, data []byte, serial uint64, expires time.Time) ([]byte, error) {
+	pubKey, err := PublicKeyOf(priKey)
+	if err != nil {
+		return nil, err
+	}
+	keyId, err := KeyIdOf(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	om := orderedmap.New()
+	if err := json.Unmarshal(data, om); err != nil {
+		return nil, err
+	}
+	om.Delete("signature")
+	om.Set("serial", serial)
+	om.Set("expires", expires.Unix())
+	om.Set("keyId", keyId)
+	unsigned, err := json.Marshal(om)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := canonicalIndex(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Sign(priKey, canonical)
+	if err != nil {
+		return nil, err
+	}
+	om.Set("signature", hex.EncodeToString(sig))
+	return json.MarshalIndent(om, "", "  ")
+}
+
+/**
+ *	读取已有索引文件的序号，文件不存在或无法解析时返回0
+ */
+func LoadIndexSerial(fname string) uint64 {
+	bytes, err := os.ReadFile(fname)
+	if err != nil {
+		return 0
+	}
+	var meta IndexMeta
+	if err := json.Unmarshal(bytes, &meta); err != nil {
+		return 0
+	}
+	return meta.Serial
+}
+
+/**
+ *	计算新索引的序号：保证单调递增，并尽量与时间相关，避免清空构建目录后序号回退
+ */
+func NextIndexSerial(fname string) uint64 {
+	serial := LoadIndexSerial(fname) + 1
+	if now := uint64(time.Now().Unix()); now > serial {
+		serial = now
+	}
+	return serial
+}
+
+/**
+ *	验证云端索引文件：签名、有效期、序号(防回滚)
+ *	@param {string} name - 索引文件相对BaseUrl的路径，用于记录序号
+ *	@param {[]byte} data - 索引文件内容
+ */
+func (u *Upgrader) verifyIndex(name string, data []byte) error {
+	meta, err := u.verifyIndexSignature(name, data)
+	if err != nil || meta.Signature == "" {
+		return err
+	}
+	return u.checkIndexSerial(name, meta.Serial)
+}
+
+/**
+ *	验证索引文件的签名和有效期
+ *	未签名的索引只在索引校验策略为兼容时接受，且该索引此前从未出现过签名的版本：
+ *	见过签名的索引后又收到未签名的，说明签名被剥离，可能是回滚攻击
+ */
+func (u *Upgrader) verifyIndexSignature(name string, data []byte) (IndexMeta, error) {
+	var meta IndexMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, err
+	}
+	if meta.Signature == "" {
+		if u.IndexPolicy != VerifyPolicyCompat {
+			return meta, fmt.Errorf("index '%s' is unsigned, rejected by index policy '%s'", name, u.IndexPolicy)
+		}
+		if last := u.loadIndexState().Serials[name]; last != 0 {
+			return meta, fmt.Errorf("index '%s' is unsigned, but a signed one with serial %d was seen, possible rollback attack", name, last)
+		}
+		log.Printf("Index '%s' is unsigned, accepted by index policy '%s'\n", name, u.IndexPolicy)
+		return meta, nil
+	}
+	sig, err := hex.DecodeString(meta.Signature)
+	if err != nil {
+		return meta, fmt.Errorf("index '%s' signature decode error: %v", name, err)
+	}
+	pubKey, err := u.publicKeyFor(meta.KeyId)
+	if err != nil {
+		return meta, fmt.Errorf("index '%s': %v", name, err)
+	}
+	canonical, err := canonicalIndex(data)
+	if err != nil {
+		return meta, err
+	}
+	if err := VerifySign(pubKey, sig, canonical); err != nil {
+		return meta, fmt.Errorf("index '%s' signature error: %v", name, err)
+	}
+	if meta.Expires == 0 || time.Now().Unix() > meta.Expires {
+		return meta, fmt.Errorf("index '%s' is expired", name)
+	}
+	return meta, nil
+}
+
+func (u *Upgrader) indexStateFile() string {
+	return filepath.Join(u.packageDir, "index-state.json")
+}
+
+/**
+ *	读取记录的索引序号
+ */
+func (u *Upgrader) loadIndexState() *indexState {
+	fname := u.indexStateFile()
+	state := &indexState{}
+	if bytes, err := os.ReadFile(fname); err == nil {
+		if err := json.Unmarshal(bytes, state); err != nil {
+			log.Printf("Load index state '%s' failed: %v\n", fname, err)
+		}
+	}
+	if state.Serials == nil {
+		state.Serials = make(map[string]uint64)
+	}
+	return state
+}
+
+/**
+ *	检查索引序号不小于上次见到的序号，并记录新的序号
+ */
+func (u *Upgrader) checkIndexSerial(name string, serial uint64) error {
+	fname := u.indexStateFile()
+	state := u.loadIndexState()
+	last := state.Serials[name]
+	if serial < last {
+		return fmt.Errorf("index '%s' serial %d is older than %d, possible rollback attack", name, serial, last)
+	}
+	if serial == last {
+		return nil
+	}
+	state.Serials[name] = serial
+	bytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(u.packageDir, 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(fname, bytes, 0644)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestVerifyIndex checks signature, expiry and rollback protection of index files
+func TestVerifyIndex(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), PublicKey: string(pubKey), Policy: VerifyPolicyStrict})
+	plat := PlatformInfo{PackageName: "app", Os: "linux", Arch: "amd64"}
+	plat.Newest.VersionId = VersionNumber{Major: 1, Minor: 2, Micro: 3}
+	plat.Newest.AppUrl = "/app/linux/amd64/1.2.3/app"
+	plat.Versions = append(plat.Versions, plat.Newest)
+	unsigned, _ := json.MarshalIndent(plat, "", "  ")
+	const name = "app/linux/amd64/platform.json"
+
+	sign := func(serial uint64, expires time.Time) []byte {
+		data, err := SignIndex(priKey, unsigned, serial, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	future := time.Now().Add(time.Hour)
+
+	if err := u.verifyIndex(name, sign(10, future)); err != nil {
+		t.Fatalf("valid index rejected: %v", err)
+	}
+	var got PlatformInfo
+	if err := json.Unmarshal(sign(10, future), &got); err != nil || got.Serial != 10 || got.Newest.AppUrl != plat.Newest.AppUrl {
+		t.Errorf("signed index content changed: %+v, %v", got, err)
+	}
+	tampered := strings.Replace(string(sign(11, future)), "1.2.3", "1.2.4", 1)
+	tampered = strings.Replace(tampered, `"micro": 3`, `"micro": 2`, 1)
+	if err := u.verifyIndex(name, []byte(tampered)); err == nil {
+		t.Error("tampered index accepted")
+	}
+	if err := u.verifyIndex(name, sign(12, time.Now().Add(-time.Minute))); err == nil {
+		t.Error("expired index accepted")
+	}
+	if err := u.verifyIndex(name, sign(9, future)); err == nil {
+		t.Error("older index accepted")
+	}
+	if err := u.verifyIndex(name, sign(10, future)); err != nil {
+		t.Errorf("same serial rejected: %v", err)
+	}
+	if err := u.verifyIndex(name, unsigned); err == nil {
+		t.Error("unsigned index accepted by strict policy")
+	}
+	// The package policy doesn't loosen the index policy, which is strict by default
+	u.Policy = VerifyPolicyCompat
+	if err := u.verifyIndex("other/linux/amd64/platform.json", unsigned); err == nil {
+		t.Error("unsigned index accepted by the default index policy")
+	}
+	u.IndexPolicy = VerifyPolicyCompat
+	if err := u.verifyIndex("other/linux/amd64/platform.json", unsigned); err != nil {
+		t.Errorf("unsigned index rejected by compat index policy: %v", err)
+	}
+	if err := u.verifyIndex(name, unsigned); err == nil {
+		t.Error("unsigned index accepted by compat index policy after a signed one was seen")
+	}
+}
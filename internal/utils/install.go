@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+/**
+ *	激活后健康检查失败，已恢复到之前的版本
+ */
+var ErrProbeFailed = errors.New("health probe failed")
+
+/**
+ *	健康检查的超时时间
+ */
+const probeTimeout = 10 * time.Second
+
+/**
+ *	包的安装路径(exec/conf包)
+ */
+func (u *Upgrader) installPath(pkg PackageVersion) string {
+	if u.TargetPath != "" {
+		return u.TargetPath
+	}
+	dir, fname := filepath.Split(pkg.FileName)
+	if dir != "" {
+		return filepath.Join(u.BaseDir, pkg.FileName)
+	}
+	return filepath.Join(u.installDir, fname)
+}
+
+/**
+ *	用src替换dst，src和dst须位于同一目录
+ *	windows上不能覆盖正在运行的程序，但可以对其改名，所以先把dst改名为dst.old
+ */
+func replaceFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || runtime.GOOS != "windows" {
+		return err
+	}
+	old := dst + ".old"
+	os.Remove(old)
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+/**
+ *	把src的内容原子地写入dst：先写入dst所在目录的临时文件，再改名为dst
+ *	中途失败时dst保持原样
+ */
+func copyFileAtomic(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeAtomic(dst, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+/**
+ *	把data原子地写入文件fname
+ */
+func writeFileAtomic(fname string, data []byte, perm os.FileMode) error {
+	return writeAtomic(fname, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+func writeAtomic(fname string, perm os.FileMode, write func(w io.Writer) error) error {
+	dir, base := filepath.Split(fname)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return replaceFile(tmpName, fname)
+}
+
+/**
+ *	前一版本的备份：package/prev/{package}.json为包描述，package/prev/{package}.data为安装的数据文件
+ */
+func (u *Upgrader) prevFiles() (string, string) {
+	prevDir := filepath.Join(u.packageDir, "prev")
+	return filepath.Join(prevDir, u.packageName+".json"), filepath.Join(prevDir, u.packageName+".data")
+}
+
+/**
+ *	获取前一版本的包描述
+ */
+func (u *Upgrader) GetPrevious() (pkg PackageVersion, err error) {
+	descFile, _ := u.prevFiles()
+	err = pkg.Load(descFile)
+	return
+}
+
+/**
+ *	备份当前激活的版本cur，以便回退
+ *	archive包解压在版本目录中，新版本不会覆盖旧版本，只需备份包描述
+ */
+func (u *Upgrader) backupPackage(cur PackageVersion) error {
+	descFile, dataFile := u.prevFiles()
+	if err := os.MkdirAll(filepath.Dir(descFile), 0775); err != nil {
+		return err
+	}
+	os.Remove(dataFile)
+	if cur.PackageType != PackageTypeArchive {
+		dataPath := u.installPath(cur)
+		if _, err := os.Stat(dataPath); err == nil {
+			if err := copyFileAtomic(dataPath, dataFile, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return cur.Save(descFile)
+}
+
+/**
+ *	删除前一版本的备份
+ */
+func (u *Upgrader) removeBackup() {
+	descFile, dataFile := u.prevFiles()
+	os.Remove(descFile)
+	os.Remove(dataFile)
+}
+
+/**
+ *	激活后的健康检查
+ *	- exec包: 运行安装的程序，参数为包描述中声明的probe，如'--version'
+ *	- archive包: 运行解压目录中的程序，probe的第一项为程序相对解压目录的路径
+ *	- 未声明probe(含只有空白)、声明为'none'或conf包不做检查；常驻的服务程序未必会对参数立即退出，须由发布者显式声明
+ */
+func (u *Upgrader) probePackage(pkg PackageVersion) error {
+	fields := strings.Fields(pkg.Probe)
+	if len(fields) == 0 || pkg.Probe == "none" {
+		return nil
+	}
+	var prog string
+	var args []string
+	switch pkg.PackageType {
+	case PackageTypeExec:
+		prog = u.installPath(pkg)
+		args = fields
+	case PackageTypeArchive:
+		p, err := safeJoin(u.archiveDir(pkg), fields[0])
+		if err != nil {
+			return err
+		}
+		prog, args = p, fields[1:]
+	default:
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, prog, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("'%s %s' timeout", prog, strings.Join(args, " "))
+	}
+	if err != nil {
+		return fmt.Errorf("'%s %s' failed: %v, output: %s", prog, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+/**
+ *	恢复前一版本prev
+ *	exec/conf包优先使用备份的数据文件dataFile，没有备份时使用缓存的包文件
+ *	conf包备份的数据文件含有本地的修改，恢复后以前一版本缓存的包文件为原始文件
+ *	archive包的版本目录仍然存在，有缓存的包文件时重新解压，修复被删改的文件
+ */
+func (u *Upgrader) restorePackage(prev PackageVersion, dataFile string) error {
+	pkgFile := filepath.Join(u.packageDir, fmt.Sprintf("%s.json", u.packageName))
+	if prev.PackageType != PackageTypeArchive {
+		if _, err := os.Stat(dataFile); err == nil {
+			if err := u.savePackageData(prev, dataFile); err != nil {
+				return err
+			}
+			if prev.PackageType == PackageTypeConf {
+				u.restorePristine(prev)
+			}
+			return prev.Save(pkgFile)
+		}
+	}
+	_, fname := filepath.Split(prev.FileName)
+	cacheFname := filepath.Join(u.packageDir, prev.VersionId.String(), fname)
+	if _, err := u.checkLocalPackage(prev.VersionId); err == nil {
+		if err := u.installPackage(prev, cacheFname); err != nil {
+			return err
+		}
+	} else if prev.PackageType != PackageTypeArchive {
+		return fmt.Errorf("no backup of version %s", prev.VersionId.String())
+	} else if _, err := os.Stat(u.manifestFile(prev.VersionId)); err != nil {
+		return fmt.Errorf("files of version %s are missing", prev.VersionId.String())
+	}
+	return prev.Save(pkgFile)
+}
+
+/**
+ *	激活失败后恢复到激活前的状态
+ *	@param {*PackageVersion} prev - 激活前的版本，为nil表示激活前没有安装该包
+ */
+func (u *Upgrader) revertPackage(failed PackageVersion, prev *PackageVersion) error {
+	if prev != nil {
+		_, dataFile := u.prevFiles()
+		return u.restorePackage(*prev, dataFile)
+	}
+	if failed.PackageType == PackageTypeArchive {
+		u.removeManifestFiles(failed.VersionId)
+	} else {
+		os.Remove(u.installPath(failed))
+	}
+	return os.Remove(filepath.Join(u.packageDir, fmt.Sprintf("%s.json", u.packageName)))
+}
+
+/**
+ *	回退到前一版本，当前版本成为新的备份，因此再次回退会回到当前版本
+ */
+func (u *Upgrader) RollbackPackage() (PackageVersion, error) {
+	prev, err := u.GetPrevious()
+	if err != nil {
+		return prev, fmt.Errorf("no previous version of '%s'", u.packageName)
+	}
+	cur, err := u.GetLocalVersion(nil)
+	if err != nil {
+		return prev, fmt.Errorf("package '%s' is not installed", u.packageName)
+	}
+	//	先把备份的数据文件移开，再备份当前版本
+	descFile, dataFile := u.prevFiles()
+	prevData := dataFile + ".rollback"
+	os.Remove(prevData)
+	if _, err := os.Stat(dataFile); err == nil {
+		if err := os.Rename(dataFile, prevData); err != nil {
+			return prev, err
+		}
+	}
+	defer os.Remove(prevData)
+	if err := u.backupPackage(cur); err != nil {
+		os.Rename(prevData, dataFile)
+		return prev, err
+	}
+	if err := u.restorePackage(prev, prevData); err != nil {
+		//	安装是原子的，恢复失败时当前版本仍然有效，把备份还原为前一版本
+		os.Rename(prevData, dataFile)
+		prev.Save(descFile)
+		return prev, err
+	}
+	if err := u.probePackage(prev); err != nil {
+		log.Printf("Probe package '%s-%s' failed after rollback: %v\n", u.packageName, prev.VersionId.String(), err)
+	}
+	return prev, nil
+}
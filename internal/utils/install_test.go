@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestActivateRollback checks automatic revert on a failed probe and manual rollback
+func TestActivateRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("probe scripts need a unix shell")
+	}
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), NoSetPath: true})
+	scripts := map[string]string{
+		"1.0.0": "#!/bin/sh\necho 1.0.0\n",
+		"1.0.1": "#!/bin/sh\nexit 1\n",
+		"1.0.2": "#!/bin/sh\necho 1.0.2\n",
+	}
+	pkgs := make(map[string]PackageVersion)
+	for ver, script := range scripts {
+		pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app", Probe: "--version"}
+		pkg.VersionId.Parse(ver)
+		os.MkdirAll(filepath.Join(u.packageDir, ver), 0775)
+		os.WriteFile(filepath.Join(u.packageDir, ver, "app"), []byte(script), 0755)
+		pkgs[ver] = pkg
+	}
+	installed := func() string {
+		data, _ := os.ReadFile(filepath.Join(u.installDir, "app"))
+		cur, _ := u.GetLocalVersion(nil)
+		if string(data) != scripts[cur.VersionId.String()] {
+			t.Fatalf("installed file doesn't match active version %s", cur.VersionId.String())
+		}
+		return cur.VersionId.String()
+	}
+
+	if err := u.activatePackage(pkgs["1.0.0"]); err != nil {
+		t.Fatalf("activate 1.0.0: %v", err)
+	}
+	if err := u.activatePackage(pkgs["1.0.1"]); !errors.Is(err, ErrProbeFailed) {
+		t.Fatalf("activate broken 1.0.1: %v", err)
+	}
+	if ver := installed(); ver != "1.0.0" {
+		t.Errorf("not reverted after failed probe, active %s", ver)
+	}
+	if err := u.activatePackage(pkgs["1.0.2"]); err != nil {
+		t.Fatalf("activate 1.0.2: %v", err)
+	}
+
+	// Rollback switches between the active and the previous version
+	for _, want := range []string{"1.0.0", "1.0.2"} {
+		prev, err := u.RollbackPackage()
+		if err != nil || prev.VersionId.String() != want {
+			t.Fatalf("RollbackPackage = %s, %v, want %s", prev.VersionId.String(), err, want)
+		}
+		if ver := installed(); ver != want {
+			t.Errorf("active version %s after rollback, want %s", ver, want)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(u.installDir, ".app.*")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
+
+// TestBlankProbe checks a probe of only whitespace means no probe instead of a panic
+func TestBlankProbe(t *testing.T) {
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), NoSetPath: true})
+	for _, typ := range []PackageType{PackageTypeExec, PackageTypeArchive} {
+		for _, probe := range []string{"", " ", "\t\n", "none"} {
+			pkg := PackageVersion{PackageName: "app", PackageType: typ, FileName: "app.tar.gz", Probe: probe}
+			if err := u.probePackage(pkg); err != nil {
+				t.Errorf("probe %q of %s package: %v", probe, typ, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/iancoleman/orderedmap"
+)
+
+/**
+ *	解析JSON，对象解析为保持键顺序的*orderedmap.OrderedMap，以便合并后输出的顺序与原文件一致
+ */
+func ParseOrderedJSON(data []byte) (interface{}, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	switch raw.(type) {
+	case map[string]interface{}:
+		o := orderedmap.New()
+		if err := json.Unmarshal(data, o); err != nil {
+			return nil, err
+		}
+		return normalizeJSON(o), nil
+	case []interface{}:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			v, err := ParseOrderedJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return raw, nil
+}
+
+/**
+ *	把嵌套的orderedmap.OrderedMap值统一为指针，并关闭HTML转义
+ */
+func normalizeJSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case orderedmap.OrderedMap:
+		return normalizeJSON(&x)
+	case *orderedmap.OrderedMap:
+		x.SetEscapeHTML(false)
+		for _, k := range x.Keys() {
+			val, _ := x.Get(k)
+			x.Set(k, normalizeJSON(val))
+		}
+		return x
+	case []interface{}:
+		for i := range x {
+			x[i] = normalizeJSON(x[i])
+		}
+		return x
+	}
+	return v
+}
+
+/**
+ *	把JSON值输出为缩进两个空格、以换行结尾的文本
+ */
+func MarshalOrderedJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, bytes.TrimSpace(buf.Bytes()), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+/**
+ *	按JSON Merge Patch(RFC 7386)把patch合并到target，返回合并的结果
+ *	@description
+ *	- patch不是对象时替换target
+ *	- patch中值为null的键从target中删除，对象递归合并，其它值替换
+ *	- 数组整体替换
+ */
+func MergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(*orderedmap.OrderedMap)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(*orderedmap.OrderedMap)
+	if !ok {
+		t = orderedmap.New()
+		t.SetEscapeHTML(false)
+	}
+	for _, k := range p.Keys() {
+		pv, _ := p.Get(k)
+		if pv == nil {
+			t.Delete(k)
+			continue
+		}
+		tv, _ := t.Get(k)
+		t.Set(k, MergePatch(tv, pv))
+	}
+	return t
+}
+
+/**
+ *	两个JSON值之间的一处差异
+ */
+type JSONChange struct {
+	Path string      `json:"path"`          //差异的位置，如 $.service.port
+	Old  interface{} `json:"old,omitempty"` //原来的值，为nil表示新增
+	New  interface{} `json:"new,omitempty"` //新的值，为nil表示删除
+}
+
+/**
+ *	值的紧凑JSON文本，用于显示差异
+ */
+func JSONText(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return JSONText(a) == JSONText(b)
+}
+
+/**
+ *	比较两个JSON值，返回按路径列出的差异
+ *	对象逐键比较，长度相同的数组逐项比较，其它情况整体比较
+ */
+func DiffJSON(a, b interface{}) []JSONChange {
+	var changes []JSONChange
+	diffJSON(a, b, "$", &changes)
+	return changes
+}
+
+func diffJSON(a, b interface{}, path string, changes *[]JSONChange) {
+	am, aok := a.(*orderedmap.OrderedMap)
+	bm, bok := b.(*orderedmap.OrderedMap)
+	if aok && bok {
+		for _, k := range am.Keys() {
+			av, _ := am.Get(k)
+			bv, exists := bm.Get(k)
+			if !exists {
+				*changes = append(*changes, JSONChange{Path: path + "." + k, Old: av})
+				continue
+			}
+			diffJSON(av, bv, path+"."+k, changes)
+		}
+		for _, k := range bm.Keys() {
+			if _, exists := am.Get(k); !exists {
+				bv, _ := bm.Get(k)
+				*changes = append(*changes, JSONChange{Path: path + "." + k, New: bv})
+			}
+		}
+		return
+	}
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok && len(al) == len(bl) {
+		for i := range al {
+			diffJSON(al[i], bl[i], fmt.Sprintf("%s[%d]", path, i), changes)
+		}
+		return
+	}
+	if !jsonEqual(a, b) {
+		*changes = append(*changes, JSONChange{Path: path, Old: a, New: b})
+	}
+}
+
+/**
+ *	三方合并的一处冲突：本地和新版本对同一位置做了不同的修改
+ */
+type JSONConflict struct {
+	Path  string      `json:"path"`            //冲突的位置
+	Base  interface{} `json:"base,omitempty"`  //旧版本的值，为nil表示不存在
+	Local interface{} `json:"local,omitempty"` //本地的值，为nil表示已删除
+	New   interface{} `json:"new,omitempty"`   //新版本的值，为nil表示已删除
+}
+
+/**
+ *	JSON三方合并：把旧版本base到新版本remote的变化应用到本地修改过的local上
+ *	@description
+ *	- 只有一方修改的位置取修改的一方，双方修改相同时取该值
+ *	- 双方都是对象时逐键合并，保持local的键顺序，新增的键追加在后面
+ *	- 双方做了不同修改的位置记为冲突，保留本地的值
+ *	@returns {interface{}} 合并的结果；{[]JSONConflict} 冲突
+ */
+func MergeJSON3(base, local, remote interface{}) (interface{}, []JSONConflict) {
+	var conflicts []JSONConflict
+	merged, _ := merge3(base, local, remote, true, true, true, "$", &conflicts)
+	return merged, conflicts
+}
+
+/**
+ *	合并一个位置的值，hasXxx表示该位置在对应版本中是否存在
+ *	@returns {interface{}, bool} 合并后的值及是否保留该位置
+ */
+func merge3(base, local, remote interface{}, hasBase, hasLocal, hasRemote bool, path string, conflicts *[]JSONConflict) (interface{}, bool) {
+	same := func(a, b interface{}, hasA, hasB bool) bool {
+		return hasA == hasB && (!hasA || jsonEqual(a, b))
+	}
+	switch {
+	case same(local, remote, hasLocal, hasRemote):
+		return local, hasLocal
+	case same(base, local, hasBase, hasLocal):
+		return remote, hasRemote
+	case same(base, remote, hasBase, hasRemote):
+		return local, hasLocal
+	}
+	lm, lok := local.(*orderedmap.OrderedMap)
+	rm, rok := remote.(*orderedmap.OrderedMap)
+	if lok && rok {
+		bm, ok := base.(*orderedmap.OrderedMap)
+		if !ok {
+			bm = orderedmap.New()
+		}
+		out := orderedmap.New()
+		out.SetEscapeHTML(false)
+		keys := append([]string{}, lm.Keys()...)
+		for _, k := range rm.Keys() {
+			if _, exists := lm.Get(k); !exists {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			bv, hb := bm.Get(k)
+			lv, hl := lm.Get(k)
+			rv, hr := rm.Get(k)
+			if v, keep := merge3(bv, lv, rv, hb, hl, hr, path+"."+k, conflicts); keep {
+				out.Set(k, v)
+			}
+		}
+		return out, true
+	}
+	*conflicts = append(*conflicts, JSONConflict{Path: path, Base: base, Local: local, New: remote})
+	return local, hasLocal
+}
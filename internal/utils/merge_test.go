@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"testing"
+)
+
+// TestMergePatch checks the RFC 7386 examples, and that merged objects keep the key order of the base
+func TestMergePatch(t *testing.T) {
+	cases := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"z":1,"y":{"x":"<a>","w":2},"v":3}`, `{"y":{"w":5}}`, `{"z":1,"y":{"x":"<a>","w":5},"v":3}`},
+	}
+	for _, c := range cases {
+		target, err := ParseOrderedJSON([]byte(c.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch, _ := ParseOrderedJSON([]byte(c.patch))
+		if got := JSONText(MergePatch(target, patch)); got != c.want {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", c.target, c.patch, got, c.want)
+		}
+	}
+}
+
+// TestDiffJSON checks changed, added and removed values are reported by path
+func TestDiffJSON(t *testing.T) {
+	a, _ := ParseOrderedJSON([]byte(`{"listen":"localhost:6999","log":{"level":"debug","path":"console"},"args":["a","b"]}`))
+	b, _ := ParseOrderedJSON([]byte(`{"listen":"localhost:7999","log":{"level":"debug"},"args":["a","c"],"new":1}`))
+	changes := DiffJSON(a, b)
+	want := []string{
+		`$.listen "localhost:6999" "localhost:7999"`,
+		`$.log.path "console" -`,
+		`$.args[1] "b" "c"`,
+		`$.new - 1`,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for i, c := range changes {
+		if got := c.Path + " " + JSONText(c.Old) + " " + JSONText(c.New); got != want[i] {
+			t.Errorf("change %d = %s, want %s", i, got, want[i])
+		}
+	}
+	if changes := DiffJSON(a, a); len(changes) != 0 {
+		t.Errorf("changes of the same value = %+v", changes)
+	}
+}
+
+// TestMergeJSON3 checks changes on different keys are merged and changes on the same key conflict
+func TestMergeJSON3(t *testing.T) {
+	parse := func(s string) interface{} {
+		v, err := ParseOrderedJSON([]byte(s))
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return v
+	}
+	base := parse(`{"a":1,"b":{"x":1,"y":2},"c":3}`)
+	local := parse(`{"a":1,"b":{"x":1,"y":5},"c":3,"l":true}`)
+	merged, conflicts := MergeJSON3(base, local, parse(`{"a":2,"b":{"x":1,"y":2},"n":"new"}`))
+	if len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+	if got, want := JSONText(merged), `{"a":2,"b":{"x":1,"y":5},"l":true,"n":"new"}`; got != want {
+		t.Errorf("merged = %s, want %s", got, want)
+	}
+	_, conflicts = MergeJSON3(base, local, parse(`{"a":1,"b":{"x":1,"y":7},"c":3}`))
+	if len(conflicts) != 1 || conflicts[0].Path != "$.b.y" || JSONText(conflicts[0].Local) != "5" || JSONText(conflicts[0].New) != "7" {
+		t.Errorf("conflicts = %+v", conflicts)
+	}
+}
@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ *	指标的一个样本，如 http_requests_total{method="get"} 1027
+ */
+type MetricSample struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp,omitempty"` //毫秒，0表示没有时间戳
+}
+
+/**
+ *	JSON不支持NaN和±Inf，这些值按Prometheus文本格式编码为字符串"NaN"、"+Inf"、"-Inf"
+ */
+func (s MetricSample) MarshalJSON() ([]byte, error) {
+	type sample MetricSample
+	var value any = s.Value
+	switch {
+	case math.IsNaN(s.Value):
+		value = "NaN"
+	case math.IsInf(s.Value, 1):
+		value = "+Inf"
+	case math.IsInf(s.Value, -1):
+		value = "-Inf"
+	}
+	return json.Marshal(struct {
+		sample
+		Value any `json:"value"`
+	}{sample(s), value})
+}
+
+func (s *MetricSample) UnmarshalJSON(data []byte) error {
+	type sample MetricSample
+	v := struct {
+		*sample
+		Value json.RawMessage `json:"value"`
+	}{sample: (*sample)(s)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var text string
+	if err := json.Unmarshal(v.Value, &text); err != nil {
+		return json.Unmarshal(v.Value, &s.Value)
+	}
+	value, err := parseMetricValue(text)
+	if err != nil {
+		return err
+	}
+	s.Value = value
+	return nil
+}
+
+/**
+ *	指标族：同名指标(含histogram/summary的_bucket、_sum、_count)的所有样本
+ */
+type MetricFamily struct {
+	Name    string         `json:"name"`
+	Help    string         `json:"help,omitempty"`
+	Type    string         `json:"type"` //counter/gauge/histogram/summary/untyped
+	Samples []MetricSample `json:"samples"`
+}
+
+/**
+ *	样本标签的文本形式，按标签名排序，如 {code="200",method="get"}
+ */
+func (s *MetricSample) LabelString() string {
+	if len(s.Labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(k + "=" + strconv.Quote(s.Labels[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+/**
+ *	样本所属的指标族：histogram/summary的样本名带有_bucket、_sum、_count后缀
+ */
+func familyName(name string, types map[string]string) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		if t := types[base]; t == "histogram" || t == "summary" {
+			return base
+		}
+	}
+	return name
+}
+
+/**
+ *	解析标签部分 {a="x",b="y"}，返回标签及剩余的文本
+ */
+func parseLabels(text string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	i := 1 // 跳过'{'
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return nil, "", fmt.Errorf("unterminated labels")
+		}
+		if text[i] == '}' {
+			return labels, text[i+1:], nil
+		}
+		eq := strings.IndexByte(text[i:], '=')
+		if eq < 0 {
+			return nil, "", fmt.Errorf("label without value")
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return nil, "", fmt.Errorf("value of label '%s' isn't quoted", name)
+		}
+		i++
+		var sb strings.Builder
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				default:
+					sb.WriteByte(text[i])
+				}
+				continue
+			}
+			sb.WriteByte(text[i])
+		}
+		if i >= len(text) {
+			return nil, "", fmt.Errorf("unterminated value of label '%s'", name)
+		}
+		i++
+		labels[name] = sb.String()
+	}
+}
+
+func parseMetricValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+/**
+ *	解析一行样本: name[{labels}] value [timestamp]
+ */
+func parseSample(line string) (MetricSample, error) {
+	var sample MetricSample
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return sample, fmt.Errorf("sample without value")
+	}
+	sample.Name = line[:end]
+	rest := line[end:]
+	if rest[0] == '{' {
+		labels, remain, err := parseLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		if len(labels) > 0 {
+			sample.Labels = labels
+		}
+		rest = remain
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid value '%s'", strings.TrimSpace(rest))
+	}
+	v, err := parseMetricValue(fields[0])
+	if err != nil {
+		return sample, err
+	}
+	sample.Value = v
+	if len(fields) == 2 {
+		if sample.Timestamp, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return sample, err
+		}
+	}
+	return sample, nil
+}
+
+/**
+ *	解析Prometheus文本格式(text/plain; version=0.0.4)的指标
+ *	@returns {[]MetricFamily} 按出现顺序排列的指标族
+ */
+func ParseMetrics(r io.Reader) ([]MetricFamily, error) {
+	var families []*MetricFamily
+	index := make(map[string]*MetricFamily)
+	types := make(map[string]string)
+	family := func(name string) *MetricFamily {
+		if f, ok := index[name]; ok {
+			return f
+		}
+		f := &MetricFamily{Name: name, Type: "untyped"}
+		index[name] = f
+		families = append(families, f)
+		return f
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[0] {
+			case "HELP":
+				family(fields[1]).Help = fields[2]
+			case "TYPE":
+				types[fields[1]] = fields[2]
+				family(fields[1]).Type = fields[2]
+			}
+			continue
+		}
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		f := family(familyName(sample.Name, types))
+		f.Samples = append(f.Samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]MetricFamily, 0, len(families))
+	for _, f := range families {
+		result = append(result, *f)
+	}
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestParseMetrics checks HELP/TYPE comments, labels with escapes, special values and histogram samples grouped into families
+func TestParseMetrics(t *testing.T) {
+	text := `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# A comment
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 5
+request_duration_seconds_bucket{le="+Inf"} 7
+request_duration_seconds_sum 1.5
+request_duration_seconds_count 7
+up +Inf
+`
+	families, err := ParseMetrics(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 4 {
+		t.Fatalf("families = %+v", families)
+	}
+	req := families[0]
+	if req.Type != "counter" || req.Help != "The total number of HTTP requests." || len(req.Samples) != 2 ||
+		req.Samples[1].Value != 3 || req.Samples[0].Timestamp != 1395066363000 {
+		t.Errorf("http_requests_total = %+v", req)
+	}
+	if got := req.Samples[0].LabelString(); got != `{code="200",method="post"}` {
+		t.Errorf("labels = %s", got)
+	}
+	if got := families[1].Samples[0].Labels; got["path"] != `C:\DIR\FILE.TXT` || got["error"] != "Cannot find file:\n\"FILE.TXT\"" {
+		t.Errorf("escaped labels = %q", got)
+	}
+	if h := families[2]; h.Name != "request_duration_seconds" || h.Type != "histogram" || len(h.Samples) != 4 {
+		t.Errorf("histogram = %+v", h)
+	}
+	if up := families[3]; up.Type != "untyped" || !math.IsInf(up.Samples[0].Value, 1) {
+		t.Errorf("up = %+v", up)
+	}
+	if _, err := ParseMetrics(strings.NewReader(`bad{label="x} 1`)); err == nil {
+		t.Error("unterminated label is accepted")
+	}
+}
+
+// TestMetricSampleJSON checks NaN and ±Inf are encoded as strings and decoded back
+func TestMetricSampleJSON(t *testing.T) {
+	samples := []MetricSample{{Name: "a", Value: 1.5}, {Name: "b", Value: math.NaN()},
+		{Name: "c", Value: math.Inf(1)}, {Name: "d", Value: math.Inf(-1), Labels: map[string]string{"le": "+Inf"}}}
+	data, err := json.Marshal(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"a","value":1.5},{"name":"b","value":"NaN"},{"name":"c","value":"+Inf"},{"name":"d","labels":{"le":"+Inf"},"value":"-Inf"}]`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+	var got []MetricSample
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0].Value != 1.5 || !math.IsNaN(got[1].Value) || !math.IsInf(got[2].Value, 1) ||
+		!math.IsInf(got[3].Value, -1) || got[3].Labels["le"] != "+Inf" {
+		t.Errorf("decoded = %+v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zgsm-ai/smc/internal/env"
+)
+
+/**
+ *	包仓库的镜像服务器
+ *	@description
+ *	- 把目录Dir(结构与云端仓库相同)以HTTP方式提供给客户端，客户端把SMC_BASE_URL指向本服务即可
+ *	- 设置了Upstream时为透传模式：本地没有的文件从上游获取并缓存
+ *	- 版本目录下的文件不会变化，缓存后一直使用；索引文件会变化，缓存超过IndexTTL后重新获取，
+ *	  上游不可用时继续使用旧的索引。镜像不校验签名，由客户端像访问云端一样校验
+ */
+type Mirror struct {
+	Dir      string        //仓库目录
+	Prefix   string        //URL前缀，如/costrict，客户端访问{SMC_BASE_URL}/costrict/...
+	Upstream string        //上游仓库地址，如https://zgsm.sangfor.com/costrict，为空则只提供本地文件
+	IndexTTL time.Duration //索引文件的缓存时间
+
+	client *http.Client
+	locks  sync.Map //每个文件一把锁，避免并发请求重复从上游获取
+}
+
+/**
+ *	创建镜像服务器
+ */
+func NewMirror(dir, prefix, upstream string, indexTTL time.Duration) *Mirror {
+	return &Mirror{
+		Dir:      dir,
+		Prefix:   "/" + strings.Trim(prefix, "/"),
+		Upstream: strings.TrimSuffix(upstream, "/"),
+		IndexTTL: indexTTL,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: env.SkipSSL}},
+			Timeout:   30 * time.Minute,
+		},
+	}
+}
+
+/**
+ *	判断是否是会变化的索引文件
+ */
+func isIndexFile(name string) bool {
+	switch path.Base(name) {
+	case "packages.json", "platforms.json", "platform.json":
+		return true
+	}
+	return false
+}
+
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rel := r.URL.Path
+	if m.Prefix != "/" {
+		if !strings.HasPrefix(rel, m.Prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		rel = strings.TrimPrefix(rel, m.Prefix)
+	}
+	rel = strings.TrimPrefix(rel, "/")
+	fpath, err := safeJoin(m.Dir, rel)
+	if err != nil || rel == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if m.Upstream != "" {
+		if err := m.pull(rel, fpath); err != nil {
+			log.Printf("Mirror: pull '%s' failed: %v\n", rel, err)
+		}
+	}
+	info, err := os.Stat(fpath)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if isIndexFile(rel) {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeFile(w, r, fpath)
+}
+
+/**
+ *	本地没有文件rel，或者索引文件已过期时，从上游获取并缓存到fpath
+ */
+func (m *Mirror) pull(rel, fpath string) error {
+	lock, _ := m.locks.LoadOrStore(rel, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if info, err := os.Stat(fpath); err == nil {
+		if !isIndexFile(rel) || time.Since(info.ModTime()) < m.IndexTTL {
+			return nil
+		}
+	}
+	rsp, err := m.client.Get(m.Upstream + "/" + rel)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream returns %d", rsp.StatusCode)
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+		return err
+	}
+	//	完整获取后才替换缓存文件，避免把不完整的文件提供给客户端
+	err = writeAtomic(fpath, 0644, func(w io.Writer) error {
+		n, err := io.Copy(w, rsp.Body)
+		if err == nil && rsp.ContentLength >= 0 && n != rsp.ContentLength {
+			err = fmt.Errorf("size mismatch: %d/%d", n, rsp.ContentLength)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Mirror: cached '%s' from upstream\n", rel)
+	return nil
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMirror upgrades through a pull-through mirror of a repository directory
+func TestMirror(t *testing.T) {
+	pubKey, priKey, _ := GenKeys(KeyTypeEd25519)
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), PublicKey: string(pubKey), NoSetPath: true})
+
+	// Repository directory laid out as build-packages.sh does
+	repo := t.TempDir()
+	verDir := filepath.Join(repo, "app", u.Os, u.Arch, "1.0.0")
+	os.MkdirAll(verDir, 0775)
+	appFile := filepath.Join(verDir, "app")
+	os.WriteFile(appFile, testContent(1000), 0644)
+	size, sum, _ := CalcFileChecksum(appFile, ChecksumSha256)
+	sig, _ := Sign(priKey, []byte(sum))
+	pkg := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app", Probe: "none",
+		Os: u.Os, Arch: u.Arch, Size: size, Checksum: sum, ChecksumAlgo: ChecksumSha256,
+		Sign: hex.EncodeToString(sig), VersionId: VersionNumber{Major: 1}}
+	pkg.Save(filepath.Join(verDir, "package.json"))
+	prefix := "/app/" + u.Os + "/" + u.Arch
+	addr := VersionAddr{VersionId: pkg.VersionId, AppUrl: prefix + "/1.0.0/app", InfoUrl: prefix + "/1.0.0/package.json"}
+	data, _ := json.Marshal(PlatformInfo{PackageName: "app", Os: u.Os, Arch: u.Arch, Newest: addr, Versions: []VersionAddr{addr}})
+	data, _ = SignIndex(priKey, data, 1, time.Now().Add(time.Hour))
+	os.WriteFile(filepath.Join(repo, "app", u.Os, u.Arch, "platform.json"), data, 0644)
+
+	upstream := httptest.NewServer(NewMirror(repo, "/costrict", "", 0))
+	cache := t.TempDir()
+	mirror := httptest.NewServer(NewMirror(cache, "/costrict", upstream.URL+"/costrict", time.Hour))
+	defer mirror.Close()
+
+	u.BaseUrl = mirror.URL + "/costrict"
+	if _, upgraded, err := u.UpgradePackage(nil); err != nil || !upgraded {
+		t.Fatalf("UpgradePackage through mirror: %v, %v", upgraded, err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "app", u.Os, u.Arch, "1.0.0", "app")); err != nil {
+		t.Errorf("package isn't cached: %v", err)
+	}
+	for _, bad := range []string{"/costrict/../secret", "/other/app", "/costrict/app/missing.json"} {
+		rsp, err := http.Get(mirror.URL + bad)
+		if err == nil {
+			rsp.Body.Close()
+			if rsp.StatusCode != http.StatusNotFound {
+				t.Errorf("GET %s = %d", bad, rsp.StatusCode)
+			}
+		}
+	}
+
+	// Cached files are still served after the upstream is gone
+	upstream.Close()
+	if _, err := GetBytes(u.BaseUrl+prefix+"/platform.json", nil); err != nil {
+		t.Errorf("cached index isn't served: %v", err)
+	}
+}
@@ -7,7 +7,7 @@ import (
 
 type VersionOverview struct {
 	VersionId   VersionNumber `json:"versionId"`   //版本号，采用SemVer标准
-	PackageType PackageType   `json:"packageType"` //包类型: exec/conf
+	PackageType PackageType   `json:"packageType"` //包类型: exec/conf/archive
 	FileName    string        `json:"fileName"`    //被打包的文件的名字
 	Size        uint64        `json:"size"`        //包文件大小
 	Build       string        `json:"build"`       //构建信息：Tag/Branch信息 CommitID BuildTime
@@ -33,6 +33,7 @@ type PlatformId struct {
  *	包目录（软件包的系统，平台，版本目录）
  */
 type PackageOverview struct {
+	IndexMeta
 	PackageName string                      `json:"packageName"` //包名称
 	Platforms   []PlatformId                `json:"platforms"`   //包支持的平台列表
 	Overviews   map[string]PlatformOverview `json:"overviews"`   //包总览
@@ -42,6 +43,7 @@ type PackageOverview struct {
  *	云端可供下载的包列表
  */
 type PackageList struct {
+	IndexMeta
 	Packages []string `json:"packages"`
 }
 
@@ -57,6 +59,9 @@ func (u *Upgrader) GetRemotePlatforms() (PackageOverview, error) {
 	if err = json.Unmarshal(bytes, plats); err != nil {
 		return *plats, fmt.Errorf("GetRemotePlatforms('%s') unmarshal error: %v", urlStr, err)
 	}
+	if err = u.verifyIndex(fmt.Sprintf("%s/platforms.json", u.packageName), bytes); err != nil {
+		return PackageOverview{}, fmt.Errorf("GetRemotePlatforms('%s') verify error: %v", urlStr, err)
+	}
 	return *plats, nil
 }
 
@@ -72,5 +77,8 @@ func (u *Upgrader) GetRemotePackages() (PackageList, error) {
 	if err = json.Unmarshal(bytes, pkgs); err != nil {
 		return *pkgs, fmt.Errorf("GetRemotePackages('%s') unmarshal error: %v", urlStr, err)
 	}
+	if err = u.verifyIndex("packages.json", bytes); err != nil {
+		return PackageList{}, fmt.Errorf("GetRemotePackages('%s') verify error: %v", urlStr, err)
+	}
 	return *pkgs, nil
 }
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ *	自动升级被固定的包：保持在固定的版本
+ *	如果云端有更新的版本，把它记录到待办(todos)，供'smc component pending'查看
+ */
+func (u *Upgrader) upgradePinned(pinned PackageVersion) (PackageVersion, bool, error) {
+	pkg, upgraded, err := u.applyPackage(&pinned.VersionId)
+	if err != nil {
+		return pkg, false, err
+	}
+	u.recordPending(pinned.VersionId)
+	return pkg, upgraded, nil
+}
+
+/**
+ *	把云端高于固定版本pinned的最新版本记录到待办，失败只记录日志
+ */
+func (u *Upgrader) recordPending(pinned VersionNumber) {
+	plat, err := u.GetRemoteVersions()
+	if err != nil {
+		return
+	}
+	addr := u.newestVersion(plat, &pinned)
+	if CompareVersion(addr.VersionId, pinned) <= 0 {
+		u.RemoveTodo()
+		return
+	}
+	if todo, err := u.GetTodo(); err == nil && CompareVersion(todo.VersionId, addr.VersionId) == 0 {
+		return
+	}
+	pkg, _, err := u.getPackageInfo(addr)
+	if err != nil {
+		return
+	}
+	if err := u.AddTodo(pkg); err != nil {
+		log.Printf("Record pending version %s of '%s' failed: %v\n", pkg.VersionId.String(), u.packageName, err)
+		return
+	}
+	log.Printf("Package '%s' is pinned to %s, version %s is pending\n", u.packageName,
+		pinned.String(), pkg.VersionId.String())
+}
+
+/**
+ *	把包固定在版本ver，必要时先升级/降级到该版本
+ */
+func (u *Upgrader) PinPackage(ver VersionNumber) (PackageVersion, error) {
+	pkg, _, err := u.UpgradePackage(&ver)
+	return pkg, err
+}
+
+/**
+ *	把包固定在当前激活的版本，暂停自动升级
+ */
+func (u *Upgrader) HoldPackage() (PackageVersion, error) {
+	pkg, err := u.GetLocalVersion(nil)
+	if err != nil {
+		return pkg, fmt.Errorf("package '%s' is not installed", u.packageName)
+	}
+	if err = u.AddPinned(pkg); err != nil {
+		return pkg, err
+	}
+	return pkg, nil
+}
+
+/**
+ *	获取所有的待办升级(package/todos目录下的包描述)
+ *	待办来自被固定的包的可用更新，或者中断的升级
+ */
+func GetPendingPackages(baseDir string) ([]PackageVersion, error) {
+	if baseDir == "" {
+		baseDir = getCostrictDir()
+	}
+	todosDir := filepath.Join(baseDir, "package", "todos")
+	entries, err := os.ReadDir(todosDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var pkgs []PackageVersion
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		var pkg PackageVersion
+		data, err := os.ReadFile(filepath.Join(todosDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &pkg); err != nil || pkg.PackageName == "" {
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPinnedUpgrade checks that automatic upgrades keep a held package and record the newer version as pending
+func TestPinnedUpgrade(t *testing.T) {
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir(), Policy: VerifyPolicyCompat, IndexPolicy: VerifyPolicyCompat})
+	if _, err := u.HoldPackage(); err == nil {
+		t.Error("holding a package which isn't installed should fail")
+	}
+	cur := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+		Os: u.Os, Arch: u.Arch, VersionId: VersionNumber{Major: 1}}
+	os.MkdirAll(filepath.Join(u.packageDir, "pins"), 0775)
+	cur.Save(filepath.Join(u.packageDir, "app-1.0.0.json"))
+	cur.Save(filepath.Join(u.packageDir, "app.json"))
+	// Pins written automatically by old clients on every activation don't hold the package
+	cur.Save(filepath.Join(u.packageDir, "pins", "app.json"))
+	if _, err := u.GetPinned(); err == nil {
+		t.Error("legacy automatic pin treated as pinned")
+	}
+	if _, err := u.HoldPackage(); err != nil {
+		t.Fatalf("HoldPackage: %v", err)
+	}
+
+	newer := cur
+	newer.VersionId = VersionNumber{Major: 1, Micro: 1}
+	newer.Checksum = "00"
+	newer.ChecksumAlgo = ChecksumMd5
+	prefix := "/app/" + u.Os + "/" + u.Arch
+	addr := VersionAddr{VersionId: newer.VersionId, AppUrl: prefix + "/1.0.1/app", InfoUrl: prefix + "/1.0.1/package.json"}
+	plat := PlatformInfo{PackageName: "app", Os: u.Os, Arch: u.Arch, Newest: addr, Versions: []VersionAddr{addr}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/platform.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(plat)
+	})
+	mux.HandleFunc(addr.InfoUrl, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(newer)
+	})
+	mux.HandleFunc(addr.AppUrl, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("package of a pinned version downloaded")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u.BaseUrl = srv.URL
+
+	pkg, upgraded, err := u.UpgradePackage(nil)
+	if err != nil || upgraded || pkg.VersionId.String() != "1.0.0" {
+		t.Fatalf("UpgradePackage on a held package = %s, %v, %v", pkg.VersionId.String(), upgraded, err)
+	}
+	pending, err := GetPendingPackages(u.BaseDir)
+	if err != nil || len(pending) != 1 || pending[0].VersionId.String() != "1.0.1" {
+		t.Fatalf("GetPendingPackages = %+v, %v", pending, err)
+	}
+	if _, err := u.GetPinned(); err != nil {
+		t.Error("pin lost after automatic upgrade")
+	}
+}
+
+// TestExplicitUpgradePins checks that upgrading to a specified version pins it, even when it is already active
+func TestExplicitUpgradePins(t *testing.T) {
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir()})
+	cur := PackageVersion{PackageName: "app", PackageType: PackageTypeExec, FileName: "app",
+		Os: u.Os, Arch: u.Arch, VersionId: VersionNumber{Major: 1}}
+	os.MkdirAll(u.packageDir, 0775)
+	cur.Save(filepath.Join(u.packageDir, "app.json"))
+
+	if _, _, err := u.ApplyPackage(cur.VersionId); err != nil {
+		t.Fatalf("ApplyPackage: %v", err)
+	}
+	if _, err := u.GetPinned(); err == nil {
+		t.Error("ApplyPackage pinned the version")
+	}
+	pkg, upgraded, err := u.UpgradePackage(&cur.VersionId)
+	if err != nil || upgraded {
+		t.Fatalf("UpgradePackage to the active version = %v, %v", upgraded, err)
+	}
+	pinned, err := u.GetPinned()
+	if err != nil || CompareVersion(pinned.VersionId, pkg.VersionId) != 0 {
+		t.Errorf("active version isn't pinned after an explicit upgrade: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+/**
+ *	分阶段发布规则，限定哪些机器可以自动升级到版本VersionId
+ *	满足以下任一条件的机器可以升级:
+ *	- 机器ID在Machines列表中
+ *	- 已安装的版本不低于MinVersion(没有设置MinVersion则不限)，且机器落在Percentage比例内
+ *	机器是否落在比例内由 hash(机器ID/包名/版本) % 100 决定，结果是确定的，
+ *	提高比例时，已经升级的机器仍然在范围内
+ *	不在范围内的机器使用Fallback(发布前的newest)，没有Fallback时保持已安装的版本
+ */
+type RolloutRule struct {
+	VersionId  VersionNumber  `json:"versionId"`            //规则针对的版本
+	Percentage int            `json:"percentage"`           //允许升级的机器比例(0-100)
+	Machines   []string       `json:"machines,omitempty"`   //总是允许升级的机器ID列表
+	MinVersion *VersionNumber `json:"minVersion,omitempty"` //只有已安装版本不低于此版本的机器才参与比例发布
+	Fallback   *VersionNumber `json:"fallback,omitempty"`   //不在范围内的机器使用的版本，为空则保持已安装的版本
+}
+
+/**
+ *	检查发布规则
+ */
+func (r *RolloutRule) Check() error {
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("invalid rollout percentage %d, it should be 0-100", r.Percentage)
+	}
+	return nil
+}
+
+/**
+ *	计算机器在版本发布中的桶号(0-99)
+ */
+func RolloutBucket(machineId, pkgName string, ver VersionNumber) int {
+	h := fnv.New32a()
+	h.Write([]byte(machineId + "/" + pkgName + "/" + ver.String()))
+	return int(h.Sum32() % 100)
+}
+
+/**
+ *	判断机器machineId(已安装版本cur，未安装为nil)是否允许升级到规则指定的版本
+ */
+func (r *RolloutRule) Allow(machineId, pkgName string, cur *VersionNumber) bool {
+	for _, m := range r.Machines {
+		if m == machineId && m != "" {
+			return true
+		}
+	}
+	if r.Percentage >= 100 {
+		return true
+	}
+	if machineId == "" || r.Percentage <= 0 {
+		return false
+	}
+	if r.MinVersion != nil && (cur == nil || CompareVersion(*cur, *r.MinVersion) < 0) {
+		return false
+	}
+	return RolloutBucket(machineId, pkgName, r.VersionId) < r.Percentage
+}
+
+/**
+ *	获取版本ver的发布规则，没有规则返回nil(全量发布)
+ */
+func (p *PlatformInfo) GetRollout(ver VersionNumber) *RolloutRule {
+	for i := range p.Rollouts {
+		if CompareVersion(p.Rollouts[i].VersionId, ver) == 0 {
+			return &p.Rollouts[i]
+		}
+	}
+	return nil
+}
+
+/**
+ *	设置版本的发布规则，比例为100且没有其它限制的规则等同于全量发布，会被删除
+ */
+func (p *PlatformInfo) SetRollout(rule RolloutRule) error {
+	if err := rule.Check(); err != nil {
+		return err
+	}
+	found := false
+	for _, v := range p.Versions {
+		if CompareVersion(v.VersionId, rule.VersionId) == 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("version '%s' not exist", rule.VersionId.String())
+	}
+	if rule.Fallback != nil {
+		if CompareVersion(*rule.Fallback, rule.VersionId) >= 0 {
+			return fmt.Errorf("fallback %s isn't lower than %s", rule.Fallback.String(), rule.VersionId.String())
+		}
+		if _, ok := p.findVersion(*rule.Fallback); !ok {
+			return fmt.Errorf("fallback version '%s' not exist", rule.Fallback.String())
+		}
+	}
+	var rules []RolloutRule
+	for _, r := range p.Rollouts {
+		if CompareVersion(r.VersionId, rule.VersionId) != 0 {
+			rules = append(rules, r)
+		}
+	}
+	if rule.Percentage < 100 {
+		rules = append(rules, rule)
+	}
+	p.Rollouts = rules
+	return nil
+}
+
+/**
+ *	判断本机是否允许自动升级到版本ver
+ */
+func (u *Upgrader) rolloutAllowed(plat *PlatformInfo, ver VersionNumber, cur *VersionNumber) bool {
+	rule := plat.GetRollout(ver)
+	if rule == nil {
+		return true
+	}
+	return rule.Allow(u.MachineId, u.packageName, cur)
+}
+
+func (p *PlatformInfo) findVersion(ver VersionNumber) (VersionAddr, bool) {
+	for _, v := range p.Versions {
+		if CompareVersion(v.VersionId, ver) == 0 {
+			return v, true
+		}
+	}
+	return VersionAddr{}, false
+}
+
+/**
+ *	不在版本ver的发布范围内的机器使用的版本：规则记录的Fallback
+ *	没有规则、没有记录Fallback或该版本已被删除时返回false
+ *	客户端选择版本和服务端清理版本(smc package prune)都以此为准
+ */
+func (p *PlatformInfo) RolloutFallback(ver VersionNumber) (VersionAddr, bool) {
+	rule := p.GetRollout(ver)
+	if rule == nil || rule.Fallback == nil || CompareVersion(*rule.Fallback, ver) >= 0 {
+		return VersionAddr{}, false
+	}
+	return p.findVersion(*rule.Fallback)
+}
+
+/**
+ *	本机不在版本ver的发布范围内时，退回到规则记录的Fallback
+ *	没有Fallback时保持已安装的版本cur，未安装(cur为nil)时返回空的地址，表示没有可安装的版本
+ *	不会退回到未发布过的中间版本
+ */
+func (u *Upgrader) rolloutFallback(plat *PlatformInfo, ver VersionAddr, cur *VersionNumber) VersionAddr {
+	for !u.rolloutAllowed(plat, ver.VersionId, cur) {
+		prev, ok := plat.RolloutFallback(ver.VersionId)
+		if !ok {
+			if cur != nil {
+				return VersionAddr{VersionId: *cur}
+			}
+			return VersionAddr{}
+		}
+		ver = prev
+	}
+	return ver
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRollout checks that rollout rules gate automatic upgrades deterministically per machine
+func TestRollout(t *testing.T) {
+	addr := func(s string) VersionAddr {
+		var v VersionNumber
+		v.Parse(s)
+		return VersionAddr{VersionId: v, InfoUrl: "/app/" + s + "/package.json"}
+	}
+	// 1.2.0 was built but never released, machines out of the rollout must not get it
+	plat := PlatformInfo{Newest: addr("1.3.0"),
+		Versions: []VersionAddr{addr("1.0.0"), addr("1.1.0"), addr("1.2.0"), addr("1.3.0")}}
+	target := VersionNumber{Major: 1, Minor: 3}
+	fallback := VersionNumber{Major: 1, Minor: 1}
+	if err := plat.SetRollout(RolloutRule{VersionId: target, Percentage: 101}); err == nil {
+		t.Error("percentage 101 should be rejected")
+	}
+	if err := plat.SetRollout(RolloutRule{VersionId: target, Percentage: 10, Fallback: &target}); err == nil {
+		t.Error("fallback not below the rollout version should be rejected")
+	}
+	if err := plat.SetRollout(RolloutRule{VersionId: target, Percentage: 10, Machines: []string{"canary"}, Fallback: &fallback}); err != nil {
+		t.Fatalf("SetRollout: %v", err)
+	}
+
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir()})
+	cur := &VersionNumber{Major: 1}
+	got := 0
+	for i := 0; i < 1000; i++ {
+		u.MachineId = fmt.Sprintf("machine-%d", i)
+		ver := u.newestVersion(plat, cur).VersionId
+		switch ver.String() {
+		case "1.3.0":
+			got++
+		case "1.1.0":
+		default:
+			t.Fatalf("%s: unexpected version %s", u.MachineId, ver.String())
+		}
+		if again := u.newestVersion(plat, cur).VersionId; CompareVersion(again, ver) != 0 {
+			t.Fatalf("%s: rollout isn't deterministic", u.MachineId)
+		}
+	}
+	if got < 50 || got > 150 {
+		t.Errorf("%d of 1000 machines upgraded with a 10%% rollout", got)
+	}
+	u.MachineId = "canary"
+	if ver := u.newestVersion(plat, cur).VersionId; ver.String() != "1.3.0" {
+		t.Errorf("allow-listed machine got %s", ver.String())
+	}
+
+	// Machines below the minimum version never take part in the percentage
+	min := VersionNumber{Major: 1, Minor: 2}
+	plat.SetRollout(RolloutRule{VersionId: target, Percentage: 99, MinVersion: &min, Fallback: &fallback})
+	u.MachineId = "machine-1"
+	if ver := u.newestVersion(plat, cur).VersionId; ver.String() != "1.1.0" {
+		t.Errorf("machine on 1.0.0 got %s despite min version 1.2.0", ver.String())
+	}
+
+	// Without a fallback, machines out of the rollout keep their versions, and new installs get nothing
+	plat.SetRollout(RolloutRule{VersionId: target, Percentage: 0})
+	if ver := u.newestVersion(plat, cur).VersionId; ver.String() != "1.0.0" {
+		t.Errorf("machine on 1.0.0 out of the rollout got %s", ver.String())
+	}
+	if addr := u.newestVersion(plat, nil); addr.InfoUrl != "" {
+		t.Errorf("new install out of the rollout got %s", addr.InfoUrl)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/"+u.Os+"/"+u.Arch+"/platform.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(plat)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u.BaseUrl = srv.URL
+	u.IndexPolicy = VerifyPolicyCompat
+	if _, _, err := u.GetPackage(nil); err == nil {
+		t.Error("new install with no released version should fail")
+	}
+
+	// Percentage 100 removes the rule
+	plat.SetRollout(RolloutRule{VersionId: target, Percentage: 100})
+	if ver := u.newestVersion(plat, cur).VersionId; len(plat.Rollouts) != 0 || ver.String() != "1.3.0" {
+		t.Errorf("rollout not completed: %+v", plat.Rollouts)
+	}
+}
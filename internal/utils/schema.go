@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed schemas/*.schema.json
+var schemaFS embed.FS
+
+/**
+ *	JSON Schema(draft-07)的子集，支持配置文件用到的关键字
+ *	format扩展: semver(版本号)、semver-range(版本范围)、template(Go模板)
+ */
+type jsonSchema struct {
+	Title                string                 `json:"title"`
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MinItems             *int                   `json:"minItems"`
+	Pattern              string                 `json:"pattern"`
+	Format               string                 `json:"format"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+}
+
+/**
+ *	配置文件不符合模式的一处错误
+ */
+type SchemaError struct {
+	Path    string `json:"path"` //出错的位置，如 $.services[0].port
+	Message string `json:"message"`
+}
+
+type schemaValidator struct {
+	root   *jsonSchema
+	errors []SchemaError
+}
+
+/**
+ *	内置模式的名字，与配置文件名(去掉.json)相同，如system-spec
+ */
+func SchemaNames() []string {
+	entries, _ := schemaFS.ReadDir("schemas")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".schema.json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+ *	根据配置文件名找到对应的内置模式，如 share/system-spec.json -> system-spec
+ */
+func SchemaFor(fname string) (string, bool) {
+	name := strings.TrimSuffix(filepath.Base(fname), ".json")
+	for _, n := range SchemaNames() {
+		if n == name {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+func loadSchema(name string) (*jsonSchema, error) {
+	data, err := schemaFS.ReadFile("schemas/" + name + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema '%s'", name)
+	}
+	s := &jsonSchema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("schema '%s' is invalid: %v", name, err)
+	}
+	return s, nil
+}
+
+/**
+ *	用内置模式schemaName校验配置文件内容
+ *	@returns {[]SchemaError} 不符合模式之处，data不是合法的JSON时返回error
+ */
+func ValidateConfig(schemaName string, data []byte) ([]SchemaError, error) {
+	s, err := loadSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid JSON: extra data after the document")
+	}
+	v := &schemaValidator{root: s}
+	v.validate(s, doc, "$")
+	return v.errors, nil
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) resolve(s *jsonSchema) *jsonSchema {
+	if s.Ref == "" {
+		return s
+	}
+	name, ok := strings.CutPrefix(s.Ref, "#/definitions/")
+	if def := v.root.Definitions[name]; ok && def != nil {
+		return def
+	}
+	return &jsonSchema{}
+}
+
+func jsonTypeOf(val interface{}) string {
+	switch x := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func (v *schemaValidator) validate(s *jsonSchema, val interface{}, path string) {
+	s = v.resolve(s)
+	actual := jsonTypeOf(val)
+	if s.Type != "" && s.Type != actual && !(s.Type == "number" && actual == "integer") {
+		v.fail(path, "should be %s, not %s", s.Type, actual)
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			data, _ := json.Marshal(s.Enum)
+			v.fail(path, "should be one of %s", data)
+		}
+	}
+	switch x := val.(type) {
+	case float64:
+		if s.Minimum != nil && x < *s.Minimum {
+			v.fail(path, "should be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && x > *s.Maximum {
+			v.fail(path, "should be <= %v", *s.Maximum)
+		}
+	case string:
+		v.validateString(s, x, path)
+	case []interface{}:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			v.fail(path, "should have at least %d items", *s.MinItems)
+		}
+		if s.Items != nil {
+			for i, item := range x {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]interface{}:
+		v.validateObject(s, x, path)
+	}
+}
+
+func (v *schemaValidator) validateString(s *jsonSchema, x string, path string) {
+	if s.MinLength != nil && len(x) < *s.MinLength {
+		v.fail(path, "should have at least %d characters", *s.MinLength)
+	}
+	if s.Pattern != "" {
+		if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(x) {
+			v.fail(path, "'%s' doesn't match '%s'", x, s.Pattern)
+		}
+	}
+	switch s.Format {
+	case "semver":
+		var ver VersionNumber
+		if err := ver.Parse(x); err != nil {
+			v.fail(path, "'%s' isn't a version: %v", x, err)
+		}
+	case "semver-range":
+		if _, err := ParseVersionRange(x); err != nil {
+			v.fail(path, "%v", err)
+		}
+	case "template":
+		if _, err := template.New(path).Parse(x); err != nil {
+			v.fail(path, "invalid template: %v", err)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(s *jsonSchema, x map[string]interface{}, path string) {
+	for _, name := range s.Required {
+		if _, ok := x[name]; !ok {
+			v.fail(path, "'%s' is required", name)
+		}
+	}
+	var additional *jsonSchema
+	allowAdditional := true
+	if len(s.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(s.AdditionalProperties, &allowAdditional); err != nil {
+			additional = &jsonSchema{}
+			json.Unmarshal(s.AdditionalProperties, additional)
+			allowAdditional = true
+		}
+	}
+	keys := make([]string, 0, len(x))
+	for k := range x {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub := path + "." + k
+		if prop, ok := s.Properties[k]; ok {
+			v.validate(prop, x[k], sub)
+		} else if additional != nil {
+			v.validate(additional, x[k], sub)
+		} else if !allowAdditional {
+			v.fail(sub, "unknown property '%s'", k)
+		}
+	}
+}
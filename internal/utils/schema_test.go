@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestValidateConfig checks the shipped configuration files pass their schemas, and typos are reported with their paths
+func TestValidateConfig(t *testing.T) {
+	files, _ := filepath.Glob("../../build/configures/*/*.json")
+	more, _ := filepath.Glob("../../build/configures/*/*/*.json")
+	for _, fname := range append(files, more...) {
+		name, ok := SchemaFor(fname)
+		if !ok {
+			continue
+		}
+		data, _ := os.ReadFile(fname)
+		if errs, err := ValidateConfig(name, data); err != nil || len(errs) > 0 {
+			t.Errorf("%s: %v %+v", fname, err, errs)
+		}
+	}
+
+	doc := `{"configuration": "1.0", "manager": {"component": {"name": "costrict", "version": ">=abc"},
+		"service": {"name": "costrict", "startup": "always", "command": "{{.ProcessPath}}", "port": "8999", "acessible": "local"}}}`
+	errs, err := ValidateConfig("system-spec", []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"$.configuration":             true,
+		"$.manager.component.version": true,
+		"$.manager.service.port":      true,
+		"$.manager.service.acessible": true,
+	}
+	for _, e := range errs {
+		if !want[e.Path] {
+			t.Errorf("unexpected error %+v", e)
+		}
+		delete(want, e.Path)
+	}
+	if len(want) > 0 {
+		t.Errorf("errors not reported: %v, got %+v", want, errs)
+	}
+	if _, err := ValidateConfig("system-spec", []byte(`{"configuration": `)); err == nil {
+		t.Error("invalid JSON is accepted")
+	}
+}
@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ *	版本比较条件，如 >=1.2.0
+ */
+type versionComparator struct {
+	op  string //比较运算: = > >= < <=
+	ver VersionNumber
+}
+
+/**
+ *	版本范围，采用npm风格的写法:
+ *	- ^1.2.3: >=1.2.3 <2.0.0 (主版本为0时，^0.2.3: >=0.2.3 <0.3.0)
+ *	- ~1.2.3: >=1.2.3 <1.3.0; ~1: >=1.0.0 <2.0.0
+ *	- 1.2.x、1.2.*、1.2: >=1.2.0 <1.3.0; * 或空: 任意版本
+ *	- >=1.0.0 <1.5.0: 空格分隔的多个条件须同时满足
+ *	- ^1.0.0 || ^2.0.0: 满足任一组条件即可
+ *	预发布版本只与主次版本号相同、且自身带预发布标识的条件匹配，如 >=1.2.0-beta.1 匹配 1.2.0-rc.1，但不匹配 1.3.0-beta.1
+ */
+type VersionRange struct {
+	raw  string
+	sets [][]versionComparator
+}
+
+/**
+ *	解析版本范围字符串
+ */
+func ParseVersionRange(s string) (VersionRange, error) {
+	r := VersionRange{raw: strings.TrimSpace(s)}
+	for _, alt := range strings.Split(r.raw, "||") {
+		var set []versionComparator
+		for _, term := range strings.Fields(alt) {
+			cmps, err := parseComparator(term)
+			if err != nil {
+				return r, fmt.Errorf("invalid version range '%s': %v", s, err)
+			}
+			set = append(set, cmps...)
+		}
+		r.sets = append(r.sets, set)
+	}
+	return r, nil
+}
+
+func (r VersionRange) String() string {
+	if r.raw == "" {
+		return "*"
+	}
+	return r.raw
+}
+
+/**
+ *	判断版本ver是否在范围内
+ */
+func (r VersionRange) Match(ver VersionNumber) bool {
+	return r.match(ver, false)
+}
+
+/**
+ *	判断版本ver是否在范围内，includePre为true时，预发布版本按普通的优先级规则比较
+ */
+func (r VersionRange) match(ver VersionNumber, includePre bool) bool {
+	if len(r.sets) == 0 {
+		return includePre || !ver.IsPreRelease()
+	}
+	for _, set := range r.sets {
+		matched := true
+		allowed := includePre || !ver.IsPreRelease()
+		for _, c := range set {
+			if !c.match(ver) {
+				matched = false
+				break
+			}
+			if c.ver.IsPreRelease() && c.ver.Major == ver.Major && c.ver.Minor == ver.Minor && c.ver.Micro == ver.Micro {
+				allowed = true
+			}
+		}
+		if matched && allowed {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ *	从版本列表中选出范围内的最高版本，没有满足的版本返回false
+ *	includePre为true时，预发布版本也参与选择
+ */
+func (r VersionRange) MaxSatisfying(vers []VersionNumber, includePre bool) (VersionNumber, bool) {
+	var best VersionNumber
+	found := false
+	for _, v := range vers {
+		if r.match(v, includePre) && (!found || CompareVersion(v, best) > 0) {
+			best = v
+			found = true
+		}
+	}
+	return best, found
+}
+
+func (c versionComparator) match(ver VersionNumber) bool {
+	ret := CompareVersion(ver, c.ver)
+	switch c.op {
+	case ">":
+		return ret > 0
+	case ">=":
+		return ret >= 0
+	case "<":
+		return ret < 0
+	case "<=":
+		return ret <= 0
+	default:
+		return ret == 0
+	}
+}
+
+/**
+ *	解析部分版本号，如 1、1.2、1.2.x、1.2.0-beta.1，返回版本号和有效的段数
+ */
+func parsePartialVersion(s string) (VersionNumber, int, error) {
+	if strings.ContainsAny(s, "-+") { //带预发布标识或构建元数据的必须是完整版本号
+		var ver VersionNumber
+		if err := ver.Parse(s); err != nil {
+			return ver, 0, fmt.Errorf("invalid version '%s'", s)
+		}
+		ver.BuildMeta = ""
+		return ver, 3, nil
+	}
+	var nums [3]int
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return VersionNumber{}, 0, fmt.Errorf("invalid version '%s'", s)
+	}
+	n := 0
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return VersionNumber{}, 0, fmt.Errorf("invalid version '%s'", s)
+		}
+		nums[i] = v
+		n++
+	}
+	return VersionNumber{Major: nums[0], Minor: nums[1], Micro: nums[2]}, n, nil
+}
+
+/**
+ *	计算部分版本号ver(有效段数n)的上界，如 1.2 的上界为 1.3.0
+ */
+func upperBound(ver VersionNumber, n int) VersionNumber {
+	switch n {
+	case 1:
+		return VersionNumber{Major: ver.Major + 1}
+	case 2:
+		return VersionNumber{Major: ver.Major, Minor: ver.Minor + 1}
+	default:
+		return VersionNumber{Major: ver.Major, Minor: ver.Minor, Micro: ver.Micro + 1}
+	}
+}
+
+/**
+ *	把一个条件展开成基本的比较条件
+ */
+func parseComparator(term string) ([]versionComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			break
+		}
+	}
+	ver, n, err := parsePartialVersion(strings.TrimPrefix(strings.TrimPrefix(term, op), "v"))
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 { //*、x
+		if op != "" && op != "=" && op != ">=" && op != "<=" {
+			return nil, fmt.Errorf("invalid condition '%s'", term)
+		}
+		return nil, nil
+	}
+	switch op {
+	case "^":
+		//	锁定第一个非0的版本段
+		upper := upperBound(ver, 1)
+		if ver.Major == 0 && n >= 2 {
+			upper = upperBound(ver, 2)
+			if ver.Minor == 0 && n == 3 {
+				upper = upperBound(ver, 3)
+			}
+		}
+		return []versionComparator{{">=", ver}, {"<", upper}}, nil
+	case "~":
+		if n == 1 {
+			return []versionComparator{{">=", ver}, {"<", upperBound(ver, 1)}}, nil
+		}
+		return []versionComparator{{">=", ver}, {"<", upperBound(ver, 2)}}, nil
+	case "", "=":
+		if n == 3 {
+			return []versionComparator{{"=", ver}}, nil
+		}
+		return []versionComparator{{">=", ver}, {"<", upperBound(ver, n)}}, nil
+	case ">":
+		if n < 3 { //>1.2 等价于 >=1.3.0
+			return []versionComparator{{">=", upperBound(ver, n)}}, nil
+		}
+	case "<=":
+		if n < 3 { //<=1.2 等价于 <1.3.0
+			return []versionComparator{{"<", upperBound(ver, n)}}, nil
+		}
+	}
+	return []versionComparator{{op, ver}}, nil
+}
+
+/**
+ *	获取云端满足版本范围的最高版本，不在本机分阶段发布范围内的版本被排除
+ *	cur为已安装的版本，未安装为nil
+ */
+func (u *Upgrader) ResolveVersion(r VersionRange, cur *VersionNumber) (VersionNumber, error) {
+	plat, err := u.GetRemoteVersions()
+	if err != nil {
+		return VersionNumber{}, err
+	}
+	var vers []VersionNumber
+	for _, v := range plat.Versions {
+		if u.rolloutAllowed(&plat, v.VersionId, cur) {
+			vers = append(vers, v.VersionId)
+		}
+	}
+	ver, ok := r.MaxSatisfying(vers, u.AllowPreRelease)
+	if !ok {
+		return ver, fmt.Errorf("no version of '%s' satisfies '%s'", u.packageName, r.String())
+	}
+	return ver, nil
+}
+
+/**
+ *	检查预发布标识/构建元数据：以'.'分隔的非空标识，只含[0-9A-Za-z-]
+ *	预发布标识中的纯数字标识不能有前导0
+ */
+func validIdentifiers(s string, preRelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if preRelease && numeric && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ *	比较预发布标识
+ *	- 没有预发布标识的版本高于有预发布标识的版本
+ *	- 逐个比较'.'分隔的标识：纯数字按数值比较，且低于含字母的标识；含字母的按ASCII比较
+ *	- 前面的标识都相同时，标识多的版本更高
+ */
+func comparePreRelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.ParseUint(as[i], 10, 64)
+		bn, berr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if ret := strings.Compare(as[i], bs[i]); ret != 0 {
+				return ret
+			}
+		}
+	}
+	return len(as) - len(bs)
+}
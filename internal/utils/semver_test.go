@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestVersionRange checks npm style version range matching
+func TestVersionRange(t *testing.T) {
+	cases := []struct {
+		rng  string
+		ver  string
+		want bool
+	}{
+		{"^1.0.0", "1.9.3", true},
+		{"^1.0.0", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.0.0", "1.0.29", true},
+		{"~1.0.0", "1.1.0", false},
+		{"~1", "1.5.0", true},
+		{"1.2.x", "1.2.7", true},
+		{"1.2.*", "1.3.0", false},
+		{"1.2", "1.2.0", true},
+		{"*", "9.9.9", true},
+		{"", "0.0.1", true},
+		{"1.2.3", "1.2.3", true},
+		{"=1.2.3", "1.2.4", false},
+		{">=1.0.0 <1.5.0", "1.4.9", true},
+		{">=1.0.0 <1.5.0", "1.5.0", false},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.9", true},
+		{"^1.0.0 || ^3.0.0", "3.1.0", true},
+		{"^1.0.0 || ^3.0.0", "2.1.0", false},
+	}
+	for _, c := range cases {
+		r, err := ParseVersionRange(c.rng)
+		if err != nil {
+			t.Errorf("ParseVersionRange(%q) error: %v", c.rng, err)
+			continue
+		}
+		var ver VersionNumber
+		ver.Parse(c.ver)
+		if got := r.Match(ver); got != c.want {
+			t.Errorf("%q.Match(%s) = %v, want %v", c.rng, c.ver, got, c.want)
+		}
+	}
+	for _, bad := range []string{"^a.b", "1.2.3.4", ">x", "~>1.0"} {
+		if _, err := ParseVersionRange(bad); err == nil {
+			t.Errorf("ParseVersionRange(%q) should fail", bad)
+		}
+	}
+
+	r, _ := ParseVersionRange("~1.0.0")
+	vers := []VersionNumber{{Major: 1, Micro: 3}, {Major: 1, Minor: 1}, {Major: 1, Micro: 12}, {Minor: 9}}
+	if best, ok := r.MaxSatisfying(vers, false); !ok || best.String() != "1.0.12" {
+		t.Errorf("MaxSatisfying = %s, %v", best.String(), ok)
+	}
+
+	// Pre-releases match only comparators with a pre-release on the same version, unless included
+	r, _ = ParseVersionRange(">=1.2.0-beta.1")
+	for ver, want := range map[string]bool{"1.2.0-rc.1": true, "1.2.0-alpha": false, "1.3.0-beta.1": false, "1.3.0": true} {
+		var v VersionNumber
+		v.Parse(ver)
+		if got := r.Match(v); got != want {
+			t.Errorf("%q.Match(%s) = %v, want %v", ">=1.2.0-beta.1", ver, got, want)
+		}
+	}
+	r, _ = ParseVersionRange("^1.0.0")
+	pre := VersionNumber{Major: 1, Minor: 1, PreRelease: "rc.1"}
+	if r.Match(pre) || !r.match(pre, true) {
+		t.Error("pre-release matching with includePre is wrong")
+	}
+}
+
+// TestSemVer checks parsing, formatting and SemVer 2.0 precedence
+func TestSemVer(t *testing.T) {
+	var ver VersionNumber
+	if err := ver.Parse("1.2.0-rc.2+sha.abc"); err != nil || ver.PreRelease != "rc.2" || ver.BuildMeta != "sha.abc" {
+		t.Fatalf("Parse = %+v, %v", ver, err)
+	}
+	if ver.String() != "1.2.0-rc.2+sha.abc" {
+		t.Errorf("String() = %s", ver.String())
+	}
+	for _, bad := range []string{"1.2", "1.2.0-", "1.2.0-01", "1.2.0-a..b", "1.2.0+", "1.2.0-beta_1"} {
+		if err := ver.Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+	// Ordering from the SemVer 2.0 specification
+	order := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1-0", "1.0.1"}
+	for i := 1; i < len(order); i++ {
+		var a, b VersionNumber
+		a.Parse(order[i-1])
+		b.Parse(order[i])
+		if CompareVersion(a, b) >= 0 || CompareVersion(b, a) <= 0 {
+			t.Errorf("%s should be lower than %s", order[i-1], order[i])
+		}
+	}
+	var a, b VersionNumber
+	a.Parse("1.0.0+build.1")
+	b.Parse("1.0.0+build.2")
+	if CompareVersion(a, b) != 0 {
+		t.Error("build metadata must not affect precedence")
+	}
+
+	// Release versions keep the old JSON format
+	data, _ := json.Marshal(VersionNumber{Major: 1, Minor: 2, Micro: 3})
+	if string(data) != `{"major":1,"minor":2,"micro":3}` {
+		t.Errorf("json = %s", data)
+	}
+}
+
+// TestNewestVersion checks that automatic upgrades skip pre-releases unless allowed
+func TestNewestVersion(t *testing.T) {
+	addr := func(s string) VersionAddr {
+		var v VersionNumber
+		v.Parse(s)
+		return VersionAddr{VersionId: v}
+	}
+	plat := PlatformInfo{Newest: addr("1.3.0-beta.1"),
+		Versions: []VersionAddr{addr("1.2.0"), addr("1.2.1"), addr("1.3.0-beta.1"), addr("1.3.0-beta.2")}}
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: t.TempDir()})
+	u.AllowPreRelease = false
+	if v := u.newestVersion(plat, nil).VersionId; v.String() != "1.2.1" {
+		t.Errorf("newest release = %s", v.String())
+	}
+	u.AllowPreRelease = true
+	if v := u.newestVersion(plat, nil).VersionId; v.String() != "1.3.0-beta.2" {
+		t.Errorf("newest pre-release = %s", v.String())
+	}
+}
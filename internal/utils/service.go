@@ -0,0 +1,493 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+/**
+ *	服务的启动方式
+ */
+const (
+	StartupAlways = "always" //启动所有服务时启动，退出后总是重启
+)
+
+/**
+ *	服务状态
+ */
+const (
+	ServiceRunning = "running" //服务进程在运行
+	ServiceBackoff = "backoff" //服务进程退出，等待重启
+	ServiceExited  = "exited"  //服务进程退出且不再重启
+	ServiceStopped = "stopped" //服务被停止
+	ServiceDead    = "dead"    //监控进程已不存在，但状态文件未更新(如被强制杀死)
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+	stableRunTime     = time.Minute     //进程运行超过该时长后，重启间隔恢复到最小值
+	stopGracePeriod   = 5 * time.Second //停止时等待服务进程响应SIGTERM退出的时长，超时后强制结束
+)
+
+/**
+ *	服务命令模板的参数
+ */
+type ServiceArgs struct {
+	Name        string //服务名
+	ProcessPath string //服务程序的路径
+	LocalPort   int    //分配的本地端口
+	BaseDir     string //costrict数据所在的基路径
+}
+
+/**
+ *	服务的运行状态，保存在{BaseDir}/run/{name}.json
+ */
+type ServiceState struct {
+	Name            string    `json:"name"`
+	Status          string    `json:"status"`
+	SupervisorPid   int       `json:"supervisorPid"`             //监控进程(smc service run)的PID
+	SupervisorStart string    `json:"supervisorStart,omitempty"` //监控进程的启动时间，用于确认PID未被复用
+	Pid             int       `json:"pid"`                       //服务进程的PID
+	ProcessStart    string    `json:"processStart,omitempty"`    //服务进程的启动时间
+	Port            int       `json:"port"`                      //服务实际使用的端口
+	Command         string    `json:"command"`
+	Args            []string  `json:"args"`
+	StartTime       time.Time `json:"startTime"` //服务进程最近一次启动的时间
+	Restarts        int       `json:"restarts"`  //重启次数
+	LastExit        string    `json:"lastExit,omitempty"`
+	LogFile         string    `json:"logFile"`
+}
+
+/**
+ *	服务状态文件所在目录
+ */
+func ServiceRunDir(baseDir string) string {
+	if baseDir == "" {
+		baseDir = getCostrictDir()
+	}
+	return filepath.Join(baseDir, "run")
+}
+
+func serviceStateFile(baseDir, name string) string {
+	return filepath.Join(ServiceRunDir(baseDir), name+".json")
+}
+
+/**
+ *	服务输出的日志文件
+ */
+func ServiceLogFile(baseDir, name string) string {
+	return filepath.Join(ServiceRunDir(baseDir), name+".log")
+}
+
+func (s *ServiceState) Save(baseDir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ServiceRunDir(baseDir), 0775); err != nil {
+		return err
+	}
+	return writeFileAtomic(serviceStateFile(baseDir, s.Name), data, 0644)
+}
+
+/**
+ *	读取服务状态，监控进程已不存在时状态为dead
+ */
+func LoadServiceState(baseDir, name string) (ServiceState, error) {
+	var state ServiceState
+	data, err := os.ReadFile(serviceStateFile(baseDir, name))
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if state.Status != ServiceStopped && state.Status != ServiceExited && !sameProcess(state.SupervisorPid, state.SupervisorStart) {
+		state.Status = ServiceDead
+	}
+	return state, nil
+}
+
+/**
+ *	服务是否在运行(监控进程存在)
+ */
+func (s *ServiceState) Active() bool {
+	return s.Status == ServiceRunning || s.Status == ServiceBackoff
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" { //windows上FindProcess成功即表示进程存在
+		p.Release()
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+/**
+ *	获取进程的启动时间，作为进程的标识
+ *	linux读取/proc/{pid}/stat的starttime，windows通过powershell，其它系统通过ps
+ */
+func processStartTime(pid int) (string, error) {
+	var out []byte
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		out, err = os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return "", err
+		}
+		//	第2项(comm)可能包含空格和括号，从最后一个')'之后开始，依次为第3项(state)...第22项(starttime)
+		fields := strings.Fields(string(out[bytes.LastIndexByte(out, ')')+1:]))
+		if len(fields) < 20 {
+			return "", fmt.Errorf("invalid /proc/%d/stat", pid)
+		}
+		return fields[19], nil
+	case "windows":
+		out, err = exec.Command("powershell", "-NoProfile", "-Command",
+			fmt.Sprintf("(Get-Process -Id %d).StartTime.ToFileTimeUtc()", pid)).Output()
+	default:
+		out, err = exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	}
+	if err != nil {
+		return "", err
+	}
+	start := strings.TrimSpace(string(out))
+	if start == "" {
+		return "", fmt.Errorf("process %d doesn't exist", pid)
+	}
+	return start, nil
+}
+
+/**
+ *	进程pid是否存在且仍是启动时间为start的那个进程
+ *	重启或崩溃后PID可能被无关的进程复用，只凭PID判断会把信号发给无关的进程
+ *	无法确认时(如旧版本的状态文件没有记录启动时间)视为不是同一进程
+ */
+func sameProcess(pid int, start string) bool {
+	if start == "" || !processAlive(pid) {
+		return false
+	}
+	cur, err := processStartTime(pid)
+	return err == nil && cur == start
+}
+
+/**
+ *	结束服务进程：先发送SIGTERM，等待grace后仍未退出则强制结束
+ *	不支持信号的系统(windows)上直接结束
+ *	@param {<-chan error} exited - 进程退出时收到Wait的结果
+ */
+func terminateProcess(p *os.Process, exited <-chan error, grace time.Duration) {
+	if err := p.Signal(syscall.SIGTERM); err == nil {
+		select {
+		case <-exited:
+			return
+		case <-time.After(grace):
+			log.Printf("Process %d didn't exit in %v after SIGTERM, kill it\n", p.Pid, grace)
+		}
+	}
+	p.Kill()
+	<-exited
+}
+
+/**
+ *	分配端口：优先使用preferred，被占用(或为0)时由系统分配一个空闲端口
+ *	只允许本机访问的服务检查127.0.0.1，否则检查所有地址
+ *	监听端口的进程设置了SO_REUSEADDR时仍可以绑定该端口，所以先尝试连接
+ */
+func AllocatePort(preferred int, accessible string) (int, error) {
+	host := ""
+	if accessible != "remote" {
+		host = "127.0.0.1"
+	}
+	if preferred > 0 {
+		port := strconv.Itoa(preferred)
+		if conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), 200*time.Millisecond); err == nil {
+			conn.Close()
+		} else if l, err := net.Listen("tcp", net.JoinHostPort(host, port)); err == nil {
+			l.Close()
+			return preferred, nil
+		}
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+/**
+ *	渲染服务的命令和参数模板
+ */
+func (s *ServiceSpec) Render(args ServiceArgs) (string, []string, error) {
+	render := func(text string) (string, error) {
+		t, err := template.New(s.Name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, args); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	command, err := render(s.Command)
+	if err != nil {
+		return "", nil, fmt.Errorf("render command of service '%s' failed: %v", s.Name, err)
+	}
+	var argv []string
+	for _, a := range s.Args {
+		arg, err := render(a)
+		if err != nil {
+			return "", nil, fmt.Errorf("render args of service '%s' failed: %v", s.Name, err)
+		}
+		argv = append(argv, arg)
+	}
+	return command, argv, nil
+}
+
+/**
+ *	获取包安装的程序路径，作为服务命令的{{.ProcessPath}}
+ *	exec包为安装的文件，archive包为解压目录下与包同名的程序
+ */
+func (u *Upgrader) ProcessPath() (string, error) {
+	pkg, err := u.GetLocalVersion(nil)
+	if err != nil {
+		return "", fmt.Errorf("package '%s' is not installed", u.packageName)
+	}
+	switch pkg.PackageType {
+	case PackageTypeExec:
+		return u.installPath(pkg), nil
+	case PackageTypeArchive:
+		fname := u.packageName
+		if runtime.GOOS == "windows" {
+			fname += ".exe"
+		}
+		return filepath.Join(u.archiveDir(pkg), fname), nil
+	default:
+		return "", fmt.Errorf("package '%s' is not executable", u.packageName)
+	}
+}
+
+/**
+ *	重启间隔：从minBackoff开始每次翻倍，不超过maxBackoff
+ */
+func restartBackoff(failures int, minBackoff, maxBackoff time.Duration) time.Duration {
+	d := minBackoff
+	for i := 0; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+/**
+ *	服务监控：启动服务进程，退出后按退避间隔重启，并把状态保存到{BaseDir}/run
+ */
+type Supervisor struct {
+	Spec       ServiceSpec
+	BaseDir    string
+	MinBackoff time.Duration //最小重启间隔，为0则为1秒
+	MaxBackoff time.Duration //最大重启间隔，为0则为1分钟
+	state      ServiceState
+}
+
+func NewSupervisor(spec ServiceSpec, baseDir string) *Supervisor {
+	if baseDir == "" {
+		baseDir = getCostrictDir()
+	}
+	return &Supervisor{
+		Spec:       spec,
+		BaseDir:    baseDir,
+		MinBackoff: minRestartBackoff,
+		MaxBackoff: maxRestartBackoff,
+	}
+}
+
+/**
+ *	准备启动参数：渲染模板，分配端口(优先沿用上次的端口，保持客户端连接的地址不变)
+ */
+func (s *Supervisor) prepare() (*exec.Cmd, error) {
+	args := ServiceArgs{Name: s.Spec.Name, BaseDir: s.BaseDir}
+	procPath, err := NewUpgrader(s.Spec.Name, UpgradeConfig{BaseDir: s.BaseDir}).ProcessPath()
+	if err == nil {
+		args.ProcessPath = procPath
+	}
+	preferred := s.Spec.Port
+	if s.state.Port > 0 {
+		preferred = s.state.Port
+	}
+	if args.LocalPort, err = AllocatePort(preferred, s.Spec.Accessible); err != nil {
+		return nil, err
+	}
+	command, argv, err := s.Spec.Render(args)
+	if err != nil {
+		return nil, err
+	}
+	if command == "" {
+		return nil, fmt.Errorf("service '%s' has no command", s.Spec.Name)
+	}
+	if args.LocalPort != s.Spec.Port && s.Spec.Port > 0 {
+		log.Printf("Port %d of service '%s' is busy, use %d\n", s.Spec.Port, s.Spec.Name, args.LocalPort)
+	}
+	s.state.Port = args.LocalPort
+	s.state.Command = command
+	s.state.Args = argv
+	return exec.Command(command, argv...), nil
+}
+
+/**
+ *	运行服务直到stop被关闭：退出后按退避间隔重启
+ *	startup为always的服务总是重启，其它服务只在异常退出时重启
+ */
+func (s *Supervisor) Run(stop <-chan struct{}) error {
+	if s.MinBackoff <= 0 {
+		s.MinBackoff = minRestartBackoff
+	}
+	if s.MaxBackoff < s.MinBackoff {
+		s.MaxBackoff = s.MinBackoff
+	}
+	if old, err := LoadServiceState(s.BaseDir, s.Spec.Name); err == nil {
+		s.state.Port = old.Port
+	}
+	s.state.Name = s.Spec.Name
+	s.state.SupervisorPid = os.Getpid()
+	s.state.SupervisorStart, _ = processStartTime(s.state.SupervisorPid)
+	s.state.LogFile = ServiceLogFile(s.BaseDir, s.Spec.Name)
+	if err := os.MkdirAll(ServiceRunDir(s.BaseDir), 0775); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(s.state.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	failures := 0
+	for {
+		cmd, err := s.prepare()
+		if err != nil {
+			s.state.Status = ServiceExited
+			s.state.Pid = 0
+			s.state.LastExit = err.Error()
+			s.state.Save(s.BaseDir)
+			return err
+		}
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		if err = cmd.Start(); err == nil {
+			s.state.Status = ServiceRunning
+			s.state.Pid = cmd.Process.Pid
+			s.state.ProcessStart, _ = processStartTime(s.state.Pid)
+			s.state.StartTime = time.Now()
+			s.state.Save(s.BaseDir)
+			log.Printf("Service '%s' started, pid: %d, port: %d\n", s.Spec.Name, s.state.Pid, s.state.Port)
+
+			exited := make(chan error, 1)
+			go func() {
+				exited <- cmd.Wait()
+			}()
+			select {
+			case <-stop:
+				terminateProcess(cmd.Process, exited, stopGracePeriod)
+				s.state.Status = ServiceStopped
+				s.state.Pid = 0
+				s.state.LastExit = "stopped"
+				return s.state.Save(s.BaseDir)
+			case err = <-exited:
+			}
+			if time.Since(s.state.StartTime) >= stableRunTime {
+				failures = 0
+			}
+		}
+		if err != nil {
+			s.state.LastExit = err.Error()
+		} else {
+			s.state.LastExit = "exit status 0"
+		}
+		log.Printf("Service '%s' exited: %s\n", s.Spec.Name, s.state.LastExit)
+		var exitErr *exec.ExitError
+		if err == nil || (errors.As(err, &exitErr) && exitErr.Success()) {
+			if s.Spec.Startup != StartupAlways {
+				s.state.Status = ServiceExited
+				s.state.Pid = 0
+				return s.state.Save(s.BaseDir)
+			}
+		}
+		delay := restartBackoff(failures, s.MinBackoff, s.MaxBackoff)
+		failures++
+		s.state.Status = ServiceBackoff
+		s.state.Pid = 0
+		s.state.Save(s.BaseDir)
+		select {
+		case <-stop:
+			s.state.Status = ServiceStopped
+			return s.state.Save(s.BaseDir)
+		case <-time.After(delay):
+		}
+		s.state.Restarts++
+	}
+}
+
+/**
+ *	停止服务：通知监控进程停止服务进程并退出，等待至timeout
+ *	不支持信号的系统(windows)上直接结束服务进程和监控进程
+ *	只向启动时间与状态文件记录一致的进程发送信号，PID被复用时视为服务已不在运行
+ */
+func StopService(baseDir, name string, timeout time.Duration) error {
+	state, err := LoadServiceState(baseDir, name)
+	if err != nil {
+		return err
+	}
+	if !state.Active() {
+		return nil
+	}
+	p, err := os.FindProcess(state.SupervisorPid)
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		if sameProcess(state.Pid, state.ProcessStart) {
+			if child, err := os.FindProcess(state.Pid); err == nil {
+				child.Kill()
+			}
+		}
+		if err := p.Kill(); err != nil {
+			return err
+		}
+		state.Status = ServiceStopped
+		state.Pid = 0
+		return state.Save(baseDir)
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !sameProcess(state.SupervisorPid, state.SupervisorStart) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("service '%s' (pid %d) didn't stop in %v", name, state.SupervisorPid, timeout)
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestAllocatePort checks the declared port is used when free, and another free port when it is busy
+func TestAllocatePort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	if port, err := AllocatePort(busy, "local"); err != nil || port != busy {
+		t.Errorf("AllocatePort(free %d) = %d, %v", busy, port, err)
+	}
+	l, _ = net.Listen("tcp", l.Addr().String())
+	defer l.Close()
+	if port, err := AllocatePort(busy, "local"); err != nil || port == busy || port == 0 {
+		t.Errorf("AllocatePort(busy %d) = %d, %v", busy, port, err)
+	}
+}
+
+// TestSupervisor checks templates are rendered, exited processes are restarted with backoff, and the state is persisted
+func TestSupervisor(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := ServiceSpec{Name: "svc", Startup: StartupAlways, Command: exe,
+		Args: []string{"-test.run=^$", "-test.count={{.LocalPort}}"}, Accessible: "local"}
+	if _, _, err := (&ServiceSpec{Name: "bad", Command: "{{.Unknown}}"}).Render(ServiceArgs{}); err == nil {
+		t.Error("unknown template field is accepted")
+	}
+	if d := restartBackoff(10, time.Second, time.Minute); d != time.Minute {
+		t.Errorf("backoff = %v", d)
+	}
+
+	s := NewSupervisor(spec, t.TempDir())
+	s.MinBackoff = 10 * time.Millisecond
+	s.MaxBackoff = 20 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(stop)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		state, err := LoadServiceState(s.BaseDir, "svc")
+		if err == nil && state.Restarts >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("service isn't restarted: %+v, %v", state, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadServiceState(s.BaseDir, "svc")
+	if err != nil || state.Status != ServiceStopped || state.Port == 0 || state.Args[1] == spec.Args[1] {
+		t.Errorf("state = %+v, %v", state, err)
+	}
+}
+
+// TestServiceIdentity checks a reused PID isn't taken for the supervisor, so it is never signalled
+func TestServiceIdentity(t *testing.T) {
+	start, err := processStartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameProcess(os.Getpid(), start) || sameProcess(os.Getpid(), start+"0") || sameProcess(os.Getpid(), "") {
+		t.Errorf("sameProcess mismatches the start time %q", start)
+	}
+	baseDir := t.TempDir()
+	state := ServiceState{Name: "svc", Status: ServiceRunning, SupervisorPid: os.Getpid(), SupervisorStart: start + "0"}
+	if err := state.Save(baseDir); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := LoadServiceState(baseDir, "svc"); err != nil || state.Status != ServiceDead {
+		t.Errorf("state with a reused pid = %+v, %v", state, err)
+	}
+	//	Signalling the reused pid would terminate the test process itself
+	if err := StopService(baseDir, "svc", time.Second); err != nil {
+		t.Errorf("stop service with a reused pid: %v", err)
+	}
+}
@@ -2,48 +2,98 @@ package utils
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"fmt"
+	"hash"
 	"io"
 	"os"
 )
 
 /**
- *	生成一对公私钥
+ *	支持的签名密钥类型
  */
-func GenKeys() (pubKey, priKey []byte) {
-	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
-	//通过x509标准将得到的ras私钥序列化为ASN.1的DER编码字符串
-	x509_Privatekey := x509.MarshalPKCS1PrivateKey(privateKey)
-	//将私钥字符串设置到pem格式块中
-	pem_block := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509_Privatekey,
-	}
-	priKey = pem.EncodeToMemory(&pem_block)
-
-	//处理公钥,公钥包含在私钥中
-	publickKey := privateKey.PublicKey
-	//通过x509标准将得到的rsa公钥序列化为ASN.1 的 DER编码字符串
-	x509_PublicKey, _ := x509.MarshalPKIXPublicKey(&publickKey)
+const (
+	KeyTypeRsa       = "rsa"        //RSA-2048, PKCS#1 v1.5签名
+	KeyTypeEd25519   = "ed25519"    //Ed25519
+	KeyTypeEcdsaP256 = "ecdsa-p256" //ECDSA P-256, SHA-256散列
+)
+
+/**
+ *	生成一对公私钥，keyType为空则生成RSA密钥
+ */
+func GenKeys(keyType string) (pubKey, priKey []byte, err error) {
+	var publicKey crypto.PublicKey
+	var pemBlock pem.Block
+	switch keyType {
+	case "", KeyTypeRsa:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		//RSA私钥仍然采用PKCS#1格式，保持与旧版本smc兼容
+		pemBlock = pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}
+		publicKey = &privateKey.PublicKey
+	case KeyTypeEd25519:
+		pub, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		pemBlock = pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		publicKey = pub
+	case KeyTypeEcdsaP256:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		pemBlock = pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		publicKey = &privateKey.PublicKey
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	priKey = pem.EncodeToMemory(&pemBlock)
+
+	//通过x509标准将公钥序列化为ASN.1 的 DER编码字符串
+	x509_PublicKey, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
 	pem_PublickKey := pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: x509_PublicKey,
 	}
 	pubKey = pem.EncodeToMemory(&pem_PublickKey)
-	return
+	return pubKey, priKey, nil
 }
 
 /**
- *	生成一对公私钥，保存到文件publicFile和privateFile中
+ *	生成一对keyType类型的公私钥，保存到文件publicFile和privateFile中
  */
-func GenKeyFiles(publicFile, privateFile string) error {
-	pubKey, priKey := GenKeys()
+func GenKeyFiles(publicFile, privateFile, keyType string) error {
+	pubKey, priKey, err := GenKeys(keyType)
+	if err != nil {
+		return err
+	}
 
 	if err := os.WriteFile(publicFile, pubKey, 0640); err != nil {
 		return err
@@ -77,39 +127,133 @@ func RsaDecrypt(priKey []byte, cipherText []byte) []byte {
 	return decrypted
 }
 
+/**
+ *	解析PEM格式的私钥，根据PEM块类型自动识别密钥格式
+ */
+func parsePrivateKey(priKey []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(priKey)
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key: no PEM block found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key: %T", key)
+	}
+	return signer, nil
+}
+
+/**
+ *	解析PEM格式的公钥
+ */
+func parsePublicKey(pubKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pubKey)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key: no PEM block found")
+	}
+	//x509解码,得到一个interface类型的pub
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
 /**
  *	使用私钥签名，priKey是私钥，msg是要签名的信息
+ *	支持RSA(PKCS#1 v1.5)、ECDSA(ASN.1编码)和Ed25519签名
  */
 func Sign(priKey []byte, msg []byte) ([]byte, error) {
-	block, _ := pem.Decode(priKey)
-	PrivateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	signer, err := parsePrivateKey(priKey)
 	if err != nil {
 		return []byte{}, err
 	}
-	//加密操作,需要将接口类型的pub进行类型断言得到公钥类型
-	hash := sha256.Sum256(msg)
-	//调用签名函数,填入所需四个参数，得到签名
-	sign, err := rsa.SignPKCS1v15(rand.Reader, PrivateKey, crypto.SHA256, hash[:])
-	return sign, err
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256(msg)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		hash := sha256.Sum256(msg)
+		return ecdsa.SignASN1(rand.Reader, key, hash[:])
+	case ed25519.PrivateKey:
+		//Ed25519内部自带散列，直接对原文签名
+		return ed25519.Sign(key, msg), nil
+	default:
+		return []byte{}, fmt.Errorf("unsupported private key: %T", signer)
+	}
 }
 
 /**
  *	使用公钥pubKey和签名signText校验消息plainText的完整性
  */
 func VerifySign(pubKey []byte, signText []byte, plainText []byte) error {
-	block, _ := pem.Decode(pubKey)
-	//x509解码,得到一个interface类型的pub
-	pub, _ := x509.ParsePKIXPublicKey(block.Bytes)
-	//签名函数中需要的数据散列值
-	hash := sha256.Sum256(plainText)
-	//验证签名
-	return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, hash[:], signText)
+	pub, err := parsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(plainText)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signText)
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(plainText)
+		if !ecdsa.VerifyASN1(key, hash[:], signText) {
+			return fmt.Errorf("ecdsa: verification error")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, plainText, signText) {
+			return fmt.Errorf("ed25519: verification error")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key: %T", pub)
+	}
 }
 
 /**
- *	获取文件信息(大小及MD5)
+ *	包完整性校验支持的散列算法
  */
-func CalcFileMd5(fpath string) (uint64, string, error) {
+const (
+	ChecksumMd5    = "md5"    //仅用于兼容旧包，存在碰撞风险
+	ChecksumSha256 = "sha256" //默认算法
+	ChecksumSha512 = "sha512"
+)
+
+/**
+ *	根据算法名创建散列计算器
+ */
+func NewChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case ChecksumMd5:
+		return md5.New(), nil
+	case ChecksumSha256:
+		return sha256.New(), nil
+	case ChecksumSha512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algo)
+	}
+}
+
+/**
+ *	获取文件信息(大小及algo算法计算的散列值)
+ */
+func CalcFileChecksum(fpath string, algo string) (uint64, string, error) {
+	h, err := NewChecksumHash(algo)
+	if err != nil {
+		return 0, "", err
+	}
 	file, err := os.Open(fpath)
 	if err != nil {
 		return 0, "", err
@@ -120,18 +264,16 @@ func CalcFileMd5(fpath string) (uint64, string, error) {
 		return 0, "", err
 	}
 	buf := make([]byte, 1024*1024)
-	md5s := md5.New()
-	for {
-		n, err := file.Read(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, "", err
-		}
-		md5s.Write(buf[:n])
+	if _, err := io.CopyBuffer(h, file, buf); err != nil {
+		return 0, "", err
 	}
-	sum := md5s.Sum([]byte{})
-	md5str := hex.EncodeToString(sum[:])
-	return uint64(finfo.Size()), md5str, err
+	sum := h.Sum([]byte{})
+	return uint64(finfo.Size()), hex.EncodeToString(sum), nil
+}
+
+/**
+ *	获取文件信息(大小及MD5)
+ */
+func CalcFileMd5(fpath string) (uint64, string, error) {
+	return CalcFileChecksum(fpath, ChecksumMd5)
 }
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCalcFileChecksum checks the digests produced for each supported algorithm
+func TestCalcFileChecksum(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(fname, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{ChecksumMd5, "5d41402abc4b2a76b9719d911017c592"},
+		{ChecksumSha256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{ChecksumSha512, "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+	}
+	for _, tt := range tests {
+		size, sum, err := CalcFileChecksum(fname, tt.algo)
+		if err != nil {
+			t.Fatalf("CalcFileChecksum(%s) error: %v", tt.algo, err)
+		}
+		if size != 5 || sum != tt.want {
+			t.Errorf("CalcFileChecksum(%s) = %d, %s, want 5, %s", tt.algo, size, sum, tt.want)
+		}
+	}
+	if _, _, err := CalcFileChecksum(fname, "crc32"); err == nil {
+		t.Error("CalcFileChecksum should reject unknown algorithm")
+	}
+}
+
+// TestSignKeyTypes checks sign/verify round trips for every supported key type
+func TestSignKeyTypes(t *testing.T) {
+	msg := []byte("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+	for _, keyType := range []string{KeyTypeRsa, KeyTypeEd25519, KeyTypeEcdsaP256} {
+		pubKey, priKey, err := GenKeys(keyType)
+		if err != nil {
+			t.Fatalf("GenKeys(%s) error: %v", keyType, err)
+		}
+		sig, err := Sign(priKey, msg)
+		if err != nil {
+			t.Fatalf("Sign(%s) error: %v", keyType, err)
+		}
+		if err := VerifySign(pubKey, sig, msg); err != nil {
+			t.Errorf("VerifySign(%s) error: %v", keyType, err)
+		}
+		if err := VerifySign(pubKey, sig, []byte("tampered")); err == nil {
+			t.Errorf("VerifySign(%s) accepted tampered message", keyType)
+		}
+	}
+	// A key of another type must produce an error instead of a panic
+	edPub, _, _ := GenKeys(KeyTypeEd25519)
+	_, rsaPri, _ := GenKeys(KeyTypeRsa)
+	sig, _ := Sign(rsaPri, msg)
+	if err := VerifySign(edPub, sig, msg); err == nil {
+		t.Error("VerifySign accepted signature made by another key")
+	}
+	if _, err := Sign([]byte("not a pem"), msg); err == nil {
+		t.Error("Sign accepted invalid private key")
+	}
+	if err := VerifySign([]byte("not a pem"), sig, msg); err == nil {
+		t.Error("VerifySign accepted invalid public key")
+	}
+}
+
+// signPackage signs the descriptor of pkg as 'smc package build' does
+func signPackage(priKey []byte, pkg *PackageVersion) {
+	pkg.SignScope = SignScopeDescriptor
+	sig, _ := Sign(priKey, pkg.SignedMessage())
+	pkg.Sign = hex.EncodeToString(sig)
+}
+
+// TestVerifyIntegrityPolicy checks that md5 packages and checksum-only signatures are accepted only by the compat policy
+func TestVerifyIntegrityPolicy(t *testing.T) {
+	dir := t.TempDir()
+	pubKey, priKey, err := GenKeys(KeyTypeRsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(dir, "app")
+	if err := os.WriteFile(fname, []byte("package data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	makePkg := func(algo string) PackageVersion {
+		_, sum, err := CalcFileChecksum(fname, algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := PackageVersion{
+			PackageName:  "app",
+			Checksum:     sum,
+			ChecksumAlgo: algo,
+			Probe:        "--version",
+		}
+		signPackage(priKey, &pkg)
+		return pkg
+	}
+	compat := NewUpgrader("app", UpgradeConfig{BaseDir: dir, PublicKey: string(pubKey), Policy: VerifyPolicyCompat})
+	strict := NewUpgrader("app", UpgradeConfig{BaseDir: dir, PublicKey: string(pubKey), Policy: VerifyPolicyStrict})
+
+	if err := strict.verifyIntegrity(makePkg(ChecksumSha256), fname); err != nil {
+		t.Errorf("sha256 package rejected: %v", err)
+	}
+	if err := strict.verifyIntegrity(makePkg(ChecksumSha512), fname); err != nil {
+		t.Errorf("sha512 package rejected: %v", err)
+	}
+	legacy := makePkg(ChecksumMd5)
+	legacy.ChecksumAlgo = ""
+	legacy.SignScope = ""
+	sig, _ := Sign(priKey, []byte(legacy.Checksum))
+	legacy.Sign = hex.EncodeToString(sig)
+	if err := compat.verifyIntegrity(legacy, fname); err != nil {
+		t.Errorf("legacy md5 package rejected by compat policy: %v", err)
+	}
+	if err := strict.verifyIntegrity(legacy, fname); err == nil {
+		t.Error("legacy md5 package accepted by strict policy")
+	}
+	tampered := makePkg(ChecksumSha256)
+	tampered.Checksum = legacy.Checksum
+	if err := compat.verifyIntegrity(tampered, fname); err == nil {
+		t.Error("checksum mismatch not detected")
+	}
+	// The probe decides what runs after activation, changing it breaks the signature
+	tampered = makePkg(ChecksumSha256)
+	tampered.Probe = "../../bin/sh -c id"
+	if err := compat.verifyIntegrity(tampered, fname); err == nil {
+		t.Error("tampered probe accepted")
+	}
+	checksumOnly := makePkg(ChecksumSha256)
+	checksumOnly.SignScope = ""
+	sig, _ = Sign(priKey, []byte(checksumOnly.Checksum))
+	checksumOnly.Sign = hex.EncodeToString(sig)
+	if err := compat.verifyIntegrity(checksumOnly, fname); err != nil {
+		t.Errorf("checksum-only signature rejected by compat policy: %v", err)
+	}
+	if err := strict.verifyIntegrity(checksumOnly, fname); err == nil {
+		t.Error("checksum-only signature accepted by strict policy")
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+/**
+ *	系统描述中的组件/配置，版本为版本范围，如 ^1.0.0
+ */
+type ComponentSpec struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+/**
+ *	系统描述中的服务
+ */
+type ServiceSpec struct {
+	Name       string   `json:"name"`
+	Startup    string   `json:"startup"`          //启动方式，如always
+	Command    string   `json:"command"`          //启动命令，支持模板变量，如{{.ProcessPath}}
+	Args       []string `json:"args"`             //命令参数，支持模板变量，如{{.LocalPort}}
+	Protocol   string   `json:"protocol"`         //服务协议: http/tcp
+	Port       int      `json:"port"`             //服务端口
+	Metrics    string   `json:"metrics"`          //指标接口路径
+	Health     string   `json:"health,omitempty"` //健康检查接口路径(http服务)，为空则请求'/'
+	Accessible string   `json:"accessible"`       //访问范围: local/remote
+}
+
+/**
+ *	管理进程(如costrict)的描述
+ */
+type ManagerSpec struct {
+	Component ComponentSpec `json:"component"`
+	Service   ServiceSpec   `json:"service"`
+}
+
+/**
+ *	系统描述文件(system-spec.json)，由系统配置包system安装到{BaseDir}/share/system-spec.json
+ */
+type SystemSpec struct {
+	Configuration  string          `json:"configuration"`  //描述文件的版本
+	Manager        ManagerSpec     `json:"manager"`        //管理进程
+	Components     []ComponentSpec `json:"components"`     //组件(exec包)
+	Configurations []ComponentSpec `json:"configurations"` //配置(conf包)
+	Services       []ServiceSpec   `json:"services"`       //服务
+}
+
+/**
+ *	系统描述文件的默认路径
+ */
+func DefaultSystemSpecFile(baseDir string) string {
+	if baseDir == "" {
+		baseDir = getCostrictDir()
+	}
+	return filepath.Join(baseDir, "share", "system-spec.json")
+}
+
+func (s *SystemSpec) Load(fname string) error {
+	bytes, err := os.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, s)
+}
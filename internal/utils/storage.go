@@ -0,0 +1,368 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zgsm-ai/smc/internal/env"
+)
+
+const (
+	StorageLocal  = "local"  //本地目录(或挂载到本地的网络目录)
+	StorageS3     = "s3"     //S3兼容的对象存储
+	StorageWebDAV = "webdav" //WebDAV服务器
+)
+
+/**
+ *	包仓库的存储后端配置
+ *	@description
+ *	- 凭据不写在配置文件中，配置的是保存凭据的环境变量名
+ */
+type StorageConfig struct {
+	Type         string `json:"type"`                   //local/s3/webdav
+	Path         string `json:"path,omitempty"`         //local: 仓库目录
+	Url          string `json:"url,omitempty"`          //s3: 服务地址，如https://s3.amazonaws.com; webdav: 仓库地址
+	Bucket       string `json:"bucket,omitempty"`       //s3: 存储桶
+	Region       string `json:"region,omitempty"`       //s3: 区域，默认us-east-1
+	Prefix       string `json:"prefix,omitempty"`       //s3: 仓库在存储桶中的路径前缀
+	AccessKeyEnv string `json:"accessKeyEnv,omitempty"` //s3: 保存AccessKey的环境变量，默认AWS_ACCESS_KEY_ID
+	SecretKeyEnv string `json:"secretKeyEnv,omitempty"` //s3: 保存SecretKey的环境变量，默认AWS_SECRET_ACCESS_KEY
+	Username     string `json:"username,omitempty"`     //webdav: 用户名
+	PasswordEnv  string `json:"passwordEnv,omitempty"`  //webdav: 保存密码的环境变量
+}
+
+/**
+ *	包仓库的存储后端，name是仓库内的相对路径，如costrict/linux/amd64/1.0.0/package.json
+ */
+type Storage interface {
+	Exists(name string) (bool, error)
+	Put(name string, fpath string) error
+}
+
+/**
+ *	根据配置创建存储后端
+ */
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: env.SkipSSL}},
+		Timeout:   30 * time.Minute,
+	}
+	switch cfg.Type {
+	case StorageLocal:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("local storage needs 'path'")
+		}
+		return &localStorage{dir: cfg.Path}, nil
+	case StorageS3:
+		if cfg.Url == "" || cfg.Bucket == "" {
+			return nil, fmt.Errorf("s3 storage needs 'url' and 'bucket'")
+		}
+		s := &s3Storage{
+			url:    strings.TrimSuffix(cfg.Url, "/") + "/" + cfg.Bucket,
+			prefix: strings.Trim(cfg.Prefix, "/"),
+			region: cfg.Region,
+			client: client,
+		}
+		if s.region == "" {
+			s.region = "us-east-1"
+		}
+		s.accessKey = os.Getenv(defaultStr(cfg.AccessKeyEnv, "AWS_ACCESS_KEY_ID"))
+		s.secretKey = os.Getenv(defaultStr(cfg.SecretKeyEnv, "AWS_SECRET_ACCESS_KEY"))
+		if s.accessKey == "" || s.secretKey == "" {
+			return nil, fmt.Errorf("s3 credentials aren't set in environment")
+		}
+		return s, nil
+	case StorageWebDAV:
+		if cfg.Url == "" {
+			return nil, fmt.Errorf("webdav storage needs 'url'")
+		}
+		s := &webdavStorage{url: strings.TrimSuffix(cfg.Url, "/"), username: cfg.Username, client: client}
+		if cfg.PasswordEnv != "" {
+			s.password = os.Getenv(cfg.PasswordEnv)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown storage type '%s'", cfg.Type)
+}
+
+func defaultStr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+/**
+ *	本地目录
+ */
+type localStorage struct {
+	dir string
+}
+
+func (s *localStorage) Exists(name string) (bool, error) {
+	fpath, err := safeJoin(s.dir, name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *localStorage) Put(name string, fpath string) error {
+	dst, err := safeJoin(s.dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return err
+	}
+	return copyFileAtomic(fpath, dst, 0644)
+}
+
+/**
+ *	WebDAV服务器，上传前用MKCOL逐级创建目录
+ */
+type webdavStorage struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+func (s *webdavStorage) do(method, name string, body io.Reader, size int64) (int, error) {
+	req, err := http.NewRequest(method, s.url+"/"+escapePath(name), body)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, rsp.Body)
+	return rsp.StatusCode, nil
+}
+
+func (s *webdavStorage) Exists(name string) (bool, error) {
+	code, err := s.do(http.MethodHead, name, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD '%s' returns %d", name, code)
+}
+
+func (s *webdavStorage) Put(name string, fpath string) error {
+	dir := ""
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			break
+		}
+		dir = path.Join(dir, part)
+		//	目录已存在时返回405，不作为错误
+		code, err := s.do("MKCOL", dir+"/", nil, 0)
+		if err != nil {
+			return err
+		}
+		if code >= 300 && code != http.StatusMethodNotAllowed {
+			return fmt.Errorf("MKCOL '%s' returns %d", dir, code)
+		}
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	code, err := s.do(http.MethodPut, name, f, info.Size())
+	if err != nil {
+		return err
+	}
+	if code >= 300 {
+		return fmt.Errorf("PUT '%s' returns %d", name, code)
+	}
+	return nil
+}
+
+/**
+ *	S3兼容的对象存储，使用path-style地址和AWS Signature V4签名
+ */
+type s3Storage struct {
+	url       string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3Storage) objectUrl(name string) string {
+	if s.prefix != "" {
+		name = s.prefix + "/" + name
+	}
+	return s.url + "/" + escapePath(name)
+}
+
+func (s *s3Storage) Exists(name string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, s.objectUrl(name), nil)
+	if err != nil {
+		return false, err
+	}
+	signV4(req, emptyPayloadHash, s.accessKey, s.secretKey, s.region, time.Now())
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD '%s' returns %d", name, rsp.StatusCode)
+}
+
+func (s *s3Storage) Put(name string, fpath string) error {
+	size, sum, err := CalcFileChecksum(fpath, ChecksumSha256)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	req, err := http.NewRequest(http.MethodPut, s.objectUrl(name), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(size)
+	signV4(req, sum, s.accessKey, s.secretKey, s.region, time.Now())
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return fmt.Errorf("PUT '%s' returns %d: %s", name, rsp.StatusCode, string(data))
+	}
+	return nil
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+/**
+ *	按RFC3986编码路径，保留'/'
+ */
+func escapePath(name string) string {
+	var sb strings.Builder
+	for _, c := range []byte(name) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+/**
+ *	用AWS Signature V4给S3请求签名
+ *	@description
+ *	- 签名host、range、content-type及所有x-amz-*头
+ *	- payloadHash是请求体的sha256(十六进制)
+ */
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "range" || k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, escapePath(k)+"="+strings.ReplaceAll(escapePath(v), "/", "%2F"))
+		}
+	}
+	sort.Strings(params)
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonRequest := strings.Join([]string{req.Method, uri, strings.Join(params, "&"),
+		canonHeaders.String(), signedHeaders, payloadHash}, "\n")
+	hash := sha256.Sum256([]byte(canonRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSha256([]byte("AWS4"+secretKey), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
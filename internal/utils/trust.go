@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+ *	受信任的公钥，用于验证包签名
+ */
+type TrustedKey struct {
+	KeyId     string     `json:"keyId"`               //密钥ID，由公钥计算得出
+	PublicKey string     `json:"publicKey"`           //PEM格式的公钥
+	NotBefore *time.Time `json:"notBefore,omitempty"` //有效期开始时间，为空则不限制
+	NotAfter  *time.Time `json:"notAfter,omitempty"`  //有效期结束时间，为空则不限制
+	Comment   string     `json:"comment,omitempty"`   //备注
+}
+
+/**
+ *	吊销记录，被吊销的密钥签名的包一律拒绝
+ */
+type RevokedKey struct {
+	KeyId     string    `json:"keyId"`            //被吊销的密钥ID
+	RevokedAt time.Time `json:"revokedAt"`        //吊销时间
+	Reason    string    `json:"reason,omitempty"` //吊销原因
+}
+
+/**
+ *	本地信任库(密钥环)，保存在~/.costrict/trust/keyring.json
+ */
+type TrustStore struct {
+	Keys    []TrustedKey `json:"keys"`
+	Revoked []RevokedKey `json:"revoked"`
+}
+
+/**
+ *	计算公钥的密钥ID: 公钥DER编码的SHA-256散列值的前16个十六进制字符
+ */
+func KeyIdOf(pubKey []byte) (string, error) {
+	block, _ := pem.Decode(pubKey)
+	if block == nil {
+		return "", fmt.Errorf("invalid public key: no PEM block found")
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+/**
+ *	获取公钥的类型: rsa/ed25519/ecdsa-p256
+ */
+func KeyTypeOf(pubKey []byte) string {
+	pub, err := parsePublicKey(pubKey)
+	if err != nil {
+		return "unknown"
+	}
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRsa
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().Name == "P-256" {
+			return KeyTypeEcdsaP256
+		}
+		return "ecdsa"
+	default:
+		return "unknown"
+	}
+}
+
+/**
+ *	从私钥导出PEM格式的公钥
+ */
+func PublicKeyOf(priKey []byte) ([]byte, error) {
+	signer, err := parsePrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+/**
+ *	获取默认的信任库文件路径，baseDir为空则使用.costrict目录
+ */
+func DefaultTrustFile(baseDir string) string {
+	if baseDir == "" {
+		baseDir = getCostrictDir()
+	}
+	return filepath.Join(baseDir, "trust", "keyring.json")
+}
+
+/**
+ *	加载信任库，文件不存在时返回空的信任库
+ */
+func LoadTrustStore(fname string) (*TrustStore, error) {
+	ts := &TrustStore{}
+	bytes, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ts, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, ts); err != nil {
+		return nil, fmt.Errorf("LoadTrustStore('%s') unmarshal error: %v", fname, err)
+	}
+	return ts, nil
+}
+
+/**
+ *	保存信任库
+ */
+func (ts *TrustStore) Save(fname string) error {
+	bytes, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fname, bytes, 0644)
+}
+
+/**
+ *	添加受信任的公钥，密钥ID根据公钥自动计算
+ */
+func (ts *TrustStore) Add(key TrustedKey) (string, error) {
+	keyId, err := KeyIdOf([]byte(key.PublicKey))
+	if err != nil {
+		return "", err
+	}
+	if ts.IsRevoked(keyId) {
+		return keyId, fmt.Errorf("key '%s' has been revoked", keyId)
+	}
+	if key.NotBefore != nil && key.NotAfter != nil && key.NotAfter.Before(*key.NotBefore) {
+		return keyId, fmt.Errorf("invalid validity window: notAfter is before notBefore")
+	}
+	key.KeyId = keyId
+	for i, k := range ts.Keys {
+		if k.KeyId == keyId {
+			ts.Keys[i] = key
+			return keyId, nil
+		}
+	}
+	ts.Keys = append(ts.Keys, key)
+	return keyId, nil
+}
+
+/**
+ *	吊销指定ID的密钥，被吊销的密钥不必存在于信任库中(比如内置公钥)
+ */
+func (ts *TrustStore) Revoke(keyId, reason string) error {
+	if ts.IsRevoked(keyId) {
+		return fmt.Errorf("key '%s' is already revoked", keyId)
+	}
+	ts.Revoked = append(ts.Revoked, RevokedKey{
+		KeyId:     keyId,
+		RevokedAt: time.Now(),
+		Reason:    reason,
+	})
+	return nil
+}
+
+/**
+ *	检查密钥是否已被吊销
+ */
+func (ts *TrustStore) IsRevoked(keyId string) bool {
+	for _, r := range ts.Revoked {
+		if r.KeyId == keyId {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ *	检查密钥在时刻at是否处于有效期内
+ */
+func (k *TrustedKey) ValidAt(at time.Time) bool {
+	if k.NotBefore != nil && at.Before(*k.NotBefore) {
+		return false
+	}
+	if k.NotAfter != nil && at.After(*k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+/**
+ *	查找在时刻at可用于验证签名的密钥
+ */
+func (ts *TrustStore) Find(keyId string, at time.Time) (*TrustedKey, error) {
+	if ts.IsRevoked(keyId) {
+		return nil, fmt.Errorf("key '%s' has been revoked", keyId)
+	}
+	for i, k := range ts.Keys {
+		if k.KeyId != keyId {
+			continue
+		}
+		if !k.ValidAt(at) {
+			return nil, fmt.Errorf("key '%s' is out of its validity window", keyId)
+		}
+		return &ts.Keys[i], nil
+	}
+	return nil, os.ErrNotExist
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPublicKeyFor checks key selection by key ID with rotation, expiry and revocation
+func TestPublicKeyFor(t *testing.T) {
+	dir := t.TempDir()
+	oldPub, _, _ := GenKeys(KeyTypeRsa)
+	newPub, _, _ := GenKeys(KeyTypeEd25519)
+	oldId, _ := KeyIdOf(oldPub)
+	newId, _ := KeyIdOf(newPub)
+
+	u := NewUpgrader("app", UpgradeConfig{BaseDir: dir, PublicKey: string(oldPub)})
+	// Packages without keyId and packages signed by the default key use the default key
+	for _, id := range []string{"", oldId} {
+		if key, err := u.publicKeyFor(id); err != nil || string(key) != string(oldPub) {
+			t.Errorf("publicKeyFor(%q) = %v, want default key", id, err)
+		}
+	}
+	if _, err := u.publicKeyFor(newId); err == nil {
+		t.Error("untrusted key accepted")
+	}
+
+	ts, _ := LoadTrustStore(u.TrustFile)
+	expired := time.Now().Add(-time.Hour)
+	if _, err := ts.Add(TrustedKey{PublicKey: string(newPub), NotAfter: &expired}); err != nil {
+		t.Fatal(err)
+	}
+	ts.Save(u.TrustFile)
+	if _, err := u.publicKeyFor(newId); err == nil {
+		t.Error("expired key accepted")
+	}
+
+	ts.Keys[0].NotAfter = nil
+	ts.Save(u.TrustFile)
+	if key, err := u.publicKeyFor(newId); err != nil || string(key) != string(newPub) {
+		t.Errorf("rotated key not selected: %v", err)
+	}
+
+	// Revoking the default key rejects legacy packages as well
+	ts.Revoke(oldId, "leaked")
+	ts.Save(u.TrustFile)
+	if _, err := u.publicKeyFor(""); err == nil {
+		t.Error("revoked default key accepted")
+	}
+	if _, err := u.publicKeyFor(newId); err != nil {
+		t.Errorf("rotated key rejected after revoking old key: %v", err)
+	}
+}
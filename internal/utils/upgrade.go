@@ -14,9 +14,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zgsm-ai/smc/internal/env"
 )
@@ -27,65 +27,108 @@ import (
 type PackageType string
 
 const (
-	PackageTypeExec PackageType = "exec"
-	PackageTypeConf PackageType = "conf"
+	PackageTypeExec    PackageType = "exec"
+	PackageTypeConf    PackageType = "conf"
+	PackageTypeArchive PackageType = "archive" //压缩包(tar.gz/zip)，解压到版本目录
 )
 
 /**
- *	版本编号
+ *	版本编号，遵循SemVer 2.0: major.minor.micro[-preRelease][+buildMeta]
+ *	正式版本的JSON格式与旧版本一致，只有{major,minor,micro}
  */
 type VersionNumber struct {
-	Major int `json:"major"`
-	Minor int `json:"minor"`
-	Micro int `json:"micro"`
+	Major      int    `json:"major"`
+	Minor      int    `json:"minor"`
+	Micro      int    `json:"micro"`
+	PreRelease string `json:"preRelease,omitempty"` //预发布版本标识，如 beta.1、rc.2
+	BuildMeta  string `json:"buildMeta,omitempty"`  //构建元数据，如 sha.abc，不参与版本比较
 }
 
 /**
  *	包版本的描述&签名信息，用于验证包的正确性
  */
 type PackageVersion struct {
-	PackageName  string        `json:"packageName"`  //包名字
-	PackageType  PackageType   `json:"packageType"`  //包类型: exec/conf
-	FileName     string        `json:"fileName"`     //被打包的文件的相对路径(相对.costrict目录,为空则安装到默认路径)
-	Os           string        `json:"os"`           //操作系统名:linux/windows
-	Arch         string        `json:"arch"`         //硬件架构
-	Size         uint64        `json:"size"`         //包文件大小
-	Checksum     string        `json:"checksum"`     //Md5散列值
-	Sign         string        `json:"sign"`         //签名，使用私钥签的名，需要用对应公钥验证
-	ChecksumAlgo string        `json:"checksumAlgo"` //固定为“md5”
-	VersionId    VersionNumber `json:"versionId"`    //版本号，采用SemVer标准
-	Build        string        `json:"build"`        //构建信息：Tag/Branch信息 CommitID BuildTime
-	Description  string        `json:"description"`  //版本描述，含有更丰富的可读信息
+	PackageName  string        `json:"packageName"`         //包名字
+	PackageType  PackageType   `json:"packageType"`         //包类型: exec/conf/archive
+	FileName     string        `json:"fileName"`            //被打包的文件的相对路径(相对.costrict目录,为空则安装到默认路径)
+	Os           string        `json:"os"`                  //操作系统名:linux/windows
+	Arch         string        `json:"arch"`                //硬件架构
+	Size         uint64        `json:"size"`                //包文件大小
+	Checksum     string        `json:"checksum"`            //包文件的散列值(十六进制)
+	Sign         string        `json:"sign"`                //签名，使用私钥签的名，需要用对应公钥验证
+	KeyId        string        `json:"keyId,omitempty"`     //签名所用密钥的ID，为空则使用默认公钥验证
+	SignScope    string        `json:"signScope,omitempty"` //签名覆盖的范围：descriptor，为空(旧包)只签了散列值
+	ChecksumAlgo string        `json:"checksumAlgo"`        //散列算法: sha256/sha512，旧包为md5
+	VersionId    VersionNumber `json:"versionId"`           //版本号，采用SemVer标准
+	Build        string        `json:"build"`               //构建信息：Tag/Branch信息 CommitID BuildTime
+	Description  string        `json:"description"`         //版本描述，含有更丰富的可读信息
+	Probe        string        `json:"probe,omitempty"`     //激活后健康检查的参数，如'--version'，为空或'none'表示不检查
 }
 
 /**
  *	一个package版本的地址信息
  */
 type VersionAddr struct {
-	VersionId VersionNumber `json:"versionId"` //版本的地址信息
-	AppUrl    string        `json:"appUrl"`    //包地址
-	InfoUrl   string        `json:"infoUrl"`   //包描述信息(PackageVersion)文件的地址
+	VersionId VersionNumber `json:"versionId"`        //版本的地址信息
+	AppUrl    string        `json:"appUrl"`           //包地址
+	InfoUrl   string        `json:"infoUrl"`          //包描述信息(PackageVersion)文件的地址
+	Deltas    []DeltaAddr   `json:"deltas,omitempty"` //从旧版本升级到该版本的差分包
+}
+
+/**
+ *	差分包的地址信息，用基础版本的包文件加差分包可以重建该版本的包文件
+ */
+type DeltaAddr struct {
+	BaseVersion VersionNumber `json:"baseVersion"` //基础版本
+	Url         string        `json:"url"`         //差分包地址
+	Size        int64         `json:"size"`        //差分包大小
 }
 
 /**
  *	指定平台的关键信息，比如，最新版本，版本列表（描述一个硬件平台/操作系统对应的包列表）
  */
 type PlatformInfo struct {
-	PackageName string        `json:"packageName"`
-	Os          string        `json:"os"`
-	Arch        string        `json:"arch"`
-	Newest      VersionAddr   `json:"newest"`
-	Versions    []VersionAddr `json:"versions"`
+	IndexMeta
+	PackageName string                 `json:"packageName"`
+	Os          string                 `json:"os"`
+	Arch        string                 `json:"arch"`
+	Newest      VersionAddr            `json:"newest"`              //stable通道的最新版本
+	NewestSet   bool                   `json:"newestSet,omitempty"` //newest由smc package newest/promote显式设置，重建索引时保留
+	Channels    map[string]VersionAddr `json:"channels,omitempty"`  //其它发布通道(如beta、nightly)的最新版本
+	Versions    []VersionAddr          `json:"versions"`
+	Rollouts    []RolloutRule          `json:"rollouts,omitempty"` //分阶段发布规则，没有规则的版本全量发布
 }
 
+/**
+ *	包校验策略
+ */
+type VerifyPolicy string
+
+const (
+	VerifyPolicyCompat VerifyPolicy = "compat" //过渡期策略：仍接受md5校验、只签了散列值的旧包；用于索引时接受未签名的索引文件
+	VerifyPolicyStrict VerifyPolicy = "strict" //严格策略：只接受sha256/sha512校验、签名覆盖包描述的包；用于索引时只接受签名的索引文件
+)
+
+const SignScopeDescriptor = "descriptor" //包签名覆盖散列值及包描述中决定安装方式的字段
+
 type UpgradeConfig struct {
-	PublicKey  string //用来验证包签名的公钥
-	BaseUrl    string //保存安装包的服务器的基地址
-	BaseDir    string //costrict数据所在的基路径
-	Os         string //操作系统名
-	Arch       string //硬件平台名
-	TargetPath string //指定安装目标路径(及文件名)
-	NoSetPath  bool   //不需要设置PATH。设置PATH可以让程序所在路径被自动搜索
+	PublicKey       string        //用来验证包签名的公钥
+	BaseUrl         string        //保存安装包的服务器的基地址
+	BaseDir         string        //costrict数据所在的基路径
+	Os              string        //操作系统名
+	Arch            string        //硬件平台名
+	TargetPath      string        //指定安装目标路径(及文件名)
+	NoSetPath       bool          //不需要设置PATH。设置PATH可以让程序所在路径被自动搜索
+	Policy          VerifyPolicy  //包校验策略，为空则取SMC_VERIFY_POLICY设置
+	IndexPolicy     VerifyPolicy  //索引校验策略，为空则取SMC_INDEX_POLICY设置，默认strict
+	Progress        bool          //下载包时显示进度条
+	TrustFile       string        //信任库文件，为空则使用{BaseDir}/trust/keyring.json
+	AllowPreRelease bool          //自动升级时是否接受预发布版本，为false则取SMC_ALLOW_PRERELEASE设置
+	Channel         string        //订阅的发布通道，为空则取SMC_CHANNEL设置
+	MachineId       string        //机器ID，用于分阶段发布，为空则取SMC_MACHINE_ID设置
+	CacheKeep       int           //每个包在缓存中保留的版本数，为0则取SMC_CACHE_KEEP设置
+	CacheMaxSize    int64         //缓存总大小上限(字节)，为0则取SMC_CACHE_MAX_SIZE设置
+	CacheMaxAge     time.Duration //缓存版本的最长保留时间，为0则取SMC_CACHE_MAX_AGE设置
 }
 
 type Upgrader struct {
@@ -153,50 +196,10 @@ func GetBytes(urlStr string, params map[string]string) ([]byte, error) {
 }
 
 /**
- *	从服务器获取一个文件
+ *	从服务器获取一个文件，支持断点续传和失败重试
  */
 func GetFile(urlStr string, params map[string]string, savePath string) error {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: env.SkipSSL},
-	}
-	client := &http.Client{Transport: tr}
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return fmt.Errorf("GetFile('%s') failed: %v", urlStr, err)
-	}
-	vals := make(url.Values)
-	for k, v := range params {
-		vals.Set(k, v)
-	}
-	req.URL.RawQuery = vals.Encode()
-
-	rsp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("GetFile('%s') failed: %v", urlStr, err)
-	}
-	defer rsp.Body.Close()
-	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
-		rspBody, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("GetFile('%s', '%s') code: %d, error:%s",
-			urlStr, req.URL.RawQuery, rsp.StatusCode, string(rspBody))
-	}
-
-	// 创建一个文件用于保存
-	if err = os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
-		return fmt.Errorf("GetFile('%s'): MkdirAll('%s') error:%v", urlStr, savePath, err)
-	}
-	out, err := os.Create(savePath)
-	if err != nil {
-		return fmt.Errorf("GetFile('%s'): create('%s') error: %v", urlStr, savePath, err)
-	}
-	defer out.Close()
-
-	// 然后将响应流和文件流对接起来
-	_, err = io.Copy(out, rsp.Body)
-	if err != nil {
-		return fmt.Errorf("GetFile('%s'): copy error: %v", urlStr, err)
-	}
-	return err
+	return DownloadFile(urlStr, params, savePath, DefaultDownloadOptions)
 }
 
 //------------------------------------------------------------------------------
@@ -204,14 +207,29 @@ func GetFile(urlStr string, params map[string]string, savePath string) error {
 //------------------------------------------------------------------------------
 
 func (ver *VersionNumber) String() string {
-	return fmt.Sprintf("%d.%d.%d", ver.Major, ver.Minor, ver.Micro)
+	s := fmt.Sprintf("%d.%d.%d", ver.Major, ver.Minor, ver.Micro)
+	if ver.PreRelease != "" {
+		s += "-" + ver.PreRelease
+	}
+	if ver.BuildMeta != "" {
+		s += "+" + ver.BuildMeta
+	}
+	return s
 }
 
 func (ver *VersionNumber) Parse(verstr string) error {
 	var err error
 	var major, minor, micro int
 
-	vers := strings.Split(verstr, ".")
+	core, build, hasBuild := strings.Cut(verstr, "+")
+	core, pre, hasPre := strings.Cut(core, "-")
+	if hasBuild && !validIdentifiers(build, false) {
+		return fmt.Errorf("invalid build metadata '%s'", build)
+	}
+	if hasPre && !validIdentifiers(pre, true) {
+		return fmt.Errorf("invalid pre-release '%s'", pre)
+	}
+	vers := strings.Split(core, ".")
 	if len(vers) != 3 {
 		return fmt.Errorf("invalid version string")
 	}
@@ -230,11 +248,20 @@ func (ver *VersionNumber) Parse(verstr string) error {
 	ver.Major = major
 	ver.Minor = minor
 	ver.Micro = micro
+	ver.PreRelease = pre
+	ver.BuildMeta = build
 	return nil
 }
 
 /**
- *	比较版本
+ *	是否是预发布版本
+ */
+func (ver *VersionNumber) IsPreRelease() bool {
+	return ver.PreRelease != ""
+}
+
+/**
+ *	比较版本，按SemVer 2.0的优先级规则，构建元数据不参与比较
  */
 func CompareVersion(local, remote VersionNumber) int {
 	if local.Major != remote.Major {
@@ -243,7 +270,10 @@ func CompareVersion(local, remote VersionNumber) int {
 	if local.Minor != remote.Minor {
 		return local.Minor - remote.Minor
 	}
-	return local.Micro - remote.Micro
+	if local.Micro != remote.Micro {
+		return local.Micro - remote.Micro
+	}
+	return comparePreRelease(local.PreRelease, remote.PreRelease)
 }
 
 //------------------------------------------------------------------------------
@@ -251,7 +281,7 @@ func CompareVersion(local, remote VersionNumber) int {
 //------------------------------------------------------------------------------
 
 func (pkg *PackageVersion) Verify() error {
-	if pkg.PackageType != "exec" && pkg.PackageType != "conf" {
+	if pkg.PackageType != PackageTypeExec && pkg.PackageType != PackageTypeConf && pkg.PackageType != PackageTypeArchive {
 		return fmt.Errorf("invalid package type: %s", pkg.PackageType)
 	}
 	if pkg.FileName == "" {
@@ -260,9 +290,25 @@ func (pkg *PackageVersion) Verify() error {
 	if filepath.IsAbs(pkg.FileName) {
 		return fmt.Errorf("invalid FileName: %s", pkg.FileName)
 	}
+	if pkg.PackageType == PackageTypeArchive && !IsArchiveFile(pkg.FileName) {
+		return fmt.Errorf("invalid FileName: %s, archive package must be .tar.gz/.tgz/.zip", pkg.FileName)
+	}
 	return nil
 }
 
+/**
+ *	包签名覆盖的内容
+ *	旧包只签了散列值，包名、类型、安装路径和probe可以在服务端被改动而不破坏签名，
+ *	而probe决定了激活后运行的程序，所以新包的签名同时覆盖这些决定安装方式的字段
+ */
+func (pkg *PackageVersion) SignedMessage() []byte {
+	if pkg.SignScope != SignScopeDescriptor {
+		return []byte(pkg.Checksum)
+	}
+	return []byte(strings.Join([]string{SignScopeDescriptor, pkg.Checksum, pkg.ChecksumAlgo, pkg.PackageName,
+		string(pkg.PackageType), pkg.FileName, pkg.Os, pkg.Arch, pkg.VersionId.String(), pkg.Probe}, "\n"))
+}
+
 func (pkg *PackageVersion) Load(fname string) error {
 	bytes, err := os.ReadFile(fname)
 	if err != nil {
@@ -279,7 +325,7 @@ func (pkg *PackageVersion) Save(fname string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(fname, bytes, 0644); err != nil {
+	if err := writeFileAtomic(fname, bytes, 0644); err != nil {
 		log.Printf("Save package file '%s' failed: %v\n", fname, err)
 		return err
 	}
@@ -314,7 +360,7 @@ func (u *Upgrader) GetLocalVersion(ver *VersionNumber) (pkg PackageVersion, err
 }
 
 /**
- *	从远程库获取包版本
+ *	从远程库获取包版本，无法连接远程库时使用离线包导入的索引
  */
 func (u *Upgrader) GetRemoteVersions() (PlatformInfo, error) {
 	//	<base-url>/<package>/<os>/<arch>/platform.json
@@ -322,31 +368,55 @@ func (u *Upgrader) GetRemoteVersions() (PlatformInfo, error) {
 
 	bytes, err := GetBytes(urlStr, nil)
 	if err != nil {
-		return PlatformInfo{}, err
+		offline, oerr := os.ReadFile(u.offlineIndexFile())
+		if oerr != nil {
+			return PlatformInfo{}, err
+		}
+		log.Printf("GetRemoteVersions('%s') failed: %v, use offline index\n", urlStr, err)
+		bytes = offline
 	}
 	vers := &PlatformInfo{}
 	if err = json.Unmarshal(bytes, vers); err != nil {
 		return *vers, fmt.Errorf("GetRemoteVersions('%s') unmarshal error: %v", urlStr, err)
 	}
+	name := fmt.Sprintf("%s/%s/%s/platform.json", u.packageName, u.Os, u.Arch)
+	if err = u.verifyIndex(name, bytes); err != nil {
+		log.Printf("GetRemoteVersions('%s') verify error: %v\n", urlStr, err)
+		return PlatformInfo{}, err
+	}
 	return *vers, nil
 }
 
+/**
+ *	用户固定(pin/hold)的版本：package/pinned/{package}.json
+ */
+func (u *Upgrader) pinFile() string {
+	return filepath.Join(u.packageDir, "pinned", fmt.Sprintf("%s.json", u.packageName))
+}
+
+/**
+ *	旧版本每次激活都会自动写入package/pins/{package}.json，它不代表用户的选择，不再作为固定版本
+ */
+func (u *Upgrader) removeLegacyPin() {
+	os.Remove(filepath.Join(u.packageDir, "pins", fmt.Sprintf("%s.json", u.packageName)))
+}
+
 /**
  *	固定版本，令自动升级忽略该包
  */
 func (u *Upgrader) AddPinned(pkg PackageVersion) error {
-	pinsDir := filepath.Join(u.packageDir, "pins")
-	if err := os.MkdirAll(pinsDir, 0775); err != nil {
-		log.Printf("Create directory '%s' failed: %v\n", pinsDir, err)
+	pkgFile := u.pinFile()
+	if err := os.MkdirAll(filepath.Dir(pkgFile), 0775); err != nil {
+		log.Printf("Create directory '%s' failed: %v\n", filepath.Dir(pkgFile), err)
 		return err
 	}
-	//	把包描述文件保存到包文件目录
-	pkgFile := filepath.Join(pinsDir, fmt.Sprintf("%s.json", u.packageName))
+	u.removeLegacyPin()
 	return pkg.Save(pkgFile)
 }
 
 func (u *Upgrader) RemovePinned() {
-	pkgFile := filepath.Join(u.packageDir, "pins", fmt.Sprintf("%s.json", u.packageName))
+	u.removeLegacyPin()
+	pkgFile := u.pinFile()
 	if _, err := os.Stat(pkgFile); err == nil {
 		if err := os.Remove(pkgFile); err != nil {
 			log.Printf("Remove '%s' failed: %v", pkgFile, err)
@@ -355,8 +425,7 @@ func (u *Upgrader) RemovePinned() {
 }
 
 func (u *Upgrader) GetPinned() (pkg PackageVersion, err error) {
-	pkgFile := filepath.Join(u.packageDir, "pins", fmt.Sprintf("%s.json", u.packageName))
-	err = pkg.Load(pkgFile)
+	err = pkg.Load(u.pinFile())
 	return
 }
 
@@ -385,17 +454,40 @@ func (u *Upgrader) GetTodo() (pkg PackageVersion, err error) {
 	return
 }
 
+/**
+ *	获取云端升级包的描述信息，同时返回描述文件的原始内容
+ */
+func (u *Upgrader) getPackageInfo(addr VersionAddr) (PackageVersion, []byte, error) {
+	var pkg PackageVersion
+	data, err := GetBytes(u.BaseUrl+addr.InfoUrl, nil)
+	if err != nil {
+		log.Printf("Get package info from '%s' failed: %v\n", addr.InfoUrl, err)
+		return pkg, nil, err
+	}
+	if err = json.Unmarshal(data, &pkg); err != nil {
+		log.Printf("Unmarshal package info from '%s' failed: %v\n", addr.InfoUrl, err)
+		return pkg, nil, err
+	}
+	if err = pkg.Verify(); err != nil {
+		log.Printf("Invalid package file '%s': %v\n", addr.InfoUrl, err)
+		return pkg, nil, err
+	}
+	return pkg, data, nil
+}
+
 /**
  *	获取包(需要校验保证包的合法性)
  */
 func (u *Upgrader) GetPackage(specVer *VersionNumber) (PackageVersion, bool, error) {
 	var pkg PackageVersion
 	var curVer VersionNumber
+	var installed *VersionNumber
 
 	//	获取本地版本信息
 	pkgFile := filepath.Join(u.packageDir, fmt.Sprintf("%s.json", u.packageName))
 	if err := pkg.Load(pkgFile); err == nil {
 		curVer = pkg.VersionId
+		installed = &curVer
 		if specVer != nil && CompareVersion(curVer, *specVer) == 0 {
 			return pkg, false, nil
 		}
@@ -423,27 +515,21 @@ func (u *Upgrader) GetPackage(specVer *VersionNumber) (PackageVersion, bool, err
 			return pkg, false, fmt.Errorf("version %s isn't exist", specVer.String())
 		}
 	} else { //升级最新版本
-		ret := CompareVersion(curVer, vers.Newest.VersionId)
+		addr = u.newestVersion(vers, installed)
+		if installed == nil && addr.InfoUrl == "" {
+			return pkg, false, fmt.Errorf("no version of '%s' is released to this machine", u.packageName)
+		}
+		ret := CompareVersion(curVer, addr.VersionId)
 		if ret >= 0 {
 			return pkg, false, nil
 		}
-		addr = vers.Newest
 	}
 	if pkg, err := u.checkLocalPackage(addr.VersionId); err == nil {
 		return pkg, true, nil
 	}
 	//	获取云端升级包的描述信息
-	data, err := GetBytes(u.BaseUrl+addr.InfoUrl, nil)
+	pkg, data, err := u.getPackageInfo(addr)
 	if err != nil {
-		log.Printf("Get package info from '%s' failed: %v\n", addr.InfoUrl, err)
-		return pkg, false, err
-	}
-	if err = json.Unmarshal(data, &pkg); err != nil {
-		log.Printf("Unmarshal package info from '%s' failed: %v\n", addr.InfoUrl, err)
-		return pkg, false, err
-	}
-	if err = pkg.Verify(); err != nil {
-		log.Printf("Invalid package file '%s': %v\n", addr.InfoUrl, err)
 		return pkg, false, err
 	}
 	cacheDir := filepath.Join(u.packageDir, addr.VersionId.String())
@@ -451,16 +537,22 @@ func (u *Upgrader) GetPackage(specVer *VersionNumber) (PackageVersion, bool, err
 		log.Printf("Create cache directory '%s' failed: %v\n", cacheDir, err)
 		return pkg, false, err
 	}
-	//	下载包
+	//	下载包：优先使用差分包，失败则下载完整的包
 	_, fname := filepath.Split(pkg.FileName)
 	cacheFname := filepath.Join(cacheDir, fname)
-	if err = GetFile(u.BaseUrl+addr.AppUrl, nil, cacheFname); err != nil {
-		log.Printf("Download package from '%s' to '%s' failed: %v\n", addr.AppUrl, cacheFname, err)
-		return pkg, false, err
-	}
-	//	验证下载文件的完整性，防止丢失、篡改等
-	if err := u.verifyIntegrity(pkg, cacheFname); err != nil {
-		return pkg, false, err
+	if err := u.getDeltaPackage(pkg, addr, cacheFname); err != nil {
+		opts := DefaultDownloadOptions
+		opts.Progress = u.Progress
+		if err = DownloadFile(u.BaseUrl+addr.AppUrl, nil, cacheFname, opts); err != nil {
+			log.Printf("Download package from '%s' to '%s' failed: %v\n", addr.AppUrl, cacheFname, err)
+			return pkg, false, err
+		}
+		//	验证下载文件的完整性，防止丢失、篡改等
+		if err := u.verifyIntegrity(pkg, cacheFname); err != nil {
+			//	删除校验失败的文件，避免下次从错误的数据续传
+			os.Remove(cacheFname)
+			return pkg, false, err
+		}
 	}
 	//	把包描述文件保存到包文件目录
 	pkgFile = filepath.Join(u.packageDir, fmt.Sprintf("%s-%s.json", u.packageName, pkg.VersionId.String()))
@@ -471,21 +563,88 @@ func (u *Upgrader) GetPackage(specVer *VersionNumber) (PackageVersion, bool, err
 	return pkg, true, nil
 }
 
+/**
+ *	通过差分包获取包文件
+ *	@description
+ *	- 在addr提供的差分包中，选择本地缓存了基础版本且基础版本校验通过的差分包
+ *	- 下载差分包，用基础版本的包文件重建新版本的包文件到cacheFname
+ *	- 重建的文件必须通过新版本包描述中签名的散列值校验
+ *	- 没有可用的差分包或任何一步失败，返回错误，由调用者下载完整的包
+ */
+func (u *Upgrader) getDeltaPackage(pkg PackageVersion, addr VersionAddr, cacheFname string) error {
+	for _, d := range addr.Deltas {
+		basePkg, err := u.checkLocalPackage(d.BaseVersion)
+		if err != nil {
+			continue
+		}
+		_, baseName := filepath.Split(basePkg.FileName)
+		baseFname := filepath.Join(u.packageDir, d.BaseVersion.String(), baseName)
+		deltaFname := fmt.Sprintf("%s.%s.delta", cacheFname, d.BaseVersion.String())
+		opts := DefaultDownloadOptions
+		opts.Progress = u.Progress
+		if err := DownloadFile(u.BaseUrl+d.Url, nil, deltaFname, opts); err != nil {
+			log.Printf("Download delta from '%s' failed: %v\n", d.Url, err)
+			return err
+		}
+		defer os.Remove(deltaFname)
+		if err := ApplyDelta(baseFname, deltaFname, cacheFname, int64(pkg.Size)); err != nil {
+			log.Printf("Apply delta '%s' to '%s' failed: %v\n", d.Url, baseFname, err)
+			os.Remove(cacheFname)
+			return err
+		}
+		if err := u.verifyIntegrity(pkg, cacheFname); err != nil {
+			os.Remove(cacheFname)
+			return err
+		}
+		log.Printf("Package '%s' %s rebuilt from %s with delta (%d bytes)\n", u.packageName,
+			pkg.VersionId.String(), d.BaseVersion.String(), d.Size)
+		return nil
+	}
+	return os.ErrNotExist
+}
+
 /**
  *	激活版本ver的包，令其成为当前版本
+ *	激活不会固定版本，需要固定时由调用者调用AddPinned
  */
 func (u *Upgrader) ActivatePackage(pkg PackageVersion) error {
-	if err := u.activatePackage(pkg); err != nil {
-		return err
-	}
-	u.AddPinned(pkg)
-	return nil
+	return u.activatePackage(pkg)
 }
 
 /**
  *	升级包
+ *	- 指定版本specVer时，升级/降级到该版本并固定(与'smc component upgrade -v'一致)，
+ *	  已经是该版本时同样固定，之后自动升级保持在该版本，直到'smc component unpin'
+ *	- 未指定版本时自动升级，包被固定(pin/hold)则保持在固定的版本，
+ *	  云端有更新的版本时只记录到待办(todos)，由用户决定何时升级
  */
 func (u *Upgrader) UpgradePackage(specVer *VersionNumber) (PackageVersion, bool, error) {
+	u.removeLegacyPin()
+	if specVer != nil {
+		pkg, upgraded, err := u.applyPackage(specVer)
+		if err != nil {
+			return pkg, false, err
+		}
+		return pkg, upgraded, u.AddPinned(pkg)
+	}
+	if pinned, err := u.GetPinned(); err == nil {
+		return u.upgradePinned(pinned)
+	}
+	return u.applyPackage(nil)
+}
+
+/**
+ *	切换到版本ver，不改变版本固定，用于按版本范围同步(smc component sync)
+ */
+func (u *Upgrader) ApplyPackage(ver VersionNumber) (PackageVersion, bool, error) {
+	u.removeLegacyPin()
+	return u.applyPackage(&ver)
+}
+
+/**
+ *	获取并激活版本specVer(为nil则为最新版本)的包
+ */
+func (u *Upgrader) applyPackage(specVer *VersionNumber) (PackageVersion, bool, error) {
 	pkg, upgraded, err := u.GetPackage(specVer)
 	if err != nil {
 		return pkg, false, err
@@ -493,12 +652,18 @@ func (u *Upgrader) UpgradePackage(specVer *VersionNumber) (PackageVersion, bool,
 	if !upgraded { //不需要更新，所以不需要激活
 		return pkg, false, nil
 	}
+	//	激活期间的待办用于发现中断的升级，激活失败时(已恢复到之前的版本)还原为原来的待办
+	pending, pendingErr := u.GetTodo()
 	u.AddTodo(pkg)
 	if err := u.activatePackage(pkg); err != nil {
+		if pendingErr == nil {
+			u.AddTodo(pending)
+		} else {
+			u.RemoveTodo()
+		}
 		return pkg, false, err
 	}
 	u.RemoveTodo()
-	u.RemovePinned()
 	return pkg, true, nil
 }
 
@@ -527,22 +692,22 @@ func (u *Upgrader) RemovePackage(ver *VersionNumber) error {
 	if err := pkg.Load(pkgFile); err != nil {
 		return nil
 	}
-	u.removeSpecialVersion(pkg.VersionId)
-	// 删除包数据文件
-	var dataPath string
-	dir, fname := filepath.Split(pkg.FileName)
-	if dir != "" {
-		dataPath = filepath.Join(u.BaseDir, pkg.FileName)
-	} else {
-		dataPath = filepath.Join(u.installDir, fname)
+	if err := u.removeSpecialVersion(pkg.VersionId); err != nil {
+		return fmt.Errorf("RemovePackage: %v", err)
 	}
+	u.removeBackup()
+	u.removeConfState()
+	// 删除包数据文件，archive包解压出的文件已经按清单删除
+	if pkg.PackageType != PackageTypeArchive {
+		dataPath := u.installPath(pkg)
 
-	// 检查文件是否存在，如果存在则删除
-	if _, err := os.Stat(dataPath); err == nil {
-		if err := os.Remove(dataPath); err != nil {
-			return fmt.Errorf("RemovePackage: remove package file '%s' failed: %v", dataPath, err)
+		// 检查文件是否存在，如果存在则删除
+		if _, err := os.Stat(dataPath); err == nil {
+			if err := os.Remove(dataPath); err != nil {
+				return fmt.Errorf("RemovePackage: remove package file '%s' failed: %v", dataPath, err)
+			}
+			log.Printf("Package file '%s' removed successfully\n", dataPath)
 		}
-		log.Printf("Package file '%s' removed successfully\n", dataPath)
 	}
 
 	// 删除包描述文件
@@ -555,19 +720,14 @@ func (u *Upgrader) RemovePackage(ver *VersionNumber) error {
 }
 
 /**
- * 清理package目录下过老的版本包数据
- * @param {string} baseDir - costrict数据所在的基路径，如果为空则使用默认路径
+ * 按保留策略清理package目录下过老的版本包数据
  * @returns {error} 返回错误对象，成功时返回nil
  * @description
- * - 扫描版本描述文件package/x-{ver}.json文件，提取文件中保存的版本信息
- * - 保证每个模块只保留最新的三个包，过老的包需要清除
+ * - 保留策略见CleanupCache，每个包默认保留最新的三个版本
  * - 删除过老的包描述文件x-{ver}.json和package/{ver}/{targetFile}
- * - 支持自定义baseDir，如果为空则使用默认的.costrict目录
- * - 按包名分组处理，每个包保留最新的三个版本
+ * - 激活、固定、待升级及可回退的版本不会被删除
  * @throws
  * - 读取package目录失败
- * - 解析版本描述文件失败
- * - 删除包文件或描述文件失败
  * @example
  * err := CleanupOldVersions()
  * if err != nil {
@@ -575,112 +735,59 @@ func (u *Upgrader) RemovePackage(ver *VersionNumber) error {
  * }
  */
 func (u *Upgrader) CleanupOldVersions() error {
-	// 检查package目录是否存在
-	if _, err := os.Stat(u.packageDir); os.IsNotExist(err) {
-		log.Printf("Cleanup: package directory '%s' does not exist\n", u.packageDir)
-		return err
-	}
-
-	// 读取package目录下的所有文件
-	files, err := os.ReadDir(u.packageDir)
-	if err != nil {
-		log.Printf("Cleanup: package directory '%s' read failed: %v\n", u.packageDir, err)
-		return err
-	}
-
-	// 按包名分组的版本信息
-	packageVersions := make(map[string][]VersionSummary)
-
-	// 遍历文件，找出所有版本描述文件（格式：x-{ver}.json）
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filename := file.Name()
-		// 匹配格式：{packageName}-{version}.json
-		if !strings.HasSuffix(filename, ".json") {
-			continue
-		}
-		// 关注中间带‘-’的版本描述文件
-		parts := strings.Split(filename, "-")
-		if len(parts) < 2 {
-			continue
-		}
-		// 读取包描述文件
-		filePath := filepath.Join(u.packageDir, filename)
-		// 解析包描述信息
-		var pkg PackageVersion
-		if err := pkg.Load(filePath); err != nil {
-			log.Printf("Cleanup: Load '%s' failed: %v\n", filePath, err)
-			continue
-		}
-		versionStr := pkg.VersionId.String()
-		_, fname := filepath.Split(pkg.FileName)
-		// 保存版本信息
-		versionInfo := VersionSummary{
-			PackageName: pkg.PackageName,
-			Version:     pkg.VersionId,
-			PackageDir:  filepath.Join(u.packageDir, versionStr),
-			DescPath:    filePath,
-			DataPath:    filepath.Join(u.packageDir, versionStr, fname),
-		}
-
-		packageVersions[pkg.PackageName] = append(packageVersions[pkg.PackageName], versionInfo)
-	}
-
-	// 对每个包的版本进行排序，并删除过老的版本
-	for _, versions := range packageVersions {
-		// 按版本号从新到旧排序
-		sort.Slice(versions, func(i, j int) bool {
-			return CompareVersion(versions[i].Version, versions[j].Version) > 0
-		})
-		removeOldestVersions(versions, 3)
-	}
-
-	return nil
+	_, err := u.CleanupCache(false)
+	return err
 }
 
 // VersionSummary 包版本的摘要，用于清理过老版本
 type VersionSummary struct {
-	PackageName string        // 包名
-	Version     VersionNumber // 版本号
-	DescPath    string        // 包描述文件路径
-	PackageDir  string        // 包目录路径
-	DataPath    string        // 包数据文件路径
+	PackageName  string        // 包名
+	Version      VersionNumber // 版本号
+	DescPath     string        // 包描述文件路径
+	PackageDir   string        // 包目录路径
+	DataPath     string        // 包数据文件路径
+	ManifestPath string        // archive包的文件清单路径
 }
 
 /**
- *	删除过老版本，但保留开头即最新的reserveNum个版本
+ *	删除缓存中的一个版本
  */
-func removeOldestVersions(versions []VersionSummary, reserveNum int) {
-	// 如果版本数量超过保留数目，则删除过老的版本
-	for i := reserveNum; i < len(versions); i++ {
-		old := versions[i]
-
-		// 删除包描述文件
-		if err := os.Remove(old.DescPath); err != nil {
-			log.Printf("Cleanup: remove description file '%s' failed: %v\n", old.DescPath, err)
-		} else {
-			log.Printf("Cleanup: description file '%s' removed\n", old.DescPath)
-		}
+func removeCachedVersion(old VersionSummary) {
+	// 删除包描述文件
+	if err := os.Remove(old.DescPath); err != nil {
+		log.Printf("Cleanup: remove description file '%s' failed: %v\n", old.DescPath, err)
+	} else {
+		log.Printf("Cleanup: description file '%s' removed\n", old.DescPath)
+	}
 
-		// 删除包数据文件
-		if err := os.Remove(old.DataPath); err != nil {
-			log.Printf("Cleanup: remove data file '%s' failed: %v\n", old.DataPath, err)
-		} else {
-			log.Printf("Cleanup: data file '%s' removed\n", old.DataPath)
-		}
+	// 删除包数据文件
+	if err := os.Remove(old.DataPath); err != nil {
+		log.Printf("Cleanup: remove data file '%s' failed: %v\n", old.DataPath, err)
+	} else {
+		log.Printf("Cleanup: data file '%s' removed\n", old.DataPath)
+	}
 
-		// 检查目录是否为空，如果为空则删除目录
-		if isDirEmpty(old.PackageDir) {
-			if err := os.Remove(old.PackageDir); err != nil {
-				log.Printf("Cleanup: remove directory '%s' failed: %v\n", old.PackageDir, err)
+	// 删除archive包解压出的文件
+	if old.ManifestPath != "" {
+		var manifest PackageManifest
+		if err := manifest.Load(old.ManifestPath); err == nil {
+			if err := manifest.Remove(); err != nil {
+				log.Printf("Cleanup: remove files of '%s' failed: %v\n", old.ManifestPath, err)
 			} else {
-				log.Printf("Cleanup: package directory '%s' removed\n", old.PackageDir)
+				os.Remove(old.ManifestPath)
+				log.Printf("Cleanup: files of '%s' removed\n", old.ManifestPath)
 			}
 		}
 	}
+
+	// 检查目录是否为空，如果为空则删除目录
+	if isDirEmpty(old.PackageDir) {
+		if err := os.Remove(old.PackageDir); err != nil {
+			log.Printf("Cleanup: remove directory '%s' failed: %v\n", old.PackageDir, err)
+		} else {
+			log.Printf("Cleanup: package directory '%s' removed\n", old.PackageDir)
+		}
+	}
 }
 
 func (u *Upgrader) checkLocalPackage(ver VersionNumber) (PackageVersion, error) {
@@ -698,86 +805,156 @@ func (u *Upgrader) checkLocalPackage(ver VersionNumber) (PackageVersion, error)
 }
 
 func (u *Upgrader) verifyIntegrity(pkg PackageVersion, fname string) error {
-	_, md5str, err := CalcFileMd5(fname)
+	algo := pkg.ChecksumAlgo
+	if algo == "" { //早期的包描述文件没有填写算法，均为md5
+		algo = ChecksumMd5
+	}
+	if algo == ChecksumMd5 && u.Policy != VerifyPolicyCompat {
+		log.Printf("Package '%s' uses md5 checksum, rejected by policy '%s'\n", pkg.PackageName, u.Policy)
+		return fmt.Errorf("checksum algorithm '%s' is not allowed", algo)
+	}
+	_, sumstr, err := CalcFileChecksum(fname, algo)
 	if err != nil {
-		log.Printf("Calculate MD5 for file '%s' failed: %v\n", fname, err)
+		log.Printf("Calculate %s for file '%s' failed: %v\n", algo, fname, err)
 		return err
 	}
-	if md5str != pkg.Checksum {
-		log.Printf("MD5 checksum mismatch for package '%s'. Expected: %s, Actual: %s\n", pkg.PackageName, pkg.Checksum, md5str)
+	if sumstr != pkg.Checksum {
+		log.Printf("%s checksum mismatch for package '%s'. Expected: %s, Actual: %s\n", algo, pkg.PackageName, pkg.Checksum, sumstr)
 		return fmt.Errorf("checksum error")
 	}
 	//	检查签名，防止包被篡改
+	if err := u.verifyPackageSign(pkg); err != nil {
+		log.Printf("Verify signature for package '%s' failed: %v\n", pkg.PackageName, err)
+		return err
+	}
+	return nil
+}
+
+/**
+ *	验证包描述的签名，散列值须已与包文件核对
+ *	只签了散列值的旧包仅在兼容策略下接受
+ */
+func (u *Upgrader) verifyPackageSign(pkg PackageVersion) error {
+	if pkg.SignScope != SignScopeDescriptor {
+		if pkg.SignScope != "" {
+			return fmt.Errorf("unknown signature scope '%s'", pkg.SignScope)
+		}
+		if u.Policy != VerifyPolicyCompat {
+			return fmt.Errorf("signature doesn't cover the descriptor, rejected by policy '%s'", u.Policy)
+		}
+	}
 	sig, err := hex.DecodeString(pkg.Sign)
 	if err != nil {
-		log.Printf("Decode signature for package '%s' failed: %v\n", pkg.PackageName, err)
-		return err
+		return fmt.Errorf("decode signature failed: %v", err)
 	}
-	if err = VerifySign([]byte(u.PublicKey), sig, []byte(md5str)); err != nil {
-		log.Printf("Verify signature for package '%s' failed: %v\n", pkg.PackageName, err)
+	pubKey, err := u.publicKeyFor(pkg.KeyId)
+	if err != nil {
 		return err
 	}
-	return nil
+	return VerifySign(pubKey, sig, pkg.SignedMessage())
+}
+
+/**
+ *	根据密钥ID选择验证签名的公钥
+ *	- 信任库中吊销的密钥一律拒绝
+ *	- 优先使用信任库中处于有效期内的密钥
+ *	- 密钥ID为空(旧包)或与默认公钥一致时，使用默认公钥
+ */
+func (u *Upgrader) publicKeyFor(keyId string) ([]byte, error) {
+	ts, err := LoadTrustStore(u.TrustFile)
+	if err != nil {
+		return nil, err
+	}
+	defId, err := KeyIdOf([]byte(u.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	if keyId == "" {
+		keyId = defId
+	}
+	key, err := ts.Find(keyId, time.Now())
+	if err == nil {
+		return []byte(key.PublicKey), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if keyId == defId {
+		return []byte(u.PublicKey), nil
+	}
+	return nil, fmt.Errorf("key '%s' is not trusted", keyId)
 }
 
 /**
  *	激活版本ver的包，令其成为当前版本
+ *	@description
+ *	- 备份当前版本(包描述及安装的数据文件)到package/prev目录
+ *	- 以临时文件+改名的方式安装，中断时不会留下残缺的文件
+ *	- 安装后进行健康检查，失败则自动恢复到之前的版本，返回ErrProbeFailed
  */
 func (u *Upgrader) activatePackage(pkg PackageVersion) error {
 	_, fname := filepath.Split(pkg.FileName)
 	cacheDir := filepath.Join(u.packageDir, pkg.VersionId.String())
 	cacheFname := filepath.Join(cacheDir, fname)
+	pkgFile := filepath.Join(u.packageDir, fmt.Sprintf("%s.json", u.packageName))
+
+	var prev *PackageVersion //健康检查失败时恢复到的版本，nil表示删除新安装的包
+	var cur PackageVersion
+	reinstall := false
+	if err := cur.Load(pkgFile); err == nil {
+		if CompareVersion(cur.VersionId, pkg.VersionId) != 0 {
+			if err := u.backupPackage(cur); err != nil {
+				log.Printf("Backup package '%s-%s' failed: %v\n", u.packageName, cur.VersionId.String(), err)
+				return err
+			}
+			prev = &cur
+		} else if p, err := u.GetPrevious(); err == nil {
+			//	重新安装当前版本，失败时恢复到备份的版本
+			prev = &p
+		} else {
+			reinstall = true
+		}
+	}
 	//	把下载的包安装到正式目录
 	if err := u.installPackage(pkg, cacheFname); err != nil {
 		log.Printf("Install package '%s' failed: %v\n", cacheFname, err)
 		return err
 	}
-	pkgFile := filepath.Join(u.packageDir, fmt.Sprintf("%s.json", u.packageName))
-	return pkg.Save(pkgFile)
+	if err := pkg.Save(pkgFile); err != nil {
+		return err
+	}
+	if err := u.probePackage(pkg); err != nil {
+		log.Printf("Probe package '%s-%s' failed: %v\n", u.packageName, pkg.VersionId.String(), err)
+		if reinstall { //没有可以恢复的版本，保持现状
+			return fmt.Errorf("%w: %v", ErrProbeFailed, err)
+		}
+		if rerr := u.revertPackage(pkg, prev); rerr != nil {
+			log.Printf("Revert package '%s' failed: %v\n", u.packageName, rerr)
+			return fmt.Errorf("%w: %v, revert failed: %v", ErrProbeFailed, err, rerr)
+		}
+		if prev != nil {
+			log.Printf("Package '%s' reverted to version %s\n", u.packageName, prev.VersionId.String())
+		}
+		return fmt.Errorf("%w: %v", ErrProbeFailed, err)
+	}
+	return nil
 }
 
 /**
  *	保存包数据文件
+ *	拷贝到目标目录的临时文件后再改名为目标文件，保证目标文件要么是旧版本，要么是完整的新版本
  */
 func (u *Upgrader) savePackageData(pkg PackageVersion, cacheFname string) error {
-	var dataPath string
-	if u.TargetPath != "" {
-		dataPath = u.TargetPath
-	} else {
-		dir, fname := filepath.Split(pkg.FileName)
-		if dir != "" {
-			dataPath = filepath.Join(u.BaseDir, pkg.FileName)
-		} else {
-			dataPath = filepath.Join(u.installDir, fname)
-		}
-	}
+	dataPath := u.installPath(pkg)
 	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
 		return err
 	}
-	if err := os.Remove(dataPath); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	// 拷贝文件而不是重命名
-	srcFile, err := os.Open(cacheFname)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	dstFile, err := os.Create(dataPath)
-	if err != nil {
-		return err
-	}
-	defer dstFile.Close()
-
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return err
-	}
-	if pkg.PackageType != PackageTypeExec {
-		return nil
+	var perm os.FileMode = 0644
+	if pkg.PackageType == PackageTypeExec {
+		perm = 0755
 	}
-	return os.Chmod(dataPath, 0755)
+	// 拷贝文件而不是重命名，缓存的包文件要保留用于回退
+	return copyFileAtomic(cacheFname, dataPath, perm)
 }
 
 /**
@@ -875,6 +1052,12 @@ func linuxSetPATH(installDir string) error {
  *	安装包数据
  */
 func (u *Upgrader) installPackage(pkg PackageVersion, cacheFname string) error {
+	if pkg.PackageType == PackageTypeArchive {
+		return u.extractPackage(pkg, cacheFname)
+	}
+	if pkg.PackageType == PackageTypeConf {
+		return u.saveConfData(pkg, cacheFname)
+	}
 	if err := u.savePackageData(pkg, cacheFname); err != nil {
 		return err
 	}
@@ -909,6 +1092,10 @@ func (u *Upgrader) removeSpecialVersion(ver VersionNumber) error {
 			return err
 		}
 	}
+	// 删除archive包解压出的文件
+	if err := u.removeManifestFiles(ver); err != nil {
+		return err
+	}
 
 	// 删除包描述文件
 	if err := os.Remove(pkgFile); err != nil {
@@ -979,9 +1166,38 @@ func (u *Upgrader) correct() {
 	if u.PublicKey == "" {
 		u.PublicKey = SHENMA_PUBLIC_KEY
 	}
+	if u.Policy == "" {
+		u.Policy = VerifyPolicy(env.VerifyPolicy)
+	}
+	if u.Policy != VerifyPolicyStrict {
+		u.Policy = VerifyPolicyCompat
+	}
+	//	索引的签名与md5的过渡无关，未签名的索引可被任意篡改，默认只接受签名的
+	if u.IndexPolicy == "" {
+		u.IndexPolicy = VerifyPolicy(env.IndexPolicy)
+	}
+	if u.IndexPolicy != VerifyPolicyCompat {
+		u.IndexPolicy = VerifyPolicyStrict
+	}
 	if u.BaseDir == "" {
 		u.BaseDir = getCostrictDir()
 	}
+	if u.TrustFile == "" {
+		u.TrustFile = DefaultTrustFile(u.BaseDir)
+	}
+	if !u.AllowPreRelease {
+		u.AllowPreRelease = env.PreRelease
+	}
+	if u.Channel == "" {
+		u.Channel = env.Channel
+	}
+	if u.Channel == "" {
+		u.Channel = DefaultChannel
+	}
+	if u.MachineId == "" {
+		u.MachineId = env.MachineId
+	}
+	u.correctRetention()
 	u.installDir = filepath.Join(u.BaseDir, "bin")
 	u.packageDir = filepath.Join(u.BaseDir, "package")
 }